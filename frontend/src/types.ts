@@ -111,3 +111,19 @@ export interface RegistrationData {
   captchaSid: string
   codeField: string
 }
+
+// BufferStatus is payload of buffer:progress event, progress of file before playback
+export interface BufferStatus {
+  hash: string
+  fileId: number
+  position: number
+  ready: number
+  target: number
+  percent: number
+  eta: number // seconds, -1 - unknown
+  speed: number // bytes per second
+  bitRate: number
+  duration: number
+  done: boolean
+  capped: boolean // target is limited by cache, playback may stall
+}
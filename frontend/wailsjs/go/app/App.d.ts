@@ -40,3 +40,5 @@ export function SaveCookiesToFile(arg1:Array<http.Cookie>):Promise<void>;
 export function SearchRuTracker(arg1:string):Promise<Array<app.RutrackerTorrent>>;
 
 export function SetSettings(arg1:app.Settings):Promise<void>;
+
+export function StartPlaybackNow():Promise<void>;
@@ -77,3 +77,7 @@ export function SearchRuTracker(arg1) {
 export function SetSettings(arg1) {
   return window['go']['app']['App']['SetSettings'](arg1);
 }
+
+export function StartPlaybackNow() {
+  return window['go']['app']['App']['StartPlaybackNow']();
+}
@@ -11,6 +11,7 @@ replace (
 
 require (
 	github.com/PuerkitoBio/goquery v1.10.3
+	github.com/anacrolix/dht/v2 v2.22.1
 	github.com/anacrolix/dms v1.7.1
 	github.com/anacrolix/missinggo/v2 v2.8.0
 	github.com/anacrolix/publicip v0.3.1
@@ -21,6 +22,7 @@ require (
 	go.etcd.io/bbolt v1.4.0
 	golang.org/x/exp v0.0.0-20250606033433-dcc06ee1d476
 	golang.org/x/image v0.28.0
+	golang.org/x/net v0.41.0
 	golang.org/x/text v0.30.0
 	golang.org/x/time v0.12.0
 	gopkg.in/vansante/go-ffprobe.v2 v2.2.1
@@ -30,7 +32,6 @@ require (
 	github.com/RoaringBitmap/roaring v1.9.4 // indirect
 	github.com/alecthomas/atomic v0.1.0-alpha2 // indirect
 	github.com/anacrolix/chansync v0.6.0 // indirect
-	github.com/anacrolix/dht/v2 v2.22.1 // indirect
 	github.com/anacrolix/envpprof v1.4.0 // indirect
 	github.com/anacrolix/generics v0.0.3 // indirect
 	github.com/anacrolix/log v0.16.0 // indirect
@@ -76,7 +77,6 @@ require (
 	github.com/wailsapp/go-webview2 v1.0.19 // indirect
 	github.com/wailsapp/mimetype v1.4.1 // indirect
 	golang.org/x/crypto v0.39.0 // indirect
-	golang.org/x/net v0.41.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 )
@@ -23,6 +23,17 @@ type App struct {
 	httpServer *http.Server
 	httpMu     sync.Mutex
 	streamPort string
+	events     *torrserv.Subscription
+
+	// playback and sleep timer state
+	playMu        sync.Mutex
+	playing       bool
+	stopRequested bool
+	skipBuffer    context.CancelFunc // stops buffering, nil - not buffering
+	pendingTimer  *SleepTimerOptions
+	timer         *sleepTimer
+
+	exports exports
 }
 
 // NewApp creates a new App application struct
@@ -63,10 +74,21 @@ func (a *App) Startup(ctx context.Context) {
 		return
 	}
 	runtime.LogInfo(ctx, "BitTorrent client initialized successfully")
+
+	a.bridgeEvents()
+
+	// continue full downloads of kept torrents
+	torrserv.LoadKeepTorrents()
+
+	// refresh health badges of library torrents
+	torrserv.StartHealthMonitor()
 }
 
 // Shutdown is called when the app is closing
 func (a *App) Shutdown(ctx context.Context) {
+	if a.events != nil {
+		a.events.Close()
+	}
 	if a.btServer != nil {
 		a.btServer.Disconnect()
 	}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+)
+
+// CreateTorrent creates a torrent from local file or directory in background,
+// progress is sent with "torrent:create" events. Empty output asks user where to save .torrent
+func (a *App) CreateTorrent(opts CreateTorrentOptions) error {
+	if a.ctx == nil {
+		return fmt.Errorf("application not initialized yet")
+	}
+	if opts.Path == "" {
+		return fmt.Errorf("source path is empty")
+	}
+	if opts.Output == "" {
+		var err error
+		opts.Output, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "Сохранить торрент-файл",
+			DefaultFilename: filepath.Base(opts.Path) + ".torrent",
+			Filters:         []runtime.FileFilter{{DisplayName: "Torrent", Pattern: "*.torrent"}},
+		})
+		if err != nil {
+			return err
+		}
+		if opts.Output == "" && !opts.Seed {
+			// dialog cancelled
+			return nil
+		}
+	}
+
+	co := torrserv.CreateOptions{
+		Path:        opts.Path,
+		Output:      opts.Output,
+		WebSeeds:    opts.WebSeeds,
+		Private:     opts.Private,
+		Comment:     opts.Comment,
+		PieceLength: opts.PieceLength,
+		Seed:        opts.Seed,
+		Title:       opts.Title,
+		Category:    opts.Category,
+	}
+	for _, tr := range opts.Trackers {
+		co.Trackers = append(co.Trackers, []string{tr})
+	}
+	runtime.LogInfo(a.ctx, fmt.Sprintf("Creating torrent from %s", opts.Path))
+	go func() {
+		if _, err := torrserv.CreateTorrent(context.Background(), co); err != nil {
+			runtime.LogError(a.ctx, fmt.Sprintf("Error create torrent from %s: %v", opts.Path, err))
+		}
+	}()
+	return nil
+}
+
+// CancelCreateTorrent stops creation of a torrent from path
+func (a *App) CancelCreateTorrent(path string) error {
+	return torrserv.CancelCreate(path)
+}
+
+// GetCreateProgress returns progress of torrent creation from path, nil if it isn't created now
+func (a *App) GetCreateProgress(path string) *CreateProgress {
+	p := torrserv.CreateProgress(path)
+	if p == nil {
+		return nil
+	}
+	cp := &CreateProgress{
+		Path:        p.Path,
+		Output:      p.Output,
+		Hash:        p.Hash,
+		Name:        p.Name,
+		Files:       p.Files,
+		PieceLength: p.PieceLength,
+		Pieces:      p.Pieces,
+		Hashed:      p.Hashed,
+		Total:       p.Total,
+		Done:        p.Done,
+		Seeding:     p.Seeding,
+		Error:       p.Error,
+	}
+	if p.Total > 0 {
+		cp.Progress = float64(p.Hashed) * 100 / float64(p.Total)
+	}
+	return cp
+}
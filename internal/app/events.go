@@ -1,5 +1,11 @@
 package app
 
+import (
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+)
+
 // TorrentMetadataLoadedEvent represents metadata loaded event
 type TorrentMetadataLoadedEvent struct {
 	Hash      string `json:"hash"`
@@ -11,3 +17,34 @@ type TorrentMetadataLoadedEvent struct {
 	SizeStr   string `json:"sizeStr"`
 	Loaded    bool   `json:"loaded"`
 }
+
+// frontendEvents are events forwarded to the frontend, piece and reader events are
+// published for every piece and stream request, they stay on the bus for Go subscribers
+var frontendEvents = map[string]bool{
+	"torrent:added":            true,
+	"torrent:metadata":         true,
+	"torrent:metadataProgress": true,
+	"torrent:state":            true,
+	"torrent:preload":          true,
+	"torrent:closed":           true,
+	"torrent:keep":             true,
+	"torrent:export":           true,
+	"torrent:health":           true,
+	"torrent:create":           true,
+	"peer:banned":              true,
+	"network:interface":        true,
+	"buffer:progress":          true,
+}
+
+// bridgeEvents forwards torrent lifecycle events from the BT server to the frontend
+func (a *App) bridgeEvents() {
+	sub := torrserv.SubscribeEvents(256)
+	a.events = sub
+	go func() {
+		for ev := range sub.C {
+			if frontendEvents[ev.EventName()] {
+				runtime.EventsEmit(a.ctx, ev.EventName(), ev)
+			}
+		}
+	}()
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"fmt"
+
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/health"
+)
+
+// ProbeTorrentHealth scrapes trackers and DHT for a magnet link, .torrent file or hash without adding the torrent
+func (a *App) ProbeTorrentHealth(input string) (*TorrentHealth, error) {
+	if a.ctx == nil {
+		return nil, fmt.Errorf("application not initialized yet")
+	}
+	spec, _, _, err := a.parseTorrentInput(input)
+	if err != nil {
+		return nil, err
+	}
+	return toTorrentHealth(torrserv.ProbeHealth(a.ctx, spec)), nil
+}
+
+// GetTorrentHealth returns last probed health of a torrent, nil if it was not probed yet
+func (a *App) GetTorrentHealth(hash string) *TorrentHealth {
+	h := torrserv.GetHealth(hash)
+	if h == nil {
+		return nil
+	}
+	return toTorrentHealth(h)
+}
+
+func toTorrentHealth(h *health.Health) *TorrentHealth {
+	th := &TorrentHealth{
+		Hash:      h.Hash,
+		Badge:     h.Badge,
+		Seeders:   h.Seeders,
+		Leechers:  h.Leechers,
+		Completed: h.Completed,
+		DHTPeers:  h.DHTPeers,
+		Checked:   h.Checked,
+		Trackers:  make([]TrackerHealth, 0, len(h.Trackers)),
+	}
+	for _, tr := range h.Trackers {
+		th.Trackers = append(th.Trackers, TrackerHealth(*tr))
+	}
+	return th
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+)
+
+// KeepTorrent downloads files of a torrent completely into dir, so they can be watched offline.
+// Empty dir asks user for directory, empty fileIndexes keeps all files
+func (a *App) KeepTorrent(hash string, dir string, fileIndexes []int) error {
+	if a.ctx == nil {
+		return fmt.Errorf("application not initialized yet")
+	}
+	if dir == "" {
+		var err error
+		dir, err = runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+			Title:                "Выберите папку для сохранения",
+			CanCreateDirectories: true,
+		})
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			// dialog cancelled
+			return nil
+		}
+	}
+
+	runtime.LogInfo(a.ctx, fmt.Sprintf("Keep torrent %s to %s", hash, dir))
+	return torrserv.KeepTorrent(hash, dir, fileIndexes)
+}
+
+// PauseKeep pauses full download of a kept torrent
+func (a *App) PauseKeep(hash string) error {
+	return torrserv.PauseKeep(hash, true)
+}
+
+// ResumeKeep resumes full download of a kept torrent
+func (a *App) ResumeKeep(hash string) error {
+	return torrserv.PauseKeep(hash, false)
+}
+
+// CancelKeep turns keep mode off, downloaded files are not removed
+func (a *App) CancelKeep(hash string) {
+	torrserv.CancelKeep(hash)
+}
+
+// GetKeepStatus returns progress of keep mode, nil if the torrent is not kept
+func (a *App) GetKeepStatus(hash string) (*KeepStatus, error) {
+	tor := torrserv.GetTorrent(hash)
+	if tor == nil {
+		return nil, fmt.Errorf("torrent not found")
+	}
+	st := tor.KeepStatus()
+	if st == nil {
+		return nil, nil
+	}
+	ks := &KeepStatus{
+		Path:      st.Path,
+		Files:     st.Files,
+		Paused:    st.Paused,
+		Seed:      st.Seed,
+		Completed: st.Completed,
+		Total:     st.Total,
+		Done:      st.Done,
+	}
+	if st.Total > 0 {
+		ks.Progress = float64(st.Completed) * 100 / float64(st.Total)
+	}
+	return ks, nil
+}
+
+// exports holds cancel functions of running "save file as" copies
+type exports struct {
+	cancels map[string]context.CancelFunc
+	mu      sync.Mutex
+}
+
+func exportKey(hash string, fileIndex int) string {
+	return fmt.Sprintf("%s/%d", hash, fileIndex)
+}
+
+// SaveFileAs copies a file out of the torrent to dest in background, progress is sent with torrent:export events.
+// Empty dest asks user for file name
+func (a *App) SaveFileAs(hash string, fileIndex int, dest string) error {
+	if a.ctx == nil {
+		return fmt.Errorf("application not initialized yet")
+	}
+	tor := torrserv.GetTorrent(hash)
+	if tor == nil {
+		return fmt.Errorf("torrent not found")
+	}
+	if !tor.GotInfo() {
+		return fmt.Errorf("torrent metadata not loaded")
+	}
+	file := tor.FileByID(fileIndex)
+	if file == nil {
+		return fmt.Errorf("invalid file index: %d", fileIndex)
+	}
+
+	if dest == "" {
+		var err error
+		dest, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "Сохранить файл как",
+			DefaultFilename: filepath.Base(file.DisplayPath()),
+		})
+		if err != nil {
+			return err
+		}
+		if dest == "" {
+			return nil
+		}
+	}
+
+	key := exportKey(hash, fileIndex)
+	a.exports.mu.Lock()
+	if a.exports.cancels == nil {
+		a.exports.cancels = make(map[string]context.CancelFunc)
+	}
+	if _, ok := a.exports.cancels[key]; ok {
+		a.exports.mu.Unlock()
+		return fmt.Errorf("file is already being saved")
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.exports.cancels[key] = cancel
+	a.exports.mu.Unlock()
+
+	runtime.LogInfo(a.ctx, fmt.Sprintf("Saving %s to %s", file.Path(), dest))
+	go func() {
+		defer func() {
+			a.exports.mu.Lock()
+			delete(a.exports.cancels, key)
+			a.exports.mu.Unlock()
+			cancel()
+		}()
+		if err := tor.ExportFile(ctx, file, dest); err != nil {
+			runtime.LogError(a.ctx, fmt.Sprintf("Failed to save %s: %v", file.Path(), err))
+			return
+		}
+		runtime.LogInfo(a.ctx, fmt.Sprintf("Saved %s", dest))
+	}()
+	return nil
+}
+
+// CancelSaveFile stops copying of the file started by SaveFileAs
+func (a *App) CancelSaveFile(hash string, fileIndex int) {
+	a.exports.mu.Lock()
+	cancel := a.exports.cancels[exportKey(hash, fileIndex)]
+	a.exports.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
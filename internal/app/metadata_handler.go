@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// GetMetadataProgress returns progress of metadata fetch, nil if metadata is not fetched now and the fetch didn't fail
+func (a *App) GetMetadataProgress(hash string) *MetadataProgress {
+	p := torrserv.MetadataProgress(hash)
+	if p == nil {
+		return nil
+	}
+	return &MetadataProgress{
+		Hash:          hash,
+		Attempt:       p.Attempt,
+		Attempts:      p.Attempts,
+		Peers:         p.Peers,
+		ActivePeers:   p.ActivePeers,
+		ExtendedPeers: p.ExtendedPeers,
+		Size:          p.Size,
+		Received:      p.Received,
+		Started:       p.Started,
+		Done:          p.Done,
+		Error:         p.Error,
+	}
+}
+
+// CancelMetadata stops metadata fetch of a torrent, the torrent stays in the library
+func (a *App) CancelMetadata(hash string) error {
+	return torrserv.CancelMetadata(hash)
+}
+
+// ExportTorrentFile writes .torrent of a library entry, empty path asks user where to save
+func (a *App) ExportTorrentFile(hash, path string) (string, error) {
+	if a.ctx == nil {
+		return "", fmt.Errorf("application not initialized yet")
+	}
+	if path == "" {
+		name := hash
+		if tor := torrserv.GetTorrentDB(metainfo.NewHashFromHex(hash)); tor != nil && tor.Title != "" {
+			name = strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(tor.Title)
+		}
+		var err error
+		path, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "Сохранить торрент-файл",
+			DefaultFilename: name + ".torrent",
+			Filters:         []runtime.FileFilter{{DisplayName: "Torrent", Pattern: "*.torrent"}},
+		})
+		if err != nil || path == "" {
+			return "", err
+		}
+	}
+	path, err := torrserv.ExportTorrentFile(hash, path)
+	if err != nil {
+		return "", err
+	}
+	runtime.LogInfo(a.ctx, fmt.Sprintf("Torrent %s exported to %s", hash, path))
+	return path, nil
+}
+
+// ExportMagnet returns magnet link of a library entry with display name and trackers
+func (a *App) ExportMagnet(hash string) (string, error) {
+	return torrserv.ExportMagnet(hash)
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+// GetNetworkInterface returns status of the bound interface, torrents are paused by kill switch while it is down
+func (a *App) GetNetworkInterface() *NetInterface {
+	return toNetInterface(torrserv.NetInterface())
+}
+
+// ListNetworkInterfaces returns interfaces which are up to bind torrents to
+func (a *App) ListNetworkInterfaces() []NetInterface {
+	list := torrserv.NetInterfaces()
+	ret := make([]NetInterface, 0, len(list))
+	for _, st := range list {
+		ret = append(ret, *toNetInterface(st))
+	}
+	return ret
+}
+
+func toNetInterface(st *state.NetInterface) *NetInterface {
+	return &NetInterface{
+		Name:       st.Name,
+		Found:      st.Found,
+		Up:         st.Up,
+		Addrs:      st.Addrs,
+		KillSwitch: st.KillSwitch,
+		Paused:     st.Paused,
+		Checked:    st.Checked,
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"sort"
+
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+)
+
+// GetTorrentPeers returns connected peers of a running torrent, fastest first
+func (a *App) GetTorrentPeers(hash string) ([]PeerInfo, error) {
+	peers, err := torrserv.GetTorrentPeers(hash)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		pi := PeerInfo{
+			Addr:           p.Addr,
+			Client:         p.Client,
+			PeerID:         p.PeerID,
+			Network:        p.Network,
+			Encrypted:      p.Encrypted,
+			Source:         p.Source,
+			DownSpeed:      p.DownloadSpeed,
+			UpSpeed:        p.UploadSpeed,
+			Pieces:         p.Pieces,
+			TotalPieces:    p.TotalPieces,
+			AmInterested:   p.AmInterested,
+			AmChoking:      p.AmChoking,
+			PeerInterested: p.PeerInterested,
+			PeerChoking:    p.PeerChoking,
+			Connected:      p.ConnectedSeconds,
+		}
+		if p.TotalPieces > 0 {
+			pi.Progress = float64(p.Pieces) / float64(p.TotalPieces) * 100
+		}
+		ret = append(ret, pi)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].DownSpeed > ret[j].DownSpeed
+	})
+	return ret, nil
+}
+
+// AddTorrentPeer connects a running torrent to a peer with address ip:port
+func (a *App) AddTorrentPeer(hash, addr string) error {
+	return torrserv.AddPeer(hash, addr)
+}
+
+// BanPeer blocks a peer ip for all torrents till restart, addr is ip or ip:port
+func (a *App) BanPeer(addr string) error {
+	return torrserv.BanPeer(addr)
+}
+
+// UnbanPeer removes a peer ip from banned
+func (a *App) UnbanPeer(addr string) error {
+	return torrserv.UnbanPeer(addr)
+}
+
+// GetBannedPeers returns banned ips with ban reasons, including peers banned for corrupt pieces
+func (a *App) GetBannedPeers() map[string]string {
+	return torrserv.BannedPeers()
+}
+
+// GetBlocklistStatus returns ranges loaded from blocklists and count of rejected peers
+func (a *App) GetBlocklistStatus() (*BlocklistStatus, error) {
+	st, err := torrserv.BlocklistStats()
+	if err != nil {
+		return nil, err
+	}
+	ret := &BlocklistStatus{
+		Ranges:   st.Ranges,
+		Banned:   st.Banned,
+		Rejected: st.Rejected,
+		Loaded:   st.Loaded,
+		Updating: st.Updating,
+		Sources:  make([]BlocklistSource, 0, len(st.Sources)),
+	}
+	for _, s := range st.Sources {
+		ret.Sources = append(ret.Sources, BlocklistSource{
+			URL:     s.URL,
+			Ranges:  s.Ranges,
+			Updated: s.Updated,
+			Error:   s.Error,
+		})
+	}
+	sort.Slice(ret.Sources, func(i, j int) bool {
+		return ret.Sources[i].URL < ret.Sources[j].URL
+	})
+	return ret, nil
+}
+
+// UpdateBlocklist downloads blocklists now and applies them without reconnect
+func (a *App) UpdateBlocklist() error {
+	return torrserv.UpdateBlocklist()
+}
@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
 )
 
 // RutrackerClient handles HTTP requests to RuTracker
@@ -33,8 +35,9 @@ func NewRutrackerClient(ctx context.Context) (*RutrackerClient, error) {
 	}
 
 	client := &http.Client{
-		Jar:     jar,
-		Timeout: 30 * time.Second,
+		Jar:       jar,
+		Timeout:   30 * time.Second,
+		Transport: proxy.Transport(),
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// Follow up to 10 redirects
 			if len(via) >= 10 {
@@ -1,10 +1,14 @@
 package app
 
 import (
+	"strings"
+
 	"github.com/dustin/go-humanize"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
 	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
 )
 
 // GetSettings returns current settings
@@ -23,19 +27,39 @@ func (a *App) GetSettings() *Settings {
 		DownloadRate:     btsets.DownloadRateLimit,
 		UploadRate:       btsets.UploadRateLimit,
 		PreloadCache:     btsets.PreloadCache,
+		PrefetchNext:     btsets.PrefetchNext,
 		RetrackersMode:   btsets.RetrackersMode,
 		ThemeColor:       btsets.ThemeColor,
 		BgMusicVolume:    btsets.BgMusicVolume,
+		SeedRatio:        btsets.SeedRatio,
+		SeedTime:         btsets.SeedTime,
+		SeedWhileCached:  btsets.SeedWhileCached,
+		TrackersLists:    btsets.TrackersLists,
+		TrackersListTTL:  btsets.TrackersListTTL,
+		BlocklistURLs:    btsets.BlocklistURLs,
+		BlocklistUpdate:  btsets.BlocklistUpdate,
+		DisableSmartBan:  btsets.DisableSmartBan,
+		SmartBanFailures: btsets.SmartBanFailures,
+		SmartBanPersist:  btsets.SmartBanPersist,
+		ProxyURL:         btsets.ProxyURL,
+		ProxyFetches:     btsets.ProxyFetches,
+		ProxyOnly:        btsets.ProxyOnly,
+		BindInterface:    btsets.BindInterface,
+		KillSwitch:       btsets.KillSwitch,
 	}
 }
 
 // SetSettings updates settings
 func (a *App) SetSettings(s *Settings) error {
 	runtime.LogInfo(a.ctx, "Updating settings")
+	if err := proxy.Check(s.ProxyURL); err != nil {
+		return err
+	}
 
-	btsets := settings.BTsets
-	if btsets == nil {
-		btsets = &settings.BTSets{}
+	// copy, so changes can be compared with current settings
+	btsets := new(settings.BTSets)
+	if settings.BTsets != nil {
+		*btsets = *settings.BTsets
 	}
 
 	btsets.CacheSize = s.CacheSize
@@ -43,11 +67,39 @@ func (a *App) SetSettings(s *Settings) error {
 	btsets.DownloadRateLimit = s.DownloadRate
 	btsets.UploadRateLimit = s.UploadRate
 	btsets.PreloadCache = s.PreloadCache
+	btsets.PrefetchNext = s.PrefetchNext
 	btsets.RetrackersMode = s.RetrackersMode
 	btsets.ThemeColor = s.ThemeColor
 	btsets.BgMusicVolume = s.BgMusicVolume
+	btsets.SeedRatio = s.SeedRatio
+	btsets.SeedTime = s.SeedTime
+	btsets.SeedWhileCached = s.SeedWhileCached
+	// empty values keep current lists
+	if s.TrackersLists != nil {
+		btsets.TrackersLists = s.TrackersLists
+	}
+	if s.TrackersListTTL > 0 {
+		btsets.TrackersListTTL = s.TrackersListTTL
+	}
+	if s.BlocklistURLs != nil {
+		btsets.BlocklistURLs = s.BlocklistURLs
+	}
+	if s.BlocklistUpdate > 0 {
+		btsets.BlocklistUpdate = s.BlocklistUpdate
+	}
+	btsets.DisableSmartBan = s.DisableSmartBan
+	if s.SmartBanFailures > 0 {
+		btsets.SmartBanFailures = s.SmartBanFailures
+	}
+	btsets.SmartBanPersist = s.SmartBanPersist
+	btsets.ProxyURL = s.ProxyURL
+	btsets.ProxyFetches = s.ProxyFetches
+	btsets.ProxyOnly = s.ProxyOnly
+	btsets.BindInterface = strings.TrimSpace(s.BindInterface)
+	btsets.KillSwitch = s.KillSwitch
 
-	settings.SetBTSets(btsets)
+	// rate limits, connections and cache are applied live, network changes reconnect the client
+	torrserv.SetSettings(btsets)
 
 	runtime.LogInfo(a.ctx, "Settings updated")
 	return nil
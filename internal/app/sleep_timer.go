@@ -0,0 +1,216 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"github.com/german2285/TorrPlayer/internal/player"
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+)
+
+const (
+	SleepTimerDuration  = "duration"
+	SleepTimerEndOfFile = "endOfFile"
+	SleepTimerFiles     = "files"
+)
+
+// sleepTimer holds state of the active sleep timer, guarded by App.playMu
+type sleepTimer struct {
+	opts      SleepTimerOptions
+	deadline  time.Time
+	filesLeft int
+	cancel    chan struct{}
+}
+
+func (t *sleepTimer) state() SleepTimerState {
+	st := SleepTimerState{
+		Active:    true,
+		Mode:      t.opts.Mode,
+		FilesLeft: t.filesLeft,
+	}
+	if t.opts.Mode == SleepTimerDuration {
+		st.Remaining = int64(time.Until(t.deadline).Seconds())
+		if st.Remaining < 0 {
+			st.Remaining = 0
+		}
+	}
+	return st
+}
+
+// SetSleepTimer starts a timer that stops playback after a duration, at the end of the current file or after N more files
+func (a *App) SetSleepTimer(opts SleepTimerOptions) error {
+	if a.ctx == nil {
+		return fmt.Errorf("application not initialized yet")
+	}
+
+	switch opts.Mode {
+	case SleepTimerDuration:
+		if opts.Minutes <= 0 {
+			return fmt.Errorf("invalid timer duration: %d", opts.Minutes)
+		}
+	case SleepTimerEndOfFile:
+	case SleepTimerFiles:
+		if opts.Files < 0 {
+			return fmt.Errorf("invalid files count: %d", opts.Files)
+		}
+	default:
+		return fmt.Errorf("unknown timer mode: %s", opts.Mode)
+	}
+	if opts.RateLimit < 0 {
+		opts.RateLimit = 0
+	}
+
+	a.playMu.Lock()
+	if a.timer != nil {
+		close(a.timer.cancel)
+	}
+	t := &sleepTimer{
+		opts:      opts,
+		filesLeft: opts.Files,
+		cancel:    make(chan struct{}),
+	}
+	if opts.Mode == SleepTimerDuration {
+		t.deadline = time.Now().Add(time.Duration(opts.Minutes) * time.Minute)
+		go a.runSleepTimer(t)
+	}
+	a.timer = t
+	st := t.state()
+	a.playMu.Unlock()
+
+	runtime.LogInfo(a.ctx, fmt.Sprintf("Sleep timer set: %s", opts.Mode))
+	runtime.EventsEmit(a.ctx, "sleepTimer:countdown", st)
+	return nil
+}
+
+// CancelSleepTimer cancels the active sleep timer
+func (a *App) CancelSleepTimer() {
+	a.playMu.Lock()
+	cancelled := a.clearSleepTimer()
+	a.playMu.Unlock()
+
+	if cancelled && a.ctx != nil {
+		runtime.LogInfo(a.ctx, "Sleep timer cancelled")
+		runtime.EventsEmit(a.ctx, "sleepTimer:countdown", SleepTimerState{})
+	}
+}
+
+// GetSleepTimer returns state of the sleep timer
+func (a *App) GetSleepTimer() SleepTimerState {
+	a.playMu.Lock()
+	defer a.playMu.Unlock()
+	if a.timer == nil {
+		return SleepTimerState{}
+	}
+	return a.timer.state()
+}
+
+// clearSleepTimer must be called with playMu held
+func (a *App) clearSleepTimer() bool {
+	if a.timer == nil {
+		return false
+	}
+	close(a.timer.cancel)
+	a.timer = nil
+	return true
+}
+
+func (a *App) runSleepTimer(t *sleepTimer) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.cancel:
+			return
+		case <-ticker.C:
+			a.playMu.Lock()
+			if a.timer != t {
+				a.playMu.Unlock()
+				return
+			}
+			st := t.state()
+			a.playMu.Unlock()
+
+			if st.Remaining <= 0 {
+				a.fireSleepTimer(t, true)
+				return
+			}
+			runtime.EventsEmit(a.ctx, "sleepTimer:countdown", st)
+		}
+	}
+}
+
+// fireSleepTimer stops playback, the timer actions run when the player is closed
+func (a *App) fireSleepTimer(t *sleepTimer, stopPlayer bool) {
+	a.playMu.Lock()
+	if a.timer != t {
+		a.playMu.Unlock()
+		return
+	}
+	a.timer = nil
+	playing := a.playing
+	if playing {
+		a.stopRequested = true
+		a.pendingTimer = &t.opts
+	}
+	a.playMu.Unlock()
+
+	runtime.LogInfo(a.ctx, "Sleep timer fired")
+	runtime.EventsEmit(a.ctx, "sleepTimer:countdown", SleepTimerState{Mode: t.opts.Mode, Fired: true})
+
+	if playing {
+		if !stopPlayer {
+			return
+		}
+		if err := player.Stop(); err != nil {
+			runtime.LogWarning(a.ctx, fmt.Sprintf("Sleep timer: %v", err))
+		}
+		return
+	}
+	a.applySleepTimerActions(&t.opts)
+}
+
+// sleepTimerNextFile is called when a file was played to the end and reports whether playback may continue with the next file
+func (a *App) sleepTimerNextFile() bool {
+	a.playMu.Lock()
+	t := a.timer
+	if t == nil {
+		stop := a.stopRequested
+		a.playMu.Unlock()
+		return !stop
+	}
+	switch t.opts.Mode {
+	case SleepTimerEndOfFile:
+		a.playMu.Unlock()
+		a.fireSleepTimer(t, false)
+		return false
+	case SleepTimerFiles:
+		if t.filesLeft <= 0 {
+			a.playMu.Unlock()
+			a.fireSleepTimer(t, false)
+			return false
+		}
+		t.filesLeft--
+	}
+	st := t.state()
+	a.playMu.Unlock()
+
+	runtime.EventsEmit(a.ctx, "sleepTimer:countdown", st)
+	return true
+}
+
+func (a *App) applySleepTimerActions(opts *SleepTimerOptions) {
+	if opts == nil {
+		return
+	}
+	if opts.PauseTorrents {
+		runtime.LogInfo(a.ctx, "Sleep timer: pausing all torrents")
+		torrserv.PauseAllTorrents()
+	}
+	if opts.RateLimit > 0 {
+		runtime.LogInfo(a.ctx, fmt.Sprintf("Sleep timer: lowering rate limits to %d kb", opts.RateLimit))
+		torrserv.SetRateLimits(opts.RateLimit, opts.RateLimit)
+	}
+}
@@ -5,7 +5,9 @@ import (
 
 	"github.com/dustin/go-humanize"
 
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
 	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
 )
 
 // GetTorrentStats returns real-time statistics for a torrent
@@ -19,14 +21,24 @@ func (a *App) GetTorrentStats(hash string) (*TorrentStats, error) {
 	cache := tor.GetCache()
 
 	stats := &TorrentStats{
-		DownSpeed:     st.DownloadSpeed,
-		UpSpeed:       st.UploadSpeed,
-		DownSpeedStr:  humanize.Bytes(uint64(st.DownloadSpeed)) + "/s",
-		UpSpeedStr:    humanize.Bytes(uint64(st.UploadSpeed)) + "/s",
-		Peers:         st.ActivePeers,
-		Seeders:       st.ConnectedSeeders,
-		Downloaded:    st.LoadedSize,
-		DownloadedStr: humanize.Bytes(uint64(st.LoadedSize)),
+		DownSpeed:      st.DownloadSpeed,
+		UpSpeed:        st.UploadSpeed,
+		DownSpeedStr:   humanize.Bytes(uint64(st.DownloadSpeed)) + "/s",
+		UpSpeedStr:     humanize.Bytes(uint64(st.UploadSpeed)) + "/s",
+		Peers:          st.ActivePeers,
+		Seeders:        st.ConnectedSeeders,
+		Downloaded:     st.LoadedSize,
+		DownloadedStr:  humanize.Bytes(uint64(st.LoadedSize)),
+		DownLimit:      st.DownloadLimit,
+		UpLimit:        st.UploadLimit,
+		Priority:       st.Priority,
+		MaxConnections: st.MaxConnections,
+		Uploaded:       st.Uploaded,
+		Seeding:        st.Seeding,
+		SeedTime:       st.SeedSeconds,
+	}
+	if st.Downloaded > 0 {
+		stats.Ratio = float64(st.Uploaded) / float64(st.Downloaded)
 	}
 
 	if cache != nil {
@@ -39,3 +51,32 @@ func (a *App) GetTorrentStats(hash string) (*TorrentStats, error) {
 
 	return stats, nil
 }
+
+// SetTorrentLimits sets download/upload limits of a torrent in kb (0 - only global limits)
+// and its priority: auto, low, normal or high
+func (a *App) SetTorrentLimits(hash string, down, up int, priority string) error {
+	prio, ok := state.ParsePriority(priority)
+	if !ok {
+		return fmt.Errorf("unknown priority: %s", priority)
+	}
+	if down < 0 || up < 0 {
+		return fmt.Errorf("invalid limits: %d/%d", down, up)
+	}
+	return torrserv.SetTorrentLimits(hash, down, up, prio)
+}
+
+// SetTorrentSeedPolicy sets seeding targets of a torrent, nil policy uses global settings
+func (a *App) SetTorrentSeedPolicy(hash string, policy *SeedPolicy) error {
+	var p *settings.SeedPolicy
+	if policy != nil {
+		if policy.Ratio < 0 || policy.Time < 0 {
+			return fmt.Errorf("invalid seed policy")
+		}
+		p = &settings.SeedPolicy{
+			Ratio:       policy.Ratio,
+			Time:        policy.Time,
+			WhileCached: policy.WhileCached,
+		}
+	}
+	return torrserv.SetSeedPolicy(hash, p)
+}
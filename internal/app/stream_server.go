@@ -12,9 +12,13 @@ import (
 
 	"github.com/german2285/TorrPlayer/internal/player"
 	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+	"github.com/german2285/TorrPlayer/pkg/server/utils"
 )
 
-// PlayTorrentFile plays a specific file from a torrent
+// bufferMaxWait starts playback when buffering takes too long, e.g. torrent has no peers
+const bufferMaxWait = 2 * time.Minute
+
+// PlayTorrentFile plays a specific file from a torrent, files played to the end are followed by the next one
 func (a *App) PlayTorrentFile(hash string, fileIndex int) error {
 	runtime.LogInfo(a.ctx, fmt.Sprintf("Playing torrent %s file %d", hash, fileIndex))
 
@@ -28,36 +32,56 @@ func (a *App) PlayTorrentFile(hash string, fileIndex int) error {
 		return fmt.Errorf("invalid file index")
 	}
 
-	// Start stream server
-	port, err := a.startStreamServer(tor, fileIndex)
-	if err != nil {
-		return fmt.Errorf("failed to start stream server: %v", err)
+	a.playMu.Lock()
+	if a.playing {
+		a.playMu.Unlock()
+		return fmt.Errorf("playback already running")
 	}
-	a.streamPort = port
-
-	streamURL := fmt.Sprintf("http://127.0.0.1:%s/stream", port)
-
-	// Wait for buffer
-	runtime.LogInfo(a.ctx, "Buffering...")
-	a.waitForBuffer(tor, 5*time.Second)
+	a.playing = true
+	a.stopRequested = false
+	a.pendingTimer = nil
+	a.playMu.Unlock()
 
 	// Notify frontend to pause background music and cleanup resources
 	runtime.EventsEmit(a.ctx, "video:playbackStarting")
 	time.Sleep(200 * time.Millisecond) // Give frontend time to cleanup
 
-	// Hide window completely to free WebView2 resources
-	runtime.WindowHide(a.ctx)
-	runtime.LogInfo(a.ctx, "Starting playback...")
+	var err error
+	for {
+		var reason player.EndReason
+		reason, err = a.playFile(tor, fileIndex)
+		if err != nil {
+			break
+		}
+		if reason == player.EndReasonQuit {
+			// manual stop clears the sleep timer
+			a.CancelSleepTimer()
+			break
+		}
+		if reason != player.EndReasonEOF {
+			break
+		}
+		next := nextPlayableFile(tor, fileIndex)
+		if next == 0 || !a.sleepTimerNextFile() {
+			break
+		}
+		runtime.LogInfo(a.ctx, fmt.Sprintf("Switching to next file %d", next))
+		runtime.EventsEmit(a.ctx, "video:nextFile", next)
+		fileIndex = next
+	}
 
-	err = player.PlayVideoWithMPV(streamURL)
+	a.playMu.Lock()
+	a.playing = false
+	pending := a.pendingTimer
+	a.pendingTimer = nil
+	a.playMu.Unlock()
 
 	// Show window and reload it to completely free WebView2 memory
 	runtime.WindowShow(a.ctx)
 	runtime.LogInfo(a.ctx, "Reloading UI to free memory...")
 	runtime.WindowReload(a.ctx) // This completely reloads WebView2 and frees all memory!
 
-	// Stop stream server
-	a.stopStreamServer()
+	a.applySleepTimerActions(pending)
 
 	if err != nil {
 		runtime.LogError(a.ctx, fmt.Sprintf("Playback error: %v", err))
@@ -68,11 +92,53 @@ func (a *App) PlayTorrentFile(hash string, fileIndex int) error {
 	return nil
 }
 
+// playFile streams one file of the torrent to the player and waits until playback ends
+func (a *App) playFile(tor *torrserv.Torrent, fileIndex int) (player.EndReason, error) {
+	// Start stream server
+	port, err := a.startStreamServer(tor, fileIndex)
+	if err != nil {
+		return player.EndReasonError, fmt.Errorf("failed to start stream server: %v", err)
+	}
+	a.streamPort = port
+	// Stop stream server
+	defer a.stopStreamServer()
+
+	streamURL := fmt.Sprintf("http://127.0.0.1:%s/stream", port)
+
+	// Wait for buffer, window shows buffer:progress till playback starts.
+	// It is hidden while the previous file plays, PlayTorrentFile shows it again on every return
+	runtime.WindowShow(a.ctx)
+	runtime.LogInfo(a.ctx, "Buffering...")
+	a.waitForBuffer(tor, fileIndex)
+
+	// Hide window completely to free WebView2 resources
+	runtime.WindowHide(a.ctx)
+
+	runtime.LogInfo(a.ctx, "Starting playback...")
+	return player.PlayVideoWithMPV(streamURL)
+}
+
+// nextPlayableFile returns index of the next media file after fileIndex or 0 if there is none
+func nextPlayableFile(tor *torrserv.Torrent, fileIndex int) int {
+	for _, f := range tor.Status().FileStats {
+		if f.Id > fileIndex && utils.GetMimeType(f.Path) != "*/*" {
+			return f.Id
+		}
+	}
+	return 0
+}
+
 // startStreamServer starts a local HTTP server for streaming
 func (a *App) startStreamServer(tor *torrserv.Torrent, fileIndex int) (string, error) {
 	// Create HTTP handler
 	mux := http.NewServeMux()
+	hash := tor.Hash().HexString()
 	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		// torrent is looked up on every request, it is recreated when the client reconnects
+		if cur := torrserv.GetTorrent(hash); cur != nil {
+			cur.Stream(fileIndex, r, w)
+			return
+		}
 		tor.Stream(fileIndex, r, w)
 	})
 
@@ -126,27 +192,37 @@ func (a *App) stopStreamServer() {
 	}
 }
 
-// waitForBuffer waits for minimum cache to be filled before playback
-func (a *App) waitForBuffer(tor *torrserv.Torrent, maxWait time.Duration) {
-	start := time.Now()
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	minCache := int64(32 << 20) // 32 MB minimum
-
-	for {
-		if time.Since(start) > maxWait {
-			return
-		}
+// waitForBuffer loads the beginning of file till it plays without stalling at current download speed,
+// StartPlaybackNow or bufferMaxWait stops waiting
+func (a *App) waitForBuffer(tor *torrserv.Torrent, fileIndex int) {
+	ctx, cancel := context.WithTimeout(a.ctx, bufferMaxWait)
+	a.playMu.Lock()
+	a.skipBuffer = cancel
+	a.playMu.Unlock()
+	defer func() {
+		a.playMu.Lock()
+		a.skipBuffer = nil
+		a.playMu.Unlock()
+		cancel()
+	}()
 
-		cache := tor.GetCache()
-		if cache != nil {
-			state := cache.GetState()
-			if state.Filled >= minCache {
-				return
-			}
-		}
+	err := tor.Buffer(ctx, fileIndex, 0)
+	switch {
+	case err == nil:
+	case ctx.Err() == context.DeadlineExceeded:
+		runtime.LogInfo(a.ctx, "Buffering timed out")
+	case ctx.Err() != nil:
+		runtime.LogInfo(a.ctx, "Buffering skipped")
+	default:
+		runtime.LogError(a.ctx, fmt.Sprintf("Buffering error: %v", err))
+	}
+}
 
-		<-ticker.C
+// StartPlaybackNow starts playback without waiting for the buffer
+func (a *App) StartPlaybackNow() {
+	a.playMu.Lock()
+	defer a.playMu.Unlock()
+	if a.skipBuffer != nil {
+		a.skipBuffer()
 	}
 }
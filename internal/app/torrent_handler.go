@@ -4,7 +4,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
-	"sort"
 	"strings"
 	"time"
 
@@ -14,7 +13,6 @@ import (
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 
 	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
-	"github.com/german2285/TorrPlayer/pkg/server/utils"
 )
 
 // AddTorrent adds a torrent by magnet link, .torrent file path, or hash
@@ -27,7 +25,7 @@ func (a *App) AddTorrent(input string) (*Torrent, error) {
 	runtime.LogInfo(a.ctx, fmt.Sprintf("Adding torrent: %s", input))
 
 	// Parse input
-	spec, err := a.parseTorrentInput(input)
+	spec, mag, mi, err := a.parseTorrentInput(input)
 	if err != nil {
 		runtime.LogError(a.ctx, fmt.Sprintf("Failed to parse input: %v", err))
 		return nil, err
@@ -42,30 +40,30 @@ func (a *App) AddTorrent(input string) (*Torrent, error) {
 
 	hashStr := tor.Hash().HexString()
 	runtime.LogInfo(a.ctx, fmt.Sprintf("Torrent added to client: %s", hashStr))
+	if webSeeds := torrserv.WebSeedsFromMagnet(mag); len(webSeeds) > 0 {
+		if err := tor.AddWebSeeds(webSeeds); err != nil {
+			runtime.LogError(a.ctx, fmt.Sprintf("Failed to add web seeds: %v", err))
+		}
+	}
+	// BEP 53, other files are unwanted when metadata is received
+	tor.SetSelectOnly(torrserv.SelectOnlyFromMagnet(mag))
+	// creation date and comment of .torrent are exported with it
+	tor.SetOrigin(mi)
 
 	// Save to DB immediately with minimal info
 	torrserv.SaveTorrentToDB(tor)
 	runtime.LogInfo(a.ctx, fmt.Sprintf("Torrent saved to database: %s", hashStr))
 
-	// Start background goroutine to wait for metadata
+	// Start background goroutine to wait for metadata, the frontend is notified by torrent:metadata event
 	go func() {
-		timeout := time.After(60 * time.Second)
-		ticker := time.NewTicker(500 * time.Millisecond)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-timeout:
-				runtime.LogInfo(a.ctx, fmt.Sprintf("Timeout waiting for metadata for: %s", hashStr))
-				return
-			case <-ticker.C:
-				if tor.GotInfo() {
-					runtime.LogInfo(a.ctx, fmt.Sprintf("Metadata received for: %s - %s", hashStr, tor.Name()))
-					// Update DB with full info
-					torrserv.SaveTorrentToDB(tor)
-					return
-				}
-			}
+		if tor.GotInfo() {
+			runtime.LogInfo(a.ctx, fmt.Sprintf("Metadata received for: %s - %s", hashStr, tor.Name()))
+			// Update DB with full info
+			torrserv.SaveTorrentToDB(tor)
+		} else if p := torrserv.MetadataProgress(hashStr); p != nil && p.Error != "" {
+			runtime.LogInfo(a.ctx, fmt.Sprintf("Failed to get metadata for: %s - %s", hashStr, p.Error))
+		} else {
+			runtime.LogInfo(a.ctx, fmt.Sprintf("Failed to get metadata for: %s", hashStr))
 		}
 	}()
 
@@ -155,6 +153,20 @@ func (a *App) GetTorrents() []Torrent {
 			UpSpeedStr:   "",
 			LoadingMeta:  false,
 		}
+		if p := torrserv.MetadataProgress(hashStr); p != nil {
+			if p.Error != "" {
+				result.Status = "failed"
+				result.MetaError = p.Error
+			} else if !p.Done {
+				result.Status = "loading"
+				result.LoadingMeta = true
+			}
+		}
+		result.QueueState, result.QueuePos = torrserv.QueueState(hashStr)
+		if h := torrserv.GetHealth(hashStr); h != nil {
+			result.Health = h.Badge
+			result.HealthSeeds = h.Seeders
+		}
 
 		torrents = append(torrents, result)
 	}
@@ -174,26 +186,31 @@ func (a *App) GetTorrentFiles(hash string) ([]TorrentFile, error) {
 		return nil, fmt.Errorf("torrent not found")
 	}
 
-	files := tor.Files()
+	// Files are sorted by path, saved metainfo is used while torrent has no info
+	files := torrserv.GetTorrentFiles(hash)
 	result := make([]TorrentFile, 0, len(files))
 
-	// Sort files by path
-	sort.Slice(files, func(i, j int) bool {
-		return utils.CompareStrings(files[i].Path(), files[j].Path())
-	})
-
-	for i, f := range files {
+	for _, f := range files {
 		result = append(result, TorrentFile{
-			Index:   i + 1,
-			Path:    f.Path(),
-			Size:    f.Length(),
-			SizeStr: humanize.Bytes(uint64(f.Length())),
+			Index:   f.Id,
+			Path:    f.Path,
+			Size:    f.Length,
+			SizeStr: humanize.Bytes(uint64(f.Length)),
+			Wanted:  !f.Unwanted,
 		})
 	}
 
 	return result, nil
 }
 
+// SetFileWanted selects files of torrent for download by indexes, empty indexes - all files
+func (a *App) SetFileWanted(hash string, indexes []int) error {
+	if a.ctx == nil {
+		return fmt.Errorf("application not initialized yet")
+	}
+	return torrserv.SetFileWanted(hash, indexes)
+}
+
 // RemoveTorrent removes a torrent
 func (a *App) RemoveTorrent(hash string) error {
 	// Check if context is initialized
@@ -206,8 +223,10 @@ func (a *App) RemoveTorrent(hash string) error {
 	return nil
 }
 
-// parseTorrentInput parses magnet link, .torrent file path, or hash
-func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
+// parseTorrentInput parses magnet link, .torrent file path, or hash,
+// magnet of input keeps web seeds (ws or url-list of .torrent) and select-only files (so),
+// metainfo is returned for .torrent only
+func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, metainfo.Magnet, *metainfo.MetaInfo, error) {
 	// Check if it's a base64 encoded file (from drag & drop)
 	if strings.HasPrefix(input, "data:") {
 		// Parse data URL: data:application/x-bittorrent;base64,<content>
@@ -215,13 +234,13 @@ func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
 		if len(parts) == 2 {
 			decoded, err := base64.StdEncoding.DecodeString(parts[1])
 			if err != nil {
-				return nil, fmt.Errorf("failed to decode base64: %v", err)
+				return nil, metainfo.Magnet{}, nil, fmt.Errorf("failed to decode base64: %v", err)
 			}
 
 			// Create temporary file
 			tmpFile, err := os.CreateTemp("", "torrent-*.torrent")
 			if err != nil {
-				return nil, fmt.Errorf("failed to create temp file: %v", err)
+				return nil, metainfo.Magnet{}, nil, fmt.Errorf("failed to create temp file: %v", err)
 			}
 			tmpFileName := tmpFile.Name()
 
@@ -229,7 +248,7 @@ func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
 			if _, err := tmpFile.Write(decoded); err != nil {
 				tmpFile.Close()
 				os.Remove(tmpFileName)
-				return nil, fmt.Errorf("failed to write temp file: %v", err)
+				return nil, metainfo.Magnet{}, nil, fmt.Errorf("failed to write temp file: %v", err)
 			}
 			tmpFile.Close()
 
@@ -238,12 +257,12 @@ func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
 
 			minfo, err := metainfo.LoadFromFile(tmpFileName)
 			if err != nil {
-				return nil, fmt.Errorf("failed to load torrent file: %v", err)
+				return nil, metainfo.Magnet{}, nil, fmt.Errorf("failed to load torrent file: %v", err)
 			}
 
 			info, err := minfo.UnmarshalInfo()
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse torrent info: %v", err)
+				return nil, metainfo.Magnet{}, nil, fmt.Errorf("failed to parse torrent info: %v", err)
 			}
 
 			mag := minfo.Magnet(nil, &info)
@@ -252,7 +271,7 @@ func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
 				Trackers:    [][]string{mag.Trackers},
 				DisplayName: info.Name,
 				InfoHash:    minfo.HashInfoBytes(),
-			}, nil
+			}, mag, minfo, nil
 		}
 	}
 
@@ -260,7 +279,7 @@ func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
 	if len(input) > 8 && input[:8] == "magnet:?" {
 		mag, err := metainfo.ParseMagnetUri(input)
 		if err != nil {
-			return nil, fmt.Errorf("invalid magnet link: %v", err)
+			return nil, metainfo.Magnet{}, nil, fmt.Errorf("invalid magnet link: %v", err)
 		}
 		var trackers [][]string
 		if len(mag.Trackers) > 0 {
@@ -270,19 +289,19 @@ func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
 			InfoHash:    mag.InfoHash,
 			Trackers:    trackers,
 			DisplayName: mag.DisplayName,
-		}, nil
+		}, mag, nil, nil
 	}
 
 	// Check if it's a file path
 	if _, err := os.Stat(input); err == nil {
 		minfo, err := metainfo.LoadFromFile(input)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load torrent file: %v", err)
+			return nil, metainfo.Magnet{}, nil, fmt.Errorf("failed to load torrent file: %v", err)
 		}
 
 		info, err := minfo.UnmarshalInfo()
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse torrent info: %v", err)
+			return nil, metainfo.Magnet{}, nil, fmt.Errorf("failed to parse torrent info: %v", err)
 		}
 
 		mag := minfo.Magnet(nil, &info)
@@ -291,7 +310,7 @@ func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
 			Trackers:    [][]string{mag.Trackers},
 			DisplayName: info.Name,
 			InfoHash:    minfo.HashInfoBytes(),
-		}, nil
+		}, mag, minfo, nil
 	}
 
 	// Try as hash
@@ -300,9 +319,9 @@ func (a *App) parseTorrentInput(input string) (*torrent.TorrentSpec, error) {
 		if err := hash.FromHexString(input); err == nil {
 			return &torrent.TorrentSpec{
 				InfoHash: hash,
-			}, nil
+			}, metainfo.Magnet{}, nil, nil
 		}
 	}
 
-	return nil, fmt.Errorf("invalid input: must be magnet link, torrent file path, or hash")
+	return nil, metainfo.Magnet{}, nil, fmt.Errorf("invalid input: must be magnet link, torrent file path, or hash")
 }
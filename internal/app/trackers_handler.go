@@ -0,0 +1,113 @@
+package app
+
+import (
+	"fmt"
+
+	torrserv "github.com/german2285/TorrPlayer/pkg/server/torr"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/health"
+)
+
+// GetTorrentTrackers returns trackers of a torrent with last announce status
+func (a *App) GetTorrentTrackers(hash string) ([]TrackerInfo, error) {
+	list, err := torrserv.GetTrackers(hash)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]TrackerInfo, 0, len(list))
+	for _, tr := range list {
+		ret = append(ret, TrackerInfo{
+			URL:          tr.URL,
+			Tier:         tr.Tier,
+			Source:       tr.Source,
+			LastAnnounce: tr.LastAnnounce,
+			NextAnnounce: tr.NextAnnounce,
+			Peers:        tr.Peers,
+			Seeders:      tr.Seeders,
+			Leechers:     tr.Leechers,
+			Error:        tr.Error,
+			Updating:     tr.Updating,
+		})
+	}
+	return ret, nil
+}
+
+// AddTorrentTracker adds a tracker to a torrent, the change is saved in DB
+func (a *App) AddTorrentTracker(hash, url string) error {
+	return torrserv.AddTracker(hash, url)
+}
+
+// RemoveTorrentTracker removes a tracker of a torrent, the change is saved in DB
+func (a *App) RemoveTorrentTracker(hash, url string) error {
+	return torrserv.RemoveTracker(hash, url)
+}
+
+// ReannounceTorrent announces a torrent to a tracker at once, empty url - to all trackers
+func (a *App) ReannounceTorrent(hash, url string) error {
+	return torrserv.Reannounce(hash, url)
+}
+
+// SetTorrentRetrackersMode overrides retrackers mode for a torrent, negative mode - use global setting
+func (a *App) SetTorrentRetrackersMode(hash string, mode int) error {
+	if mode > 3 {
+		return fmt.Errorf("invalid retrackers mode: %d", mode)
+	}
+	if mode < 0 {
+		return torrserv.SetRetrackersMode(hash, nil)
+	}
+	return torrserv.SetRetrackersMode(hash, &mode)
+}
+
+// RefreshTrackerLists downloads lists of retrackers again, running torrents get changed trackers
+func (a *App) RefreshTrackerLists() error {
+	return torrserv.RefreshDefTrackers()
+}
+
+// CheckTrackers checks which retrackers and trackers from trackers.txt are reachable
+func (a *App) CheckTrackers() ([]TrackerReachability, error) {
+	if a.ctx == nil {
+		return nil, fmt.Errorf("application not initialized yet")
+	}
+	return toTrackerReachability(torrserv.CheckDefTrackers(a.ctx)), nil
+}
+
+// GetTrackersReport returns result of the last CheckTrackers
+func (a *App) GetTrackersReport() []TrackerReachability {
+	return toTrackerReachability(torrserv.TrackersReport())
+}
+
+func toTrackerReachability(report []*health.Reachability) []TrackerReachability {
+	ret := make([]TrackerReachability, 0, len(report))
+	for _, r := range report {
+		ret = append(ret, TrackerReachability(*r))
+	}
+	return ret
+}
+
+// GetWebSeeds returns http sources of a torrent with fetch state
+func (a *App) GetWebSeeds(hash string) ([]WebSeed, error) {
+	list, err := torrserv.GetWebSeeds(hash)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]WebSeed, 0, len(list))
+	for _, ws := range list {
+		ret = append(ret, WebSeed{
+			URL:        ws.URL,
+			Downloaded: ws.Downloaded,
+			Active:     ws.Active,
+			Error:      ws.Error,
+			RetryAt:    ws.RetryAt,
+		})
+	}
+	return ret, nil
+}
+
+// AddWebSeed adds http mirror of torrent files, pieces are fetched from it when peers are scarce
+func (a *App) AddWebSeed(hash, url string) error {
+	return torrserv.AddWebSeeds(hash, []string{url})
+}
+
+// RemoveWebSeed removes http source of a torrent, the change is saved in DB
+func (a *App) RemoveWebSeed(hash, url string) error {
+	return torrserv.RemoveWebSeed(hash, url)
+}
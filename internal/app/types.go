@@ -20,6 +20,26 @@ type Torrent struct {
 	Poster       string  `json:"poster"`
 	Timestamp    int64   `json:"timestamp"`
 	LoadingMeta  bool    `json:"loadingMeta"`  // Флаг загрузки метаданных
+	QueueState   string  `json:"queueState"`   // active, metadata, preload, queued, parked or empty
+	QueuePos     int     `json:"queuePos"`     // position in queue, 0 - not queued
+	Health       string  `json:"health"`       // health badge, empty if not probed yet
+	HealthSeeds  int     `json:"healthSeeds"`  // seeders reported by trackers
+	MetaError    string  `json:"metaError"`    // reason of failed metadata fetch
+}
+
+// MetadataProgress represents progress of magnet metadata fetch
+type MetadataProgress struct {
+	Hash          string `json:"hash"`
+	Attempt       int    `json:"attempt"`
+	Attempts      int    `json:"attempts"`
+	Peers         int    `json:"peers"`
+	ActivePeers   int    `json:"activePeers"`
+	ExtendedPeers int    `json:"extendedPeers"` // connected peers with extension protocol, only they may send metadata
+	Size          int64  `json:"size"`          // 0 - unknown yet
+	Received      int64  `json:"received"`
+	Started       int64  `json:"started"`
+	Done          bool   `json:"done"`
+	Error         string `json:"error,omitempty"`
 }
 
 // TorrentFile represents a file inside a torrent
@@ -28,6 +48,7 @@ type TorrentFile struct {
 	Path    string `json:"path"`
 	Size    int64  `json:"size"`
 	SizeStr string `json:"sizeStr"`
+	Wanted  bool   `json:"wanted"`
 }
 
 // TorrentStats represents real-time statistics
@@ -44,17 +65,210 @@ type TorrentStats struct {
 	CacheCapacity    int64   `json:"cacheCapacity"`
 	CacheFilledStr   string  `json:"cacheFilledStr"`
 	CacheCapacityStr string  `json:"cacheCapacityStr"`
+	DownLimit        int     `json:"downLimit"` // effective, in kb, 0 - unlimited
+	UpLimit          int     `json:"upLimit"`   // effective, in kb, 0 - unlimited
+	Priority         string  `json:"priority"`  // effective
+	MaxConnections   int     `json:"maxConnections"`
+	Uploaded         int64   `json:"uploaded"` // all sessions
+	Ratio            float64 `json:"ratio"`
+	Seeding          bool    `json:"seeding"`
+	SeedTime         int64   `json:"seedTime"` // in seconds
+}
+
+// KeepStatus represents progress of full download of a torrent
+type KeepStatus struct {
+	Path      string   `json:"path"`
+	Files     []string `json:"files"`
+	Paused    bool     `json:"paused"`
+	Seed      bool     `json:"seed"`
+	Completed int64    `json:"completed"`
+	Total     int64    `json:"total"`
+	Progress  float64  `json:"progress"`
+	Done      bool     `json:"done"`
+}
+
+// TrackerHealth represents scrape result of one tracker
+type TrackerHealth struct {
+	URL       string `json:"url"`
+	Seeders   int    `json:"seeders"`
+	Leechers  int    `json:"leechers"`
+	Completed int    `json:"completed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TorrentHealth represents swarm health of a torrent
+type TorrentHealth struct {
+	Hash      string          `json:"hash"`
+	Badge     string          `json:"badge"` // good, weak, dead or unknown
+	Seeders   int             `json:"seeders"`
+	Leechers  int             `json:"leechers"`
+	Completed int             `json:"completed"`
+	DHTPeers  int             `json:"dhtPeers"`
+	Trackers  []TrackerHealth `json:"trackers"`
+	Checked   int64           `json:"checked"`
+}
+
+// TrackerInfo represents a tracker of a torrent with last announce result
+type TrackerInfo struct {
+	URL          string `json:"url"`
+	Tier         int    `json:"tier"`
+	Source       string `json:"source"`       // torrent, retracker or file
+	LastAnnounce int64  `json:"lastAnnounce"` // unix time, 0 - never
+	NextAnnounce int64  `json:"nextAnnounce"`
+	Peers        int    `json:"peers"`
+	Seeders      int    `json:"seeders"`
+	Leechers     int    `json:"leechers"`
+	Error        string `json:"error,omitempty"`
+	Updating     bool   `json:"updating"`
+}
+
+// TrackerReachability represents result of a tracker check
+type TrackerReachability struct {
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Latency   int64  `json:"latency"` // in ms
+	Error     string `json:"error,omitempty"`
+}
+
+// PeerInfo represents a connected peer of a torrent
+type PeerInfo struct {
+	Addr           string  `json:"addr"`
+	Client         string  `json:"client"`
+	PeerID         string  `json:"peerId"`
+	Network        string  `json:"network"` // tcp or utp
+	Encrypted      bool    `json:"encrypted"`
+	Source         string  `json:"source"` // tracker, dht, pex, incoming or manual
+	DownSpeed      float64 `json:"downSpeed"`
+	UpSpeed        float64 `json:"upSpeed"`
+	Pieces         int     `json:"pieces"`
+	TotalPieces    int     `json:"totalPieces"`
+	Progress       float64 `json:"progress"`
+	AmInterested   bool    `json:"amInterested"`
+	AmChoking      bool    `json:"amChoking"`
+	PeerInterested bool    `json:"peerInterested"`
+	PeerChoking    bool    `json:"peerChoking"`
+	Connected      int64   `json:"connected"` // in seconds
+}
+
+// BlocklistSource represents ranges loaded from one blocklist
+type BlocklistSource struct {
+	URL     string `json:"url"` // "blocklist" for the local file
+	Ranges  int    `json:"ranges"`
+	Updated int64  `json:"updated"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BlocklistStatus represents loaded blocklists and rejected peers
+type BlocklistStatus struct {
+	Ranges   int               `json:"ranges"`
+	Banned   int               `json:"banned"`
+	Rejected int64             `json:"rejected"`
+	Loaded   int64             `json:"loaded"`
+	Updating bool              `json:"updating"`
+	Sources  []BlocklistSource `json:"sources"`
+}
+
+// NetInterface represents network interface status
+type NetInterface struct {
+	Name       string   `json:"name"`
+	Found      bool     `json:"found"`
+	Up         bool     `json:"up"`
+	Addrs      []string `json:"addrs"`
+	KillSwitch bool     `json:"killSwitch"`
+	Paused     bool     `json:"paused"` // torrents and streams are paused by kill switch
+	Checked    int64    `json:"checked"`
 }
 
 // Settings represents app settings
 type Settings struct {
-	CacheSize        int64  `json:"cacheSize"`
-	CacheSizeStr     string `json:"cacheSizeStr"`
-	ConnectionsLimit int    `json:"connectionsLimit"`
-	DownloadRate     int    `json:"downloadRate"`
-	UploadRate       int    `json:"uploadRate"`
-	PreloadCache     int    `json:"preloadCache"`
-	RetrackersMode   int    `json:"retrackersMode"`
-	ThemeColor       string `json:"themeColor"`
-	BgMusicVolume    int    `json:"bgMusicVolume"`
+	CacheSize        int64    `json:"cacheSize"`
+	CacheSizeStr     string   `json:"cacheSizeStr"`
+	ConnectionsLimit int      `json:"connectionsLimit"`
+	DownloadRate     int      `json:"downloadRate"`
+	UploadRate       int      `json:"uploadRate"`
+	PreloadCache     int      `json:"preloadCache"`
+	PrefetchNext     int      `json:"prefetchNext"` // in percent of played file, 0 - don't prefetch the next file
+	RetrackersMode   int      `json:"retrackersMode"`
+	ThemeColor       string   `json:"themeColor"`
+	BgMusicVolume    int      `json:"bgMusicVolume"`
+	SeedRatio        float64  `json:"seedRatio"` // 0 - off
+	SeedTime         int      `json:"seedTime"`  // in minutes, 0 - off
+	SeedWhileCached  bool     `json:"seedWhileCached"`
+	TrackersLists    []string `json:"trackersLists"`   // urls of retrackers lists
+	TrackersListTTL  int      `json:"trackersListTtl"` // in hours
+	BlocklistURLs    []string `json:"blocklistUrls"`   // P2P, eMule DAT or CIDR lists, may be gzip or zip
+	BlocklistUpdate  int      `json:"blocklistUpdate"` // in hours
+	DisableSmartBan  bool     `json:"disableSmartBan"`
+	SmartBanFailures int      `json:"smartBanFailures"` // corrupt pieces before ban
+	SmartBanPersist  bool     `json:"smartBanPersist"`  // keep bans after restart
+	ProxyURL         string   `json:"proxyUrl"`         // socks5://[user:pass@]host:port or http://[user:pass@]host:port
+	ProxyFetches     bool     `json:"proxyFetches"`     // http requests of torrents and lists through proxy
+	ProxyOnly        bool     `json:"proxyOnly"`        // refuse direct connections
+	BindInterface    string   `json:"bindInterface"`    // interface name or address, empty - all
+	KillSwitch       bool     `json:"killSwitch"`       // pause torrents while the interface is down
+}
+
+// SeedPolicy represents seeding targets of a torrent, seeding stops when the first one is reached
+type SeedPolicy struct {
+	Ratio       float64 `json:"ratio"` // 0 - off
+	Time        int     `json:"time"`  // in minutes, 0 - off
+	WhileCached bool    `json:"whileCached"`
+}
+
+// SleepTimerOptions describes when playback should be stopped
+type SleepTimerOptions struct {
+	Mode          string `json:"mode"`          // "duration", "endOfFile" or "files"
+	Minutes       int    `json:"minutes"`       // for "duration" mode
+	Files         int    `json:"files"`         // for "files" mode: how many more files to play after the current one
+	PauseTorrents bool   `json:"pauseTorrents"` // drop all active torrents when the timer fires
+	RateLimit     int    `json:"rateLimit"`     // in kb, lower download/upload rate to this value when the timer fires, 0 - don't change
+}
+
+// SleepTimerState represents sleep timer countdown
+type SleepTimerState struct {
+	Active    bool   `json:"active"`
+	Mode      string `json:"mode"`
+	Remaining int64  `json:"remaining"` // seconds left in "duration" mode
+	FilesLeft int    `json:"filesLeft"` // files left in "files" mode
+	Fired     bool   `json:"fired"`
+}
+
+// CreateTorrentOptions describes a torrent created from local files
+type CreateTorrentOptions struct {
+	Path        string   `json:"path"`     // file or directory
+	Output      string   `json:"output"`   // .torrent file, empty - ask user
+	Trackers    []string `json:"trackers"` // every tracker gets own tier
+	WebSeeds    []string `json:"webSeeds"` // http mirrors of files, BEP 19
+	Private     bool     `json:"private"`  // peers only from trackers
+	Comment     string   `json:"comment"`
+	PieceLength int64    `json:"pieceLength"` // 0 - chosen by size
+	Seed        bool     `json:"seed"`        // add into library and seed from source files
+	Title       string   `json:"title"`
+	Category    string   `json:"category"`
+}
+
+// CreateProgress represents progress of torrent creation
+type CreateProgress struct {
+	Path        string  `json:"path"`
+	Output      string  `json:"output"`
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	Files       int     `json:"files"`
+	PieceLength int64   `json:"pieceLength"`
+	Pieces      int     `json:"pieces"`
+	Hashed      int64   `json:"hashed"`
+	Total       int64   `json:"total"`
+	Progress    float64 `json:"progress"`
+	Done        bool    `json:"done"`
+	Seeding     bool    `json:"seeding"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// WebSeed represents http source of a torrent, BEP 19
+type WebSeed struct {
+	URL        string `json:"url"`
+	Downloaded int64  `json:"downloaded"` // bytes of verified pieces
+	Active     int    `json:"active"`     // pieces fetched now
+	Error      string `json:"error"`
+	RetryAt    int64  `json:"retryAt"` // unix time, 0 - source is used
 }
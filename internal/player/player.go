@@ -10,16 +10,50 @@ package player
 import "C"
 import (
 	"fmt"
+	"sync"
 	"unsafe"
 )
 
-func PlayVideoWithMPV(streamURL string) error {
+var (
+	current *C.mpv_handle
+	stopped bool
+	mu      sync.Mutex
+)
+
+// Stop asks the running player to quit, PlayVideoWithMPV then returns EndReasonStopped
+func Stop() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return fmt.Errorf("player is not running")
+	}
+	stopped = true
+
+	cQuit := C.CString("quit")
+	defer C.free(unsafe.Pointer(cQuit))
+	cmd := []*C.char{cQuit, nil}
+	if ret := C.mpv_command(current, &cmd[0]); ret != 0 {
+		return fmt.Errorf("failed to stop player (error code: %d)", int(ret))
+	}
+	return nil
+}
+
+func PlayVideoWithMPV(streamURL string) (EndReason, error) {
 	// Create MPV instance
 	mpv := C.mpv_create()
 	if mpv == nil {
-		return fmt.Errorf("failed to create MPV instance")
+		return EndReasonError, fmt.Errorf("failed to create MPV instance")
 	}
-	defer C.mpv_terminate_destroy(mpv)
+	mu.Lock()
+	current = mpv
+	stopped = false
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		current = nil
+		mu.Unlock()
+		C.mpv_terminate_destroy(mpv)
+	}()
 
 	// Helper function to set options
 	setOption := func(name, value string) error {
@@ -37,39 +71,39 @@ func PlayVideoWithMPV(streamURL string) error {
 
 	// Configure MPV player
 	if err := setOption("vo", "gpu"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 	if err := setOption("keepaspect", "yes"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 	if err := setOption("keepaspect-window", "no"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 	if err := setOption("osc", "yes"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 	if err := setOption("input-default-bindings", "yes"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 	if err := setOption("input-vo-keyboard", "yes"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 
 	// Cache settings for streaming
 	if err := setOption("cache", "yes"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 	if err := setOption("demuxer-max-bytes", "512M"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 	if err := setOption("demuxer-max-back-bytes", "256M"); err != nil {
-		return err
+		return EndReasonError, err
 	}
 
 	// Initialize MPV
 	ret := C.mpv_initialize(mpv)
 	if ret != 0 {
-		return fmt.Errorf("failed to initialize MPV (error code: %d)", int(ret))
+		return EndReasonError, fmt.Errorf("failed to initialize MPV (error code: %d)", int(ret))
 	}
 
 	// Load stream URL
@@ -86,10 +120,11 @@ func PlayVideoWithMPV(streamURL string) error {
 
 	ret = C.mpv_command(mpv, &cmd[0])
 	if ret != 0 {
-		return fmt.Errorf("failed to load stream (error code: %d)", int(ret))
+		return EndReasonError, fmt.Errorf("failed to load stream (error code: %d)", int(ret))
 	}
 
 	// Event loop - wait for playback to finish
+	reason := EndReasonQuit
 	for {
 		event := C.mpv_wait_event(mpv, -1) // Wait indefinitely
 		if event == nil {
@@ -102,9 +137,24 @@ func PlayVideoWithMPV(streamURL string) error {
 			break
 		}
 		if eventID == C.MPV_EVENT_END_FILE {
+			if event.data != nil {
+				ef := (*C.mpv_event_end_file)(event.data)
+				switch ef.reason {
+				case C.MPV_END_FILE_REASON_EOF:
+					reason = EndReasonEOF
+				case C.MPV_END_FILE_REASON_ERROR:
+					reason = EndReasonError
+				}
+			}
 			break
 		}
 	}
 
-	return nil
+	mu.Lock()
+	if stopped {
+		reason = EndReasonStopped
+	}
+	mu.Unlock()
+
+	return reason, nil
 }
@@ -4,6 +4,11 @@ package player
 
 import "fmt"
 
-func PlayVideoWithMPV(streamURL string) error {
+// Stop is a no-op outside of Windows
+func Stop() error {
 	return fmt.Errorf("MPV playback is only supported on Windows")
 }
+
+func PlayVideoWithMPV(streamURL string) (EndReason, error) {
+	return EndReasonError, fmt.Errorf("MPV playback is only supported on Windows")
+}
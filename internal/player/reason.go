@@ -0,0 +1,30 @@
+package player
+
+// EndReason tells why playback of a stream finished
+type EndReason int
+
+const (
+	// EndReasonEOF - the file was played to the end
+	EndReasonEOF = EndReason(iota)
+	// EndReasonQuit - the user closed the player
+	EndReasonQuit
+	// EndReasonStopped - playback was stopped by Stop()
+	EndReasonStopped
+	// EndReasonError - playback failed
+	EndReasonError
+)
+
+func (r EndReason) String() string {
+	switch r {
+	case EndReasonEOF:
+		return "eof"
+	case EndReasonQuit:
+		return "quit"
+	case EndReasonStopped:
+		return "stopped"
+	case EndReasonError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
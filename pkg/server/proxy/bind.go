@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// the client dials peers through ProxyURL only, so binding to interface is a dialer type too,
+// proxy is dialed from bound addresses if it is set
+func init() {
+	xproxy.RegisterDialerType("bind", func(u *url.URL, _ xproxy.Dialer) (xproxy.Dialer, error) {
+		q := u.Query()
+		d := &bindDialer{v4: net.ParseIP(q.Get("ip4")), v6: net.ParseIP(q.Get("ip6"))}
+		if via := q.Get("via"); via != "" {
+			pu, err := url.Parse(via)
+			if err != nil {
+				return nil, err
+			}
+			return xproxy.FromURL(pu, d)
+		}
+		return d, nil
+	})
+}
+
+// BindURL returns url of dialer binding tcp connections to local addresses, via is proxy dialed from them
+func BindURL(v4, v6 net.IP, via *url.URL) string {
+	q := url.Values{}
+	if v4 != nil {
+		q.Set("ip4", v4.String())
+	}
+	if v6 != nil {
+		q.Set("ip6", v6.String())
+	}
+	if via != nil {
+		q.Set("via", via.String())
+	}
+	return (&url.URL{Scheme: "bind", Host: "local", RawQuery: q.Encode()}).String()
+}
+
+const dialTimeout = 30 * time.Second
+
+// addresses of interface from settings, nil - not bound
+var bound atomic.Pointer[bindDialer]
+
+// SetBind binds connections of DialContext to local addresses, nils unbind them
+func SetBind(v4, v6 net.IP) {
+	if v4 == nil && v6 == nil {
+		bound.Store(nil)
+		return
+	}
+	bound.Store(&bindDialer{v4: v4, v6: v6})
+}
+
+// DialContext dials tcp and udp from addresses of bound interface, http clients of the package dial with it too
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d := bound.Load(); d != nil {
+		return d.DialContext(ctx, network, addr)
+	}
+	d := net.Dialer{Timeout: dialTimeout}
+	return d.DialContext(ctx, network, addr)
+}
+
+type bindDialer struct {
+	v4, v6 net.IP
+}
+
+func (d *bindDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *bindDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return nil, fmt.Errorf("bind: network not supported: %s", network)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	locals := d.locals(network, host)
+	if len(locals) == 0 {
+		return nil, fmt.Errorf("bind: no local address for %s", addr)
+	}
+	// names are resolved to addresses of family of local address
+	for _, ip := range locals {
+		var local net.Addr = &net.TCPAddr{IP: ip}
+		if strings.HasPrefix(network, "udp") {
+			local = &net.UDPAddr{IP: ip}
+		}
+		dialer := net.Dialer{LocalAddr: local, Timeout: dialTimeout}
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, network, addr); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// locals returns local addresses to dial host from, ipv4 goes first for names
+func (d *bindDialer) locals(network, host string) []net.IP {
+	v4, v6 := d.v4, d.v6
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			v6 = nil
+		} else {
+			v4 = nil
+		}
+	}
+	if strings.HasSuffix(network, "6") {
+		v4 = nil
+	} else if strings.HasSuffix(network, "4") {
+		v6 = nil
+	}
+	var ret []net.IP
+	for _, ip := range []net.IP{v4, v6} {
+		if ip != nil {
+			ret = append(ret, ip)
+		}
+	}
+	return ret
+}
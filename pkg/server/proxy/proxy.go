@@ -0,0 +1,125 @@
+// Package proxy applies proxy settings and bound interface to peer connections, tracker announces and http fetches
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Config is set by settings on load and change
+type Config struct {
+	URL     string
+	Fetches bool // http fetches through proxy
+	Only    bool // refuse direct connections
+}
+
+var config atomic.Pointer[Config]
+
+func Set(c Config) {
+	config.Store(&c)
+}
+
+func get() Config {
+	if c := config.Load(); c != nil {
+		return *c
+	}
+	return Config{}
+}
+
+var (
+	ErrBadProxy  = errors.New("wrong proxy url, use socks5://[user:pass@]host:port or http://[user:pass@]host:port")
+	ErrProxyOnly = errors.New("direct connection is disabled in proxy only mode")
+)
+
+// Check validates proxy url, empty url is valid and means no proxy
+func Check(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Port() == "" {
+		return ErrBadProxy
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+		return nil
+	}
+	return ErrBadProxy
+}
+
+// URL returns proxy, nil - no proxy or wrong url
+func URL() *url.URL {
+	c := get()
+	if c.URL == "" || Check(c.URL) != nil {
+		return nil
+	}
+	u, _ := url.Parse(c.URL)
+	return u
+}
+
+// Configured reports that proxy is set in settings, it may be wrong
+func Configured() bool {
+	return get().URL != ""
+}
+
+// Only reports that connections not going through proxy must be refused
+func Only() bool {
+	c := get()
+	return c.URL != "" && c.Only
+}
+
+// Direct returns error if direct connection to addr is not allowed
+func Direct(addr string) error {
+	if Only() {
+		return fmt.Errorf("%w: %s", ErrProxyOnly, addr)
+	}
+	return nil
+}
+
+// TrackerProxy is proxy func of http transport for tracker requests
+func TrackerProxy(req *http.Request) (*url.URL, error) {
+	if u := URL(); u != nil {
+		return u, nil
+	}
+	if Only() {
+		return nil, ErrBadProxy
+	}
+	return nil, nil
+}
+
+// FetchProxy is proxy func of http transport for other requests, they go through proxy if enabled in settings
+func FetchProxy(req *http.Request) (*url.URL, error) {
+	if get().Fetches || Only() {
+		return TrackerProxy(req)
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// Client returns http client for fetches with timeout
+func Client(timeout time.Duration) *http.Client {
+	return newClient(FetchProxy, timeout)
+}
+
+// TrackerClient returns http client for tracker requests with timeout
+func TrackerClient(timeout time.Duration) *http.Client {
+	return newClient(TrackerProxy, timeout)
+}
+
+// Transport returns http transport for fetches
+func Transport() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = FetchProxy
+	tr.DialContext = DialContext
+	return tr
+}
+
+func newClient(fn func(*http.Request) (*url.URL, error), timeout time.Duration) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = fn
+	tr.DialContext = DialContext
+	return &http.Client{Transport: tr, Timeout: timeout}
+}
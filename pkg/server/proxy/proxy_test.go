@@ -0,0 +1,325 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// echoServer writes back everything read from connection
+func echoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// standInProxy accepts connections, handshake returns target which is piped to connection
+func standInProxy(t *testing.T, handshake func(conn net.Conn, br *bufio.Reader) (string, bool)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				addr, ok := handshake(conn, br)
+				if !ok {
+					return
+				}
+				target, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer target.Close()
+				go io.Copy(target, br)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// connectProxy is http proxy with basic auth, it sends greeting of tunnel right after response
+func connectProxy(t *testing.T, user, pass string) string {
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	return standInProxy(t, func(conn net.Conn, br *bufio.Reader) (string, bool) {
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect {
+			return "", false
+		}
+		if req.Header.Get("Proxy-Authorization") != auth {
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+			return "", false
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nhello ")
+		return req.Host, true
+	})
+}
+
+// socks5Proxy is socks5 proxy with username and password auth of RFC 1929
+func socks5Proxy(t *testing.T, user, pass string) string {
+	return standInProxy(t, socks5Handshake(user, pass))
+}
+
+func socks5Handshake(user, pass string) func(net.Conn, *bufio.Reader) (string, bool) {
+	return func(conn net.Conn, br *bufio.Reader) (string, bool) {
+		var hdr [2]byte
+		if _, err := io.ReadFull(br, hdr[:]); err != nil || hdr[0] != 5 {
+			return "", false
+		}
+		methods := make([]byte, hdr[1])
+		if _, err := io.ReadFull(br, methods); err != nil {
+			return "", false
+		}
+		conn.Write([]byte{5, 2})
+		// version 1, username, password
+		readField := func() string {
+			n, _ := br.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(br, b)
+			return string(b)
+		}
+		if v, _ := br.ReadByte(); v != 1 || readField() != user || readField() != pass {
+			conn.Write([]byte{1, 1})
+			return "", false
+		}
+		conn.Write([]byte{1, 0})
+
+		var req [4]byte
+		if _, err := io.ReadFull(br, req[:]); err != nil || req[1] != 1 {
+			return "", false
+		}
+		var host string
+		switch req[3] {
+		case 1:
+			ip := make([]byte, 4)
+			io.ReadFull(br, ip)
+			host = net.IP(ip).String()
+		case 3:
+			n, _ := br.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(br, b)
+			host = string(b)
+		default:
+			return "", false
+		}
+		var port [2]byte
+		if _, err := io.ReadFull(br, port[:]); err != nil {
+			return "", false
+		}
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), true
+	}
+}
+
+// roundTrip dials addr through proxy url and checks echo of message
+func roundTrip(t *testing.T, proxyURL, addr, greeting string) error {
+	t.Helper()
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer, err := xproxy.FromURL(u, xproxy.Direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	const msg = "ping"
+	if _, err = io.WriteString(conn, msg); err != nil {
+		return err
+	}
+	buf := make([]byte, len(greeting)+len(msg))
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if string(buf) != greeting+msg {
+		t.Fatalf("read %q through proxy", buf)
+	}
+	return nil
+}
+
+func TestConnectDialer(t *testing.T) {
+	target := echoServer(t)
+	addr := connectProxy(t, "user", "secret")
+	if err := roundTrip(t, "http://user:secret@"+addr, target, "hello "); err != nil {
+		t.Fatal(err)
+	}
+	if err := roundTrip(t, "http://user:wrong@"+addr, target, ""); err == nil {
+		t.Fatal("dial with wrong password succeeded")
+	}
+}
+
+func TestSocks5Dialer(t *testing.T) {
+	target := echoServer(t)
+	addr := socks5Proxy(t, "user", "secret")
+	if err := roundTrip(t, "socks5://user:secret@"+addr, target, ""); err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(target)
+	if err := roundTrip(t, "socks5h://user:secret@"+addr, "localhost:"+port, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := roundTrip(t, "socks5://user:wrong@"+addr, target, ""); err == nil {
+		t.Fatal("dial with wrong password succeeded")
+	}
+}
+
+func TestProxyOnly(t *testing.T) {
+	t.Cleanup(func() { Set(Config{}) })
+	req, _ := http.NewRequest(http.MethodGet, "http://tracker.example/announce", nil)
+
+	Set(Config{URL: "socks5://127.0.0.1:1080", Only: true})
+	if err := Direct("tracker.example:6969"); !errors.Is(err, ErrProxyOnly) {
+		t.Fatalf("direct connection in proxy only mode: %v", err)
+	}
+	for _, fn := range []func(*http.Request) (*url.URL, error){TrackerProxy, FetchProxy} {
+		if u, err := fn(req); err != nil || u == nil || u.Host != "127.0.0.1:1080" {
+			t.Fatalf("request in proxy only mode goes to %v: %v", u, err)
+		}
+	}
+
+	// wrong proxy can't be used, requests are refused instead of going direct
+	Set(Config{URL: "ftp://127.0.0.1:21", Only: true})
+	for _, fn := range []func(*http.Request) (*url.URL, error){TrackerProxy, FetchProxy} {
+		if _, err := fn(req); err != ErrBadProxy {
+			t.Fatalf("request with wrong proxy in proxy only mode: %v", err)
+		}
+	}
+
+	Set(Config{URL: "socks5://127.0.0.1:1080"})
+	if err := Direct("tracker.example:6969"); err != nil {
+		t.Fatalf("direct connection without proxy only mode: %v", err)
+	}
+	if u, _ := FetchProxy(req); u != nil && u.Host == "127.0.0.1:1080" {
+		t.Fatal("fetch goes through proxy which isn't enabled for fetches")
+	}
+}
+
+// boundIP is loopback address other than default source address, dials from it are bound
+var boundIP = net.IPv4(127, 0, 0, 2)
+
+func checkBound(t *testing.T, from net.Addr) {
+	t.Helper()
+	host, _, _ := net.SplitHostPort(from.String())
+	if !net.ParseIP(host).Equal(boundIP) {
+		t.Fatalf("connection from %v, not from bound address", from)
+	}
+}
+
+func TestBindDialer(t *testing.T) {
+	t.Cleanup(func() { SetBind(nil, nil) })
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	SetBind(boundIP, nil)
+	ctx := t.Context()
+	conn, err := DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Skip("loopback address can't be bound:", err)
+	}
+	conn.Close()
+	accepted, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted.Close()
+	checkBound(t, accepted.RemoteAddr())
+
+	// udp trackers are dialed from the interface too
+	conn, err = DialContext(ctx, "udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("ping"))
+	conn.Close()
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, from, err := pc.ReadFrom(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBound(t, from)
+
+	// interface without ipv6 address doesn't dial ipv6 hosts
+	if _, err = DialContext(ctx, "udp", "[::1]:6969"); err == nil {
+		t.Fatal("ipv6 host is dialed from interface without ipv6")
+	}
+
+	// http fetches are bound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RemoteAddr)
+	}))
+	defer srv.Close()
+	resp, err := Client(5 * time.Second).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	host, _, _ := net.SplitHostPort(string(body))
+	if !net.ParseIP(host).Equal(boundIP) {
+		t.Fatalf("fetch from %s, not from bound address", body)
+	}
+}
+
+func TestBindURLViaProxy(t *testing.T) {
+	target := echoServer(t)
+	from := make(chan net.Addr, 1)
+	handshake := socks5Handshake("user", "secret")
+	addr := standInProxy(t, func(conn net.Conn, br *bufio.Reader) (string, bool) {
+		from <- conn.RemoteAddr()
+		return handshake(conn, br)
+	})
+	via, _ := url.Parse("socks5://user:secret@" + addr)
+	if err := roundTrip(t, BindURL(boundIP, nil, via), target, ""); err != nil {
+		t.Skip("loopback address can't be bound:", err)
+	}
+	checkBound(t, <-from)
+}
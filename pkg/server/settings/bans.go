@@ -0,0 +1,45 @@
+package settings
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+)
+
+type Ban struct {
+	Reason    string `json:"reason"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// SetBan saves banned peer ip, saved bans are restored on start
+func SetBan(ip, reason string) {
+	if ReadOnly {
+		return
+	}
+	buf, err := json.Marshal(&Ban{Reason: reason, Timestamp: time.Now().Unix()})
+	if err != nil {
+		log.TLogln("Error set ban:", err)
+		return
+	}
+	tdb.Set("Bans", ip, buf)
+}
+
+func RemBan(ip string) {
+	if ReadOnly {
+		return
+	}
+	tdb.Rem("Bans", ip)
+}
+
+// ListBans returns saved bans by ip
+func ListBans() map[string]*Ban {
+	ret := make(map[string]*Ban)
+	for _, ip := range tdb.List("Bans") {
+		var ban Ban
+		if err := json.Unmarshal(tdb.Get("Bans", ip), &ban); err == nil {
+			ret[ip] = &ban
+		}
+	}
+	return ret
+}
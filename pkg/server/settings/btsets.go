@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
 )
 
 type BTSets struct {
@@ -15,6 +16,7 @@ type BTSets struct {
 	CacheSize       int64 // in byte, def 64 MB
 	ReaderReadAHead int   // in percent, 5%-100%, [...S__X__E...] [S-E] not clean
 	PreloadCache    int   // in percent
+	PrefetchNext    int   // in percent of read file, next file is prefetched after it, 0 - off
 
 	// Disk
 	UseDisk           bool
@@ -27,6 +29,10 @@ type BTSets struct {
 	TorrentDisconnectTimeout int  // in seconds
 	EnableDebug              bool // debug logs
 
+	// Retrackers
+	TrackersLists   []string // urls of trackers lists, def DefTrackersList
+	TrackersListTTL int      // in hours, lists are downloaded again after it
+
 	// BT Config
 	EnableIPv6        bool
 	DisableTCP        bool
@@ -40,6 +46,35 @@ type BTSets struct {
 	ConnectionsLimit  int
 	PeersListenPort   int
 
+	// Blocklist, merged with blocklist file near settings
+	BlocklistURLs   []string // P2P, eMule DAT or CIDR lists, may be gzip or zip
+	BlocklistUpdate int      // in hours, def 24
+
+	// Proxy, socks5://[user:pass@]host:port or http://[user:pass@]host:port
+	// for peers (tcp only) and trackers
+	ProxyURL     string
+	ProxyFetches bool // torrent files, lists and other http requests through proxy
+	ProxyOnly    bool // refuse direct connections: no dht, utp, udp trackers and incoming peers
+
+	// Network interface name or address to bind peers and dht, empty - all interfaces
+	BindInterface string
+	KillSwitch    bool // pause torrents and streams while the interface is down
+
+	// Smart ban of peers sending pieces which fail hash check
+	DisableSmartBan  bool
+	SmartBanFailures int  // corrupt pieces before ban, def 3
+	SmartBanPersist  bool // keep bans after restart
+
+	// Queue, streamed torrents always get a slot
+	MaxActiveTorrents  int // torrents in the swarm at once
+	MaxMetadataFetches int // background metadata fetches at once
+	MaxActivePreloads  int
+
+	// Seeding, torrent stays active without readers till the first target is reached
+	SeedRatio       float64 // upload/download, 0 - off
+	SeedTime        int     // in minutes, 0 - off
+	SeedWhileCached bool    // seed while pieces are in cache
+
 	// Reader
 	ResponsiveMode bool // enable Responsive reader (don't wait pieceComplete)
 
@@ -48,6 +83,15 @@ type BTSets struct {
 	BgMusicVolume int    // Background music volume 0-100
 }
 
+// SeedPolicy returns global seeding policy
+func (v *BTSets) SeedPolicy() *SeedPolicy {
+	return &SeedPolicy{
+		Ratio:       v.SeedRatio,
+		Time:        v.SeedTime,
+		WhileCached: v.SeedWhileCached,
+	}
+}
+
 func (v *BTSets) String() string {
 	buf, _ := json.Marshal(v)
 	return string(buf)
@@ -55,6 +99,8 @@ func (v *BTSets) String() string {
 
 var BTsets *BTSets
 
+const DefTrackersList = "https://raw.githubusercontent.com/ngosang/trackerslist/master/trackers_best_ip.txt"
+
 func SetBTSets(sets *BTSets) {
 	if ReadOnly {
 		return
@@ -69,6 +115,10 @@ func SetBTSets(sets *BTSets) {
 	if sets.TorrentDisconnectTimeout == 0 {
 		sets.TorrentDisconnectTimeout = 30
 	}
+	setQueueDefaults(sets)
+	setTrackersDefaults(sets)
+	setBlocklistDefaults(sets)
+	setProxy(sets)
 
 	if sets.ReaderReadAHead < 5 {
 		sets.ReaderReadAHead = 5
@@ -84,6 +134,13 @@ func SetBTSets(sets *BTSets) {
 		sets.PreloadCache = 100
 	}
 
+	if sets.PrefetchNext < 0 {
+		sets.PrefetchNext = 0
+	}
+	if sets.PrefetchNext > 100 {
+		sets.PrefetchNext = 100
+	}
+
 	if sets.BgMusicVolume < 0 {
 		sets.BgMusicVolume = 0
 	}
@@ -125,12 +182,17 @@ func SetDefaultConfig() {
 	sets := new(BTSets)
 	sets.CacheSize = 64 * 1024 * 1024 // 64 MB
 	sets.PreloadCache = 50
+	sets.PrefetchNext = 80
 	sets.ConnectionsLimit = 25
 	sets.RetrackersMode = 1
 	sets.TorrentDisconnectTimeout = 30
 	sets.ReaderReadAHead = 95 // 95%
 	sets.ThemeColor = "#6750A4" // M3 default purple
 	sets.BgMusicVolume = 30 // 30% volume
+	setQueueDefaults(sets)
+	setTrackersDefaults(sets)
+	setBlocklistDefaults(sets)
+	setProxy(sets)
 	BTsets = sets
 	if !ReadOnly {
 		buf, err := json.Marshal(BTsets)
@@ -142,6 +204,40 @@ func SetDefaultConfig() {
 	}
 }
 
+func setQueueDefaults(sets *BTSets) {
+	if sets.MaxActiveTorrents <= 0 {
+		sets.MaxActiveTorrents = 10
+	}
+	if sets.MaxMetadataFetches <= 0 {
+		sets.MaxMetadataFetches = 3
+	}
+	if sets.MaxActivePreloads <= 0 {
+		sets.MaxActivePreloads = 2
+	}
+}
+
+func setTrackersDefaults(sets *BTSets) {
+	if len(sets.TrackersLists) == 0 {
+		sets.TrackersLists = []string{DefTrackersList}
+	}
+	if sets.TrackersListTTL <= 0 {
+		sets.TrackersListTTL = 24
+	}
+}
+
+func setBlocklistDefaults(sets *BTSets) {
+	if sets.BlocklistUpdate <= 0 {
+		sets.BlocklistUpdate = 24
+	}
+	if sets.SmartBanFailures <= 0 {
+		sets.SmartBanFailures = 3
+	}
+}
+
+func setProxy(sets *BTSets) {
+	proxy.Set(proxy.Config{URL: sets.ProxyURL, Fetches: sets.ProxyFetches, Only: sets.ProxyOnly})
+}
+
 func loadBTSets() {
 	buf := tdb.Get("Settings", "BitTorr")
 	if len(buf) > 0 {
@@ -154,6 +250,10 @@ func loadBTSets() {
 			if BTsets.ThemeColor == "" {
 				BTsets.ThemeColor = "#6750A4" // M3 default purple
 			}
+			setQueueDefaults(BTsets)
+			setTrackersDefaults(BTsets)
+			setBlocklistDefaults(BTsets)
+			setProxy(BTsets)
 			// Set default bg music volume if not set (for existing configs)
 			if BTsets.BgMusicVolume == 0 {
 				BTsets.BgMusicVolume = 30
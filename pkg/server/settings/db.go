@@ -1,6 +1,7 @@
 package settings
 
 import (
+	"bytes"
 	"path/filepath"
 	"strings"
 	"time"
@@ -57,7 +58,8 @@ func (v *TDB) Get(xpath, name string) []byte {
 			}
 		}
 
-		ret = buckt.Get([]byte(name))
+		// value is valid only inside transaction
+		ret = bytes.Clone(buckt.Get([]byte(name)))
 		return nil
 	})
 	if err != nil {
@@ -0,0 +1,37 @@
+package settings
+
+// SetMetainfo saves bencoded info dict of torrent, so it starts without metadata download
+func SetMetainfo(hash string, info []byte) {
+	if ReadOnly || len(info) == 0 {
+		return
+	}
+	tdb.Set("Metainfo", hash, info)
+}
+
+// GetMetainfo returns saved bencoded info dict or nil
+func GetMetainfo(hash string) []byte {
+	return tdb.Get("Metainfo", hash)
+}
+
+func RemMetainfo(hash string) {
+	if ReadOnly {
+		return
+	}
+	tdb.Rem("Metainfo", hash)
+}
+
+// migrateMetainfo moves info of torrents added by file to metainfo store
+func migrateMetainfo() {
+	if ReadOnly {
+		return
+	}
+	for _, torr := range ListTorrent() {
+		if torr.TorrentSpec == nil || len(torr.InfoBytes) == 0 {
+			continue
+		}
+		hash := torr.InfoHash.HexString()
+		if len(GetMetainfo(hash)) == 0 {
+			SetMetainfo(hash, torr.InfoBytes)
+		}
+	}
+}
@@ -43,7 +43,9 @@ func InitSets(readOnly, searchWA bool) {
 	// First registered DB becomes default route
 	dbRouter.RegisterRoute(jsonDB, "Settings")
 	dbRouter.RegisterRoute(jsonDB, "Viewed")
+	dbRouter.RegisterRoute(jsonDB, "Bans")
 	dbRouter.RegisterRoute(bboltDB, "Torrents")
+	dbRouter.RegisterRoute(bboltDB, "Metainfo")
 
 	tdb = NewDBReadCache(dbRouter)
 
@@ -54,6 +56,7 @@ func InitSets(readOnly, searchWA bool) {
 	}
 	loadBTSets()
 	MigrateTorrents()
+	migrateMetainfo()
 }
 
 func CloseDB() {
@@ -19,6 +19,46 @@ type TorrentDB struct {
 
 	Timestamp int64 `json:"timestamp,omitempty"`
 	Size      int64 `json:"size,omitempty"`
+
+	DownloadLimit int `json:"download_limit,omitempty"` // in kb, 0 - global limit only
+	UploadLimit   int `json:"upload_limit,omitempty"`   // in kb, 0 - global limit only
+	Priority      int `json:"priority,omitempty"`       // state.TorrentPriority
+
+	Keep *KeepState `json:"keep,omitempty"`
+
+	Retrackers *int `json:"retrackers,omitempty"` // own RetrackersMode, nil - global mode
+
+	WebSeeds []string `json:"web_seeds,omitempty"` // http sources, BEP 19
+
+	CreationDate int64  `json:"creation_date,omitempty"` // of .torrent the torrent was added from
+	Comment      string `json:"comment,omitempty"`
+
+	Unwanted   []string `json:"unwanted,omitempty"`    // paths in torrent of files which aren't downloaded
+	SelectOnly []int    `json:"select_only,omitempty"` // BEP 53 indexes, applied when metadata is received
+
+	Seed        *SeedPolicy `json:"seed,omitempty"` // nil - global policy
+	Uploaded    int64       `json:"uploaded,omitempty"`
+	Downloaded  int64       `json:"downloaded,omitempty"`
+	SeedSeconds int64       `json:"seed_seconds,omitempty"`
+}
+
+// SeedPolicy tells how long torrent is seeded after playback
+type SeedPolicy struct {
+	Ratio       float64 `json:"ratio,omitempty"` // 0 - off
+	Time        int     `json:"time,omitempty"`  // in minutes, 0 - off
+	WhileCached bool    `json:"while_cached,omitempty"`
+}
+
+func (p *SeedPolicy) Enabled() bool {
+	return p != nil && (p.Ratio > 0 || p.Time > 0 || p.WhileCached)
+}
+
+// KeepState is a torrent downloaded completely into files
+type KeepState struct {
+	Path   string   `json:"path"`
+	Files  []string `json:"files,omitempty"` // paths in torrent, empty - all files
+	Paused bool     `json:"paused,omitempty"`
+	Seed   bool     `json:"seed,omitempty"` // files are source of created torrent, it is seeded from them
 }
 
 type File struct {
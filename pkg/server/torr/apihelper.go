@@ -1,9 +1,11 @@
 package torr
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"time"
 
@@ -12,20 +14,15 @@ import (
 
 	"github.com/german2285/TorrPlayer/pkg/server/log"
 	sets "github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
 )
 
 var bts *BTServer
-var metadataLoadedCallback func(hash string, peers int, fileCount int, totalSize int64)
 
 func InitApiHelper(bt *BTServer) {
 	bts = bt
 }
 
-// SetMetadataLoadedCallback sets callback for metadata loaded events
-func SetMetadataLoadedCallback(callback func(hash string, peers int, fileCount int, totalSize int64)) {
-	metadataLoadedCallback = callback
-}
-
 func LoadTorrent(tor *Torrent) *Torrent {
 	if tor.TorrentSpec == nil {
 		return nil
@@ -40,6 +37,8 @@ func LoadTorrent(tor *Torrent) *Torrent {
 	tr.Title = tor.Title
 	tr.Poster = tor.Poster
 	tr.Data = tor.Data
+	tr.SetLimits(tor.DownloadLimit, tor.UploadLimit, tor.Priority)
+	tr.setKeepState(tor.KeepState)
 	return tr
 }
 
@@ -83,6 +82,11 @@ func AddTorrent(spec *torrent.TorrentSpec, title, poster string, data string, ca
 		}
 	}
 
+	if torDB != nil {
+		torr.SetLimits(torDB.DownloadLimit, torDB.UploadLimit, torDB.Priority)
+		torr.setKeepState(torDB.KeepState)
+	}
+
 	return torr, nil
 }
 
@@ -110,7 +114,8 @@ func LoadTorrentsFromDBInstant() []*Torrent {
 }
 
 // LoadTorrentMetadataAsync loads full torrent metadata asynchronously in background
-// This function starts goroutines for each torrent to fetch DHT metadata
+// This function starts goroutines for each torrent to fetch DHT metadata,
+// completion is reported with MetadataReceivedEvent
 func LoadTorrentMetadataAsync(hash string) {
 	go func() {
 		log.TLogln("Loading torrent metadata asynchronously:", hash)
@@ -131,32 +136,10 @@ func LoadTorrentMetadataAsync(hash string) {
 
 		// Load torrent into BTServer (waits for DHT metadata)
 		log.TLogln("Loading torrent into BTServer:", hash, "Title:", dbTor.Title)
-		tor := LoadTorrent(dbTor)
+		tor := loadQueued(dbTor)
 		if tor != nil {
+			// subscribers get MetadataReceivedEvent from the torrent itself
 			log.TLogln("Torrent metadata loaded successfully:", hash)
-
-			// Collect metadata
-			peers := 0
-			fileCount := 0
-			totalSize := int64(0)
-
-			if tor.Torrent != nil {
-				stats := tor.Torrent.Stats()
-				peers = stats.ConnectedSeeders + stats.ActivePeers
-
-				if tor.Torrent.Info() != nil {
-					files := tor.Torrent.Files()
-					fileCount = len(files)
-					totalSize = tor.Torrent.Length()
-				}
-			}
-
-			log.TLogln("Torrent metadata - Hash:", hash, "Peers:", peers, "Files:", fileCount, "Size:", totalSize)
-
-			// Call callback if set
-			if metadataLoadedCallback != nil {
-				metadataLoadedCallback(hash, peers, fileCount, totalSize)
-			}
 		} else {
 			log.TLogln("Failed to load torrent metadata:", hash)
 		}
@@ -188,7 +171,7 @@ func LoadTorrentsFromDB() []*Torrent {
 
 		// Load torrent into BTServer
 		log.TLogln("Loading torrent from DB:", hash.HexString(), "Title:", dbTor.Title)
-		tor := LoadTorrent(dbTor)
+		tor := loadQueued(dbTor)
 		if tor != nil {
 			loaded = append(loaded, tor)
 			log.TLogln("Torrent loaded successfully:", hash.HexString())
@@ -233,6 +216,8 @@ func GetTorrent(hashHex string) *Torrent {
 					tr.Size = tor.Size
 					tr.Timestamp = tor.Timestamp
 					tr.Category = tor.Category
+					tr.SetLimits(tor.DownloadLimit, tor.UploadLimit, tor.Priority)
+					tr.setKeepState(tor.KeepState)
 					tr.GotInfo()
 				}
 			}()
@@ -285,16 +270,412 @@ func SetTorrent(hashHex, title, poster, category string, data string) *Torrent {
 	}
 }
 
+// SetTorrentLimits sets own rate limits in kb and priority of torrent, they are saved in DB
+func SetTorrentLimits(hashHex string, down, up int, priority state.TorrentPriority) error {
+	hash := metainfo.NewHashFromHex(hashHex)
+	var torr *Torrent
+	if bts != nil {
+		torr = bts.GetTorrent(hash)
+	}
+	torrDb := GetTorrentDB(hash)
+	if torr == nil && torrDb == nil {
+		return fmt.Errorf("torrent not found: %s", hashHex)
+	}
+
+	if torr != nil {
+		torr.SetLimits(down, up, priority)
+	}
+	if torrDb != nil && !sets.ReadOnly {
+		torrDb.SetLimits(down, up, priority)
+		AddTorrentDB(torrDb)
+	}
+	log.TLogln("set torrent limits:", hashHex, down, "/", up, "kb", priority)
+	return nil
+}
+
+// SetSeedPolicy sets seeding policy of torrent and saves it in DB, nil - global policy
+func SetSeedPolicy(hashHex string, p *sets.SeedPolicy) error {
+	hash := metainfo.NewHashFromHex(hashHex)
+	var torr *Torrent
+	if bts != nil {
+		torr = bts.GetTorrent(hash)
+	}
+	torrDb := GetTorrentDB(hash)
+	if torr == nil && torrDb == nil {
+		return fmt.Errorf("torrent not found: %s", hashHex)
+	}
+	if torr != nil {
+		torr.SetSeedPolicy(p)
+	}
+	if torrDb != nil && !sets.ReadOnly {
+		torrDb.SeedPolicy = p
+		AddTorrentDB(torrDb)
+	}
+	return nil
+}
+
+// GetTrackers returns trackers of torrent with announce status
+func GetTrackers(hashHex string) ([]*state.TrackerStatus, error) {
+	hash := metainfo.NewHashFromHex(hashHex)
+	if bts != nil {
+		if torr := bts.GetTorrent(hash); torr != nil {
+			return torr.TrackerList(), nil
+		}
+	}
+	if torrDb := GetTorrentDB(hash); torrDb != nil {
+		return torrDb.TrackerList(), nil
+	}
+	return nil, fmt.Errorf("torrent not found: %s", hashHex)
+}
+
+// EditTrackers changes trackers of running torrent and torrent in DB with edit
+func EditTrackers(hashHex string, edit func(torr *Torrent) error) error {
+	return editTorrent(hashHex, edit)
+}
+
+// editTorrent changes running torrent and torrent in DB with edit, trackers and web seeds are saved
+func editTorrent(hashHex string, edit func(torr *Torrent) error) error {
+	hash := metainfo.NewHashFromHex(hashHex)
+	var torr *Torrent
+	if bts != nil {
+		torr = bts.GetTorrent(hash)
+	}
+	torrDb := GetTorrentDB(hash)
+	if torr == nil && torrDb == nil {
+		return fmt.Errorf("torrent not found: %s", hashHex)
+	}
+
+	if torr != nil {
+		if err := edit(torr); err != nil {
+			return err
+		}
+	}
+	if torrDb != nil && !sets.ReadOnly {
+		if torr != nil {
+			torrDb.TorrentSpec = torr.TorrentSpec
+			torrDb.RetrackersMode = torr.RetrackersMode
+			torrDb.WebSeeds = torr.webSeedURLs()
+			torrDb.CreationDate, torrDb.Comment = torr.CreationDate, torr.Comment
+			torrDb.Unwanted, torrDb.SelectOnly = torr.selection()
+		} else if err := edit(torrDb); err != nil {
+			return err
+		}
+		AddTorrentDB(torrDb)
+	}
+	return nil
+}
+
+func AddTracker(hashHex, url string) error {
+	log.TLogln("add tracker:", hashHex, url)
+	return EditTrackers(hashHex, func(torr *Torrent) error { return torr.AddTracker(url) })
+}
+
+func RemoveTracker(hashHex, url string) error {
+	log.TLogln("remove tracker:", hashHex, url)
+	return EditTrackers(hashHex, func(torr *Torrent) error { return torr.RemoveTracker(url) })
+}
+
+// SetRetrackersMode sets own retrackers mode of torrent, nil - global mode
+func SetRetrackersMode(hashHex string, mode *int) error {
+	return EditTrackers(hashHex, func(torr *Torrent) error { return torr.SetRetrackersMode(mode) })
+}
+
+// GetWebSeeds returns http sources of torrent
+func GetWebSeeds(hashHex string) ([]*state.WebSeedStatus, error) {
+	hash := metainfo.NewHashFromHex(hashHex)
+	if bts != nil {
+		if torr := bts.GetTorrent(hash); torr != nil {
+			return torr.WebSeedList(), nil
+		}
+	}
+	if torrDb := GetTorrentDB(hash); torrDb != nil {
+		return torrDb.WebSeedList(), nil
+	}
+	return nil, fmt.Errorf("torrent not found: %s", hashHex)
+}
+
+func AddWebSeeds(hashHex string, urls []string) error {
+	log.TLogln("add web seeds:", hashHex, urls)
+	return editTorrent(hashHex, func(torr *Torrent) error { return torr.AddWebSeeds(urls) })
+}
+
+func RemoveWebSeed(hashHex, url string) error {
+	log.TLogln("remove web seed:", hashHex, url)
+	return editTorrent(hashHex, func(torr *Torrent) error { return torr.RemoveWebSeed(url) })
+}
+
+// Reannounce announces running torrent to tracker at once, empty url - to all trackers
+func Reannounce(hashHex, url string) error {
+	torr, err := runningTorrent(hashHex)
+	if err != nil {
+		return err
+	}
+	return torr.Reannounce(url)
+}
+
+// GetTorrentPeers returns connected peers of running torrent
+func GetTorrentPeers(hashHex string) ([]*state.PeerStat, error) {
+	torr, err := runningTorrent(hashHex)
+	if err != nil {
+		return nil, err
+	}
+	return torr.Peers(), nil
+}
+
+// AddPeer connects running torrent to peer with address ip:port
+func AddPeer(hashHex, addr string) error {
+	torr, err := runningTorrent(hashHex)
+	if err != nil {
+		return err
+	}
+	log.TLogln("add peer:", hashHex, addr)
+	return torr.AddPeer(addr)
+}
+
+// BanPeer blocks peer ip for all torrents, addr is ip or ip:port
+func BanPeer(addr string) error {
+	if bts == nil {
+		return fmt.Errorf("BT client not connected")
+	}
+	return bts.BanPeer(addr, "banned by user")
+}
+
+func UnbanPeer(addr string) error {
+	if bts == nil {
+		return fmt.Errorf("BT client not connected")
+	}
+	return bts.UnbanPeer(addr)
+}
+
+// BannedPeers returns banned ips with reasons
+func BannedPeers() map[string]string {
+	if bts == nil {
+		return nil
+	}
+	return bts.BannedPeers()
+}
+
+// BlocklistStats returns loaded blocklist ranges and rejected peers
+func BlocklistStats() (*state.BlocklistStats, error) {
+	if bts == nil {
+		return nil, fmt.Errorf("BT client not connected")
+	}
+	return bts.blocklists.Stats(), nil
+}
+
+// UpdateBlocklist downloads all blocklists and swaps them on the running client
+func UpdateBlocklist() error {
+	if bts == nil {
+		return fmt.Errorf("BT client not connected")
+	}
+	return bts.blocklists.update(true)
+}
+
+// NetInterface returns status of interface bound in settings
+func NetInterface() *state.NetInterface {
+	if bts == nil {
+		return &state.NetInterface{Name: sets.BTsets.BindInterface}
+	}
+	return bts.NetInterface()
+}
+
+// GetTorrentFiles returns files of torrent, saved metainfo is used if torrent has no info yet
+func GetTorrentFiles(hashHex string) []*state.TorrentFileStat {
+	hash := metainfo.NewHashFromHex(hashHex)
+	if bts != nil {
+		if tor := bts.GetTorrent(hash); tor != nil && len(tor.Files()) > 0 {
+			return tor.Status().FileStats
+		}
+	}
+	if info := GetMetainfoDB(hash); info != nil {
+		stats := infoFileStats(info)
+		if torrDb := GetTorrentDB(hash); torrDb != nil {
+			for _, st := range stats {
+				st.Unwanted = slices.Contains(torrDb.Unwanted, st.Path)
+			}
+		}
+		return stats
+	}
+	return nil
+}
+
+// SetFileWanted selects files with ids for download, others are unwanted, empty ids - all files
+func SetFileWanted(hashHex string, ids []int) error {
+	files := GetTorrentFiles(hashHex)
+	if len(files) == 0 {
+		return fmt.Errorf("torrent files are unknown: %s", hashHex)
+	}
+	for _, id := range ids {
+		if id < 1 || id > len(files) {
+			return fmt.Errorf("wrong file id: %d", id)
+		}
+	}
+	var unwanted []string
+	if len(ids) > 0 {
+		for _, f := range files {
+			if !slices.Contains(ids, f.Id) {
+				unwanted = append(unwanted, f.Path)
+			}
+		}
+	}
+	log.TLogln("set wanted files:", hashHex, ids)
+	return editTorrent(hashHex, func(torr *Torrent) error {
+		torr.SetUnwanted(unwanted)
+		return nil
+	})
+}
+
+// CancelMetadata stops metadata fetch of running torrent
+func CancelMetadata(hashHex string) error {
+	torr, err := runningTorrent(hashHex)
+	if err != nil {
+		return err
+	}
+	if !torr.CancelMetadata() {
+		return fmt.Errorf("metadata is not fetched: %s", hashHex)
+	}
+	return nil
+}
+
+func runningTorrent(hashHex string) (*Torrent, error) {
+	if bts == nil {
+		return nil, fmt.Errorf("BT client not connected")
+	}
+	torr := bts.GetTorrent(metainfo.NewHashFromHex(hashHex))
+	if torr == nil {
+		return nil, fmt.Errorf("torrent not loaded: %s", hashHex)
+	}
+	return torr, nil
+}
+
+// KeepTorrent downloads files of torrent with ids from file stats completely into dir, empty ids - all files
+func KeepTorrent(hashHex, dir string, fileIDs []int) error {
+	torr, err := loadTorrent(hashHex)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, id := range fileIDs {
+		file := torr.FileByID(id)
+		if file == nil {
+			return fmt.Errorf("file with id %v not found", id)
+		}
+		files = append(files, file.Path())
+	}
+	if err := torr.Keep(dir, files); err != nil {
+		return err
+	}
+	saveKeepState(torr)
+	return nil
+}
+
+// PauseKeep pauses or resumes full download of torrent
+func PauseKeep(hashHex string, pause bool) error {
+	var torr *Torrent
+	if bts != nil {
+		torr = bts.GetTorrent(metainfo.NewHashFromHex(hashHex))
+	}
+	if torr == nil {
+		// not loaded torrent downloads nothing, just save the state
+		torrDb := GetTorrentDB(metainfo.NewHashFromHex(hashHex))
+		if torrDb == nil || torrDb.KeepState == nil {
+			return ErrNotKept
+		}
+		torrDb.KeepState.Paused = pause
+		AddTorrentDB(torrDb)
+		if !pause {
+			_, err := loadTorrent(hashHex)
+			return err
+		}
+		return nil
+	}
+	var err error
+	if pause {
+		err = torr.PauseKeep()
+	} else {
+		err = torr.ResumeKeep()
+	}
+	if err != nil {
+		return err
+	}
+	saveKeepState(torr)
+	return nil
+}
+
+// CancelKeep turns keep mode of torrent off, downloaded files stay on disk
+func CancelKeep(hashHex string) {
+	hash := metainfo.NewHashFromHex(hashHex)
+	if bts != nil {
+		if torr := bts.GetTorrent(hash); torr != nil {
+			torr.CancelKeep()
+		}
+	}
+	if torrDb := GetTorrentDB(hash); torrDb != nil && !sets.ReadOnly {
+		torrDb.KeepState = nil
+		AddTorrentDB(torrDb)
+	}
+}
+
+// loadTorrent returns torrent with info, torrent from DB is loaded into client
+func loadTorrent(hashHex string) (*Torrent, error) {
+	torr := GetTorrent(hashHex)
+	if torr == nil {
+		return nil, fmt.Errorf("torrent not found: %s", hashHex)
+	}
+	if torr.State() == state.TorrentInDB {
+		torr = LoadTorrent(torr)
+		if torr == nil {
+			return nil, fmt.Errorf("error load torrent: %s", hashHex)
+		}
+	}
+	if !torr.GotInfo() {
+		return nil, fmt.Errorf("torrent don't get info: %s", hashHex)
+	}
+	return torr, nil
+}
+
+func saveKeepState(torr *Torrent) {
+	if sets.ReadOnly {
+		return
+	}
+	if torrDb := GetTorrentDB(torr.Hash()); torrDb != nil {
+		torr.muTorrent.Lock()
+		torrDb.KeepState = torr.KeepState
+		torr.muTorrent.Unlock()
+		AddTorrentDB(torrDb)
+	} else {
+		AddTorrentDB(torr)
+	}
+}
+
+// LoadKeepTorrents loads torrents with unfinished keep mode to continue download
+func LoadKeepTorrents() {
+	if bts == nil {
+		return
+	}
+	for hash, dbTor := range ListTorrentsDB() {
+		if dbTor.KeepState == nil || dbTor.KeepState.Paused || bts.GetTorrent(hash) != nil {
+			continue
+		}
+		go func(tor *Torrent) {
+			log.TLogln("Continue keep torrent:", tor.Hash().HexString())
+			loadQueued(tor)
+		}(dbTor)
+	}
+}
+
 func RemTorrent(hashHex string) {
 	if sets.ReadOnly {
 		log.TLogln("API RemTorrent: Read-only DB mode!", hashHex)
 		return
 	}
 	hash := metainfo.NewHashFromHex(hashHex)
+	forgetMetadata(hash)
 
 	// Remove from BT server if initialized
 	removed := false
 	if bts != nil {
+		bts.queue.CancelLoads(hash)
 		removed = bts.RemoveTorrent(hash)
 	}
 
@@ -361,15 +742,11 @@ func SetSettings(set *sets.BTSets) {
 		log.TLogln("API SetSettings: Read-only DB mode!")
 		return
 	}
+	old := *sets.BTsets
 	sets.SetBTSets(set)
-	log.TLogln("drop all torrents")
-	dropAllTorrent()
-	time.Sleep(time.Second * 1)
-	log.TLogln("disconect")
-	bts.Disconnect()
-	log.TLogln("connect")
-	bts.Connect()
-	time.Sleep(time.Second * 1)
+	if bts != nil {
+		bts.ApplySettings(&old, sets.BTsets)
+	}
 	log.TLogln("end set settings")
 }
 
@@ -378,23 +755,32 @@ func SetDefSettings() {
 		log.TLogln("API SetDefSettings: Read-only DB mode!")
 		return
 	}
+	old := *sets.BTsets
 	sets.SetDefaultConfig()
-	log.TLogln("drop all torrents")
-	dropAllTorrent()
-	time.Sleep(time.Second * 1)
-	log.TLogln("disconect")
-	bts.Disconnect()
-	log.TLogln("connect")
-	bts.Connect()
-	time.Sleep(time.Second * 1)
+	if bts != nil {
+		bts.ApplySettings(&old, sets.BTsets)
+	}
 	log.TLogln("end set default settings")
 }
 
-func dropAllTorrent() {
-	for _, torr := range bts.torrents {
-		torr.drop()
-		<-torr.closed
+// PauseAllTorrents removes all active torrents from the client, they stay in DB and load again on demand
+func PauseAllTorrents() {
+	if bts == nil {
+		return
+	}
+	for hash := range bts.ListTorrents() {
+		bts.RemoveTorrent(hash)
+	}
+	log.TLogln("all torrents paused")
+}
+
+// SetRateLimits temporarily changes rate limits of the running client without saving settings, in kb
+func SetRateLimits(down, up int) {
+	if bts == nil {
+		return
 	}
+	bts.SetRateLimits(down, up)
+	log.TLogln("set rate limits:", down, "/", up, "kb")
 }
 
 func Shutdown() {
@@ -409,14 +795,20 @@ func WriteStatus(w io.Writer) {
 }
 
 func Preload(torr *Torrent, index int) {
-	cache := float32(sets.BTsets.CacheSize)
-	preload := float32(sets.BTsets.PreloadCache)
-	size := int64((cache / 100.0) * preload)
+	size := preloadSize()
 	if size <= 0 {
 		return
 	}
+	torr.Preload(index, size)
+}
+
+// preloadSize returns size of preload, PreloadCache percent of cache
+func preloadSize() int64 {
+	cache := float32(sets.BTsets.CacheSize)
+	preload := float32(sets.BTsets.PreloadCache)
+	size := int64((cache / 100.0) * preload)
 	if size > sets.BTsets.CacheSize {
 		size = sets.BTsets.CacheSize
 	}
-	torr.Preload(index, size)
+	return size
 }
@@ -0,0 +1,319 @@
+package torr
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/torrent/iplist"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/utils"
+)
+
+const (
+	blocklistDir      = "blocklists"
+	blocklistMetaName = "meta.json"
+	blocklistMaxSize  = 64 << 20
+	// interval of checking that lists are stale
+	blocklistCheck = time.Hour
+	// name of source for blocklist file near settings
+	blocklistLocal = "blocklist"
+)
+
+type blocklistSource struct {
+	ETag     string `json:"etag,omitempty"`
+	Modified string `json:"modified,omitempty"`
+	Fetched  int64  `json:"fetched"` // unix time
+	Ranges   int    `json:"ranges"`
+	Error    string `json:"error,omitempty"`
+}
+
+// blocklists downloads blocklists on schedule and swaps blocklist of the client filter
+type blocklists struct {
+	filter   *ipFilter
+	sources  map[string]*blocklistSource // by url
+	ranges   int
+	loaded   int64
+	mu       sync.Mutex
+	updating atomic.Bool
+	start    sync.Once
+}
+
+func newBlocklists(filter *ipFilter) *blocklists {
+	return &blocklists{filter: filter}
+}
+
+// run loads cached lists at once and updates stale lists in background
+func (b *blocklists) run() {
+	b.start.Do(func() {
+		b.load()
+		go func() {
+			for {
+				if b.stale() {
+					b.update(false)
+				}
+				time.Sleep(blocklistCheck)
+			}
+		}()
+	})
+}
+
+func blocklistURLs() []string {
+	if settings.BTsets == nil {
+		return nil
+	}
+	return settings.BTsets.BlocklistURLs
+}
+
+func blocklistInterval() time.Duration {
+	if settings.BTsets == nil || settings.BTsets.BlocklistUpdate <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(settings.BTsets.BlocklistUpdate) * time.Hour
+}
+
+func blocklistFile(u string) string {
+	sum := sha1.Sum([]byte(u))
+	return filepath.Join(settings.Path, blocklistDir, hex.EncodeToString(sum[:8])+".list")
+}
+
+func (b *blocklists) stale() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.loadMetaLocked()
+	for _, u := range blocklistURLs() {
+		src := b.sources[u]
+		if src == nil || time.Since(time.Unix(src.Fetched, 0)) > blocklistInterval() {
+			return true
+		}
+	}
+	return false
+}
+
+// load merges local blocklist file and downloaded lists and sets them to the filter
+func (b *blocklists) load() {
+	var all []iplist.Range
+	counts := make(map[string]int)
+	errs := make(map[string]string)
+
+	if ranges, err := utils.ReadBlockedIP(); err == nil {
+		all = append(all, ranges...)
+		counts[blocklistLocal] = len(ranges)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		errs[blocklistLocal] = err.Error()
+	}
+	for _, u := range blocklistURLs() {
+		buf, err := os.ReadFile(blocklistFile(u))
+		if err != nil {
+			continue
+		}
+		ranges, err := utils.ParseBlocklist(buf)
+		if err != nil {
+			errs[u] = err.Error()
+			continue
+		}
+		all = append(all, ranges...)
+		counts[u] = len(ranges)
+	}
+
+	var list iplist.Ranger
+	n := 0
+	if len(all) > 0 {
+		bl := utils.NewBlocklist(all)
+		list, n = bl, bl.NumRanges()
+	}
+	b.filter.SetBlocklist(list)
+
+	b.mu.Lock()
+	b.loadMetaLocked()
+	for u, src := range b.sources {
+		src.Ranges = counts[u]
+		if e, ok := errs[u]; ok {
+			src.Error = e
+		}
+	}
+	if _, ok := counts[blocklistLocal]; ok || errs[blocklistLocal] != "" {
+		b.sources[blocklistLocal] = &blocklistSource{Fetched: time.Now().Unix(), Ranges: counts[blocklistLocal], Error: errs[blocklistLocal]}
+	} else {
+		delete(b.sources, blocklistLocal)
+	}
+	b.ranges = n
+	b.loaded = time.Now().Unix()
+	b.mu.Unlock()
+	log.TLogln("Blocklist loaded, ranges:", n)
+}
+
+// update downloads stale lists, force downloads all lists
+func (b *blocklists) update(force bool) error {
+	if !b.updating.CompareAndSwap(false, true) {
+		return errors.New("blocklist is updating already")
+	}
+	defer b.updating.Store(false)
+
+	var errs []error
+	for _, u := range blocklistURLs() {
+		b.mu.Lock()
+		b.loadMetaLocked()
+		src := b.sources[u]
+		if src == nil {
+			src = new(blocklistSource)
+			b.sources[u] = src
+		}
+		prev := *src
+		b.mu.Unlock()
+		if !force && time.Since(time.Unix(prev.Fetched, 0)) <= blocklistInterval() {
+			continue
+		}
+
+		cur, err := downloadBlocklist(u, prev)
+		b.mu.Lock()
+		if err != nil {
+			log.TLogln("Error download blocklist", u, err)
+			errs = append(errs, err)
+			src.Error = err.Error()
+		} else {
+			*src = *cur
+		}
+		b.mu.Unlock()
+	}
+
+	b.mu.Lock()
+	// lists removed from settings
+	urls := make(map[string]bool)
+	for _, u := range blocklistURLs() {
+		urls[u] = true
+	}
+	for u := range b.sources {
+		if !urls[u] && u != blocklistLocal {
+			delete(b.sources, u)
+			os.Remove(blocklistFile(u))
+		}
+	}
+	b.saveMetaLocked()
+	b.mu.Unlock()
+
+	b.load()
+	return errors.Join(errs...)
+}
+
+// downloadBlocklist saves list into cache file, not modified list is revalidated only
+func downloadBlocklist(u string, prev blocklistSource) (*blocklistSource, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(blocklistFile(u)); err == nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.Modified != "" {
+			req.Header.Set("If-Modified-Since", prev.Modified)
+		}
+	}
+	client := proxy.Client(2 * time.Minute)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		prev.Fetched = time.Now().Unix()
+		prev.Error = ""
+		return &prev, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("response: %s", resp.Status)
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, blocklistMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) > blocklistMaxSize {
+		return nil, errors.New("blocklist is too big")
+	}
+	// check list before it replaces cached one
+	ranges, err := utils.ParseBlocklist(buf)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(blocklistFile(u)), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(blocklistFile(u), buf, 0o644); err != nil {
+		return nil, err
+	}
+	return &blocklistSource{
+		ETag:     resp.Header.Get("ETag"),
+		Modified: resp.Header.Get("Last-Modified"),
+		Fetched:  time.Now().Unix(),
+		Ranges:   len(ranges),
+	}, nil
+}
+
+// loadMetaLocked must be called with mu held
+func (b *blocklists) loadMetaLocked() {
+	if b.sources != nil {
+		return
+	}
+	b.sources = make(map[string]*blocklistSource)
+	buf, err := os.ReadFile(filepath.Join(settings.Path, blocklistDir, blocklistMetaName))
+	if err == nil {
+		if err := json.Unmarshal(buf, &b.sources); err != nil {
+			b.sources = make(map[string]*blocklistSource)
+		}
+	}
+}
+
+// saveMetaLocked must be called with mu held
+func (b *blocklists) saveMetaLocked() {
+	if settings.ReadOnly {
+		return
+	}
+	buf, err := json.MarshalIndent(b.sources, "", " ")
+	if err != nil {
+		return
+	}
+	dir := filepath.Join(settings.Path, blocklistDir)
+	if err := os.MkdirAll(dir, 0o755); err == nil {
+		os.WriteFile(filepath.Join(dir, blocklistMetaName), buf, 0o644)
+	}
+}
+
+// Stats returns ranges loaded from each source and peers rejected by blocklist and bans
+func (b *blocklists) Stats() *state.BlocklistStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.loadMetaLocked()
+	st := &state.BlocklistStats{
+		Ranges:   b.ranges,
+		Banned:   len(b.filter.Banned()),
+		Rejected: b.filter.Rejected(),
+		Loaded:   b.loaded,
+		Updating: b.updating.Load(),
+	}
+	for u, src := range b.sources {
+		st.Sources = append(st.Sources, &state.BlocklistSource{
+			URL:     u,
+			Ranges:  src.Ranges,
+			Updated: src.Fetched,
+			Error:   src.Error,
+		})
+	}
+	return st
+}
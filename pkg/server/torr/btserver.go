@@ -5,15 +5,22 @@ import (
 	"fmt"
 	"log"
 	"maps"
+	"math/rand"
 	"net"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/anacrolix/publicip"
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/wlynxg/anet"
 
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
 	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
 	"github.com/german2285/TorrPlayer/pkg/server/torr/storage/torrstor"
 	"github.com/german2285/TorrPlayer/pkg/server/torr/utils"
 	"github.com/german2285/TorrPlayer/pkg/server/version"
@@ -26,6 +33,26 @@ type BTServer struct {
 	storage *torrstor.Storage
 
 	torrents map[metainfo.Hash]*Torrent
+	queue    *queue
+
+	// key of announces to trackers, see trackers.go
+	announceKey int32
+	// blocklist and banned peers, kept over reconnects
+	filter     *ipFilter
+	blocklists *blocklists
+	// strikes of peers by ip, see smartban.go
+	strikes map[string]float64
+	// status of the client shared by torrents, see peers.go
+	status     []byte
+	statusTime time.Time
+	muStatus   sync.Mutex
+	// bound interface and kill switch, see netbind.go
+	netStat   *state.NetInterface
+	netSnaps  []*torrentSnapshot
+	netPaused atomic.Bool
+	netOnce   sync.Once
+	muNetStat sync.Mutex
+	muNet     sync.Mutex
 
 	mu sync.Mutex
 }
@@ -54,6 +81,13 @@ func init() {
 func NewBTS() *BTServer {
 	bts := new(BTServer)
 	bts.torrents = make(map[metainfo.Hash]*Torrent)
+	bts.queue = newQueue(bts.parkIdle)
+	bts.announceKey = rand.Int31()
+	bts.filter = newIPFilter()
+	bts.blocklists = newBlocklists(bts.filter)
+	bts.strikes = make(map[string]float64)
+	bts.restoreBans()
+	utils.SetDefTrackersUpdated(bts.syncAllTrackers)
 	return bts
 }
 
@@ -65,10 +99,13 @@ func (bt *BTServer) Connect() error {
 	bt.client, err = torrent.NewClient(bt.config)
 	bt.torrents = make(map[metainfo.Hash]*Torrent)
 	InitApiHelper(bt)
+	bt.netOnce.Do(func() { go bt.watchInterface() })
 	return err
 }
 
 func (bt *BTServer) Disconnect() {
+	// torrents waiting in queue aren't loaded into the closed client
+	bt.queue.CancelLoads(metainfo.Hash{})
 	bt.mu.Lock()
 	defer bt.mu.Unlock()
 	if bt.client != nil {
@@ -79,7 +116,6 @@ func (bt *BTServer) Disconnect() {
 }
 
 func (bt *BTServer) configure(ctx context.Context) {
-	blocklist, _ := utils.ReadBlockedIP()
 	bt.config = torrent.NewDefaultClientConfig()
 
 	bt.storage = torrstor.NewStorage(settings.BTsets.CacheSize)
@@ -101,7 +137,10 @@ func (bt *BTServer) configure(ctx context.Context) {
 	bt.config.NoDHT = settings.BTsets.DisableDHT
 	bt.config.DisablePEX = settings.BTsets.DisablePEX
 	bt.config.NoUpload = settings.BTsets.DisableUpload
-	bt.config.IPBlocklist = blocklist
+	// complete torrents upload to everyone, seed policy decides how long they stay active
+	bt.config.Seed = true
+	bt.blocklists.run()
+	bt.config.IPBlocklist = bt.filter
 	bt.config.Bep20 = peerID
 	bt.config.PeerID = utils.PeerIDRandom(peerID)
 	bt.config.UpnpID = upnpID
@@ -117,12 +156,9 @@ func (bt *BTServer) configure(ctx context.Context) {
 	// 	RequirePreferred: settings.BTsets.ForceEncrypt, //	NE
 	// 	Preferred:        true,                         //	NE
 	// } //	NE
-	if settings.BTsets.DownloadRateLimit > 0 {
-		bt.config.DownloadRateLimiter = utils.Limit(settings.BTsets.DownloadRateLimit * 1024)
-	}
-	if settings.BTsets.UploadRateLimit > 0 {
-		bt.config.UploadRateLimiter = utils.Limit(settings.BTsets.UploadRateLimit * 1024)
-	}
+	// own limiters even if unlimited, so they can be changed on the running client
+	bt.config.DownloadRateLimiter = utils.Limit(settings.BTsets.DownloadRateLimit * 1024)
+	bt.config.UploadRateLimiter = utils.Limit(settings.BTsets.UploadRateLimit * 1024)
 	if settings.TorAddr != "" {
 		log.Println("Set listen addr", settings.TorAddr)
 		bt.config.SetListenAddr(settings.TorAddr)
@@ -136,6 +172,9 @@ func (bt *BTServer) configure(ctx context.Context) {
 		}
 	}
 
+	bt.configureProxy()
+	bt.configureBind()
+
 	log.Println("Client config:", settings.BTsets)
 
 	var err error
@@ -146,7 +185,7 @@ func (bt *BTServer) configure(ctx context.Context) {
 			bt.config.PublicIp4 = ip4
 		}
 	}
-	if bt.config.PublicIp4 == nil {
+	if bt.config.PublicIp4 == nil && !proxy.Only() {
 		bt.config.PublicIp4, err = publicip.Get4(ctx)
 		if err != nil {
 			log.Printf("error getting public ipv4 address: %v", err)
@@ -165,7 +204,7 @@ func (bt *BTServer) configure(ctx context.Context) {
 			bt.config.PublicIp6 = ip6
 		}
 	}
-	if bt.config.PublicIp6 == nil && settings.BTsets.EnableIPv6 {
+	if bt.config.PublicIp6 == nil && settings.BTsets.EnableIPv6 && !proxy.Only() {
 		bt.config.PublicIp6, err = publicip.Get6(ctx)
 		if err != nil {
 			log.Printf("error getting public ipv6 address: %v", err)
@@ -179,7 +218,178 @@ func (bt *BTServer) configure(ctx context.Context) {
 	}
 }
 
+// configureProxy dials peers and trackers through proxy, direct connections are disabled in proxy only mode
+func (bt *BTServer) configureProxy() {
+	bt.config.HTTPProxy = proxy.TrackerProxy
+	if u := proxy.URL(); u != nil {
+		log.Println("Set proxy", u.Redacted())
+		bt.config.ProxyURL = u.String()
+		// the proxy dialer can't dial utp
+		bt.config.DisableUTP = true
+	} else if proxy.Configured() {
+		log.Println("Error proxy:", proxy.ErrBadProxy)
+		if proxy.Only() {
+			bt.config.DisableTCP = true
+		}
+	}
+	if proxy.Only() {
+		log.Println("Proxy only mode, direct connections are disabled")
+		bt.config.DisableUTP = true
+		bt.config.NoDHT = true
+		bt.config.NoDefaultPortForwarding = true
+		// incoming peers are direct connections
+		bt.config.ListenHost = func(network string) string {
+			if strings.Contains(network, "6") {
+				return "::1"
+			}
+			return "127.0.0.1"
+		}
+	}
+}
+
+// SetRateLimits changes download and upload limits of the running client, in kb, 0 - inf
+func (bt *BTServer) SetRateLimits(down, up int) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if bt.config == nil {
+		return
+	}
+	utils.SetLimit(bt.config.DownloadRateLimiter, down*1024)
+	utils.SetLimit(bt.config.UploadRateLimiter, up*1024)
+}
+
+// ApplySettings applies changed settings to the running client. Rate limits, connections limit
+// and cache size are changed in place, network settings need a client reconnect
+func (bt *BTServer) ApplySettings(old, cur *settings.BTSets) {
+	if old == nil || cur == nil {
+		return
+	}
+	bt.queue.Update()
+	if !slices.Equal(old.TrackersLists, cur.TrackersLists) {
+		go utils.RefreshDefTrackers(true)
+	}
+	if !slices.Equal(old.BlocklistURLs, cur.BlocklistURLs) {
+		go bt.blocklists.update(false)
+	}
+	if needReconnect(old, cur) {
+		log.Println("Network settings changed, reconnect client")
+		if err := bt.Reconnect(); err != nil {
+			log.Println("Error reconnect client:", err)
+		}
+		return
+	}
+
+	if old.DownloadRateLimit != cur.DownloadRateLimit || old.UploadRateLimit != cur.UploadRateLimit {
+		bt.SetRateLimits(cur.DownloadRateLimit, cur.UploadRateLimit)
+	}
+	if old.ConnectionsLimit != cur.ConnectionsLimit {
+		for _, torr := range bt.ListTorrents() {
+			torr.muTorrent.Lock()
+			torr.maxConns = 0
+			torr.muTorrent.Unlock()
+			torr.applyLimits()
+		}
+	}
+	if old.CacheSize != cur.CacheSize && bt.storage != nil {
+		bt.storage.SetCapacity(cur.CacheSize)
+	}
+	if old.RetrackersMode != cur.RetrackersMode {
+		bt.syncAllTrackers()
+	}
+	// readahead and preload are read from settings on use
+}
+
+func needReconnect(old, cur *settings.BTSets) bool {
+	return old.PeersListenPort != cur.PeersListenPort ||
+		old.DisableDHT != cur.DisableDHT ||
+		old.EnableIPv6 != cur.EnableIPv6 ||
+		old.ForceEncrypt != cur.ForceEncrypt ||
+		old.DisableTCP != cur.DisableTCP ||
+		old.DisableUTP != cur.DisableUTP ||
+		old.DisableUPNP != cur.DisableUPNP ||
+		old.DisablePEX != cur.DisablePEX ||
+		old.DisableUpload != cur.DisableUpload ||
+		old.EnableDebug != cur.EnableDebug ||
+		old.UseDisk != cur.UseDisk ||
+		old.TorrentsSavePath != cur.TorrentsSavePath ||
+		old.ProxyURL != cur.ProxyURL ||
+		old.ProxyOnly != cur.ProxyOnly ||
+		old.BindInterface != cur.BindInterface
+}
+
+// Reconnect recreates the client with current settings, active torrents are added again
+// and their readers continue from the same position
+func (bt *BTServer) Reconnect() error {
+	bt.muNet.Lock()
+	defer bt.muNet.Unlock()
+	// settings are applied when kill switch resumes the client
+	if bt.netSnaps != nil {
+		return nil
+	}
+	snaps := bt.suspendAll()
+	bt.Disconnect()
+	if err := bt.Connect(); err != nil {
+		for _, snap := range snaps {
+			snap.resume(nil)
+		}
+		return err
+	}
+	bt.restore(snaps)
+	return nil
+}
+
+// suspendAll closes torrents, their readers wait for restore
+func (bt *BTServer) suspendAll() []*torrentSnapshot {
+	list := bt.ListTorrents()
+	snaps := make([]*torrentSnapshot, 0, len(list))
+	for _, torr := range list {
+		snaps = append(snaps, torr.suspend())
+	}
+	for _, torr := range list {
+		torr.Close()
+	}
+	return snaps
+}
+
+// restore adds suspended torrents to the new client
+func (bt *BTServer) restore(snaps []*torrentSnapshot) {
+	for _, snap := range snaps {
+		torr, err := NewTorrent(snap.spec, bt)
+		if err != nil {
+			log.Println("Error restore torrent:", snap.spec.InfoHash.HexString(), err)
+			snap.resume(nil)
+			continue
+		}
+		torr.Title = snap.title
+		torr.Category = snap.category
+		torr.Poster = snap.poster
+		torr.Data = snap.data
+		torr.Size = snap.size
+		torr.Timestamp = snap.timestamp
+		torr.SetLimits(snap.down, snap.up, snap.priority)
+		torr.setKeepState(snap.keep)
+		torr.SetRetrackersMode(snap.retrack)
+		// selection and web seeds are applied when the new torrent gets info
+		torr.muTorrent.Lock()
+		torr.SeedPolicy = snap.seed
+		torr.Uploaded, torr.Downloaded, torr.SeedSeconds = snap.uploaded, snap.loaded, snap.seeded
+		torr.WebSeeds = snap.webSeeds
+		torr.Unwanted, torr.SelectOnly = snap.unwanted, snap.selectIdx
+		torr.CreationDate, torr.Comment = snap.created, snap.comment
+		torr.muTorrent.Unlock()
+		go func(snap *torrentSnapshot) {
+			if torr.GotInfo() {
+				snap.resume(torr)
+			} else {
+				snap.resume(nil)
+			}
+		}(snap)
+	}
+}
+
 func (bt *BTServer) GetTorrent(hash torrent.InfoHash) *Torrent {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
 	if torr, ok := bt.torrents[hash]; ok {
 		return torr
 	}
@@ -187,18 +397,27 @@ func (bt *BTServer) GetTorrent(hash torrent.InfoHash) *Torrent {
 }
 
 func (bt *BTServer) ListTorrents() map[metainfo.Hash]*Torrent {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
 	list := make(map[metainfo.Hash]*Torrent)
 	maps.Copy(list, bt.torrents)
 	return list
 }
 
 func (bt *BTServer) RemoveTorrent(hash torrent.InfoHash) bool {
-	if torr, ok := bt.torrents[hash]; ok {
+	// Close takes bt.mu itself
+	if torr := bt.GetTorrent(hash); torr != nil {
 		return torr.Close()
 	}
 	return false
 }
 
+func (bt *BTServer) getClient() *torrent.Client {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	return bt.client
+}
+
 func isPrivateIP(ip net.IP) bool {
 	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
 		return true
@@ -0,0 +1,50 @@
+package torr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/tracker"
+
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
+)
+
+func TestConfigureProxyOnly(t *testing.T) {
+	t.Cleanup(func() { proxy.Set(proxy.Config{}) })
+
+	bt := NewBTS()
+	bt.config = torrent.NewDefaultClientConfig()
+	proxy.Set(proxy.Config{URL: "socks5://127.0.0.1:1080", Only: true})
+	bt.configureProxy()
+	if bt.config.ProxyURL != "socks5://127.0.0.1:1080" || bt.config.DisableTCP {
+		t.Fatalf("peers don't go through proxy: %q", bt.config.ProxyURL)
+	}
+	if !bt.config.DisableUTP || !bt.config.NoDHT || !bt.config.NoDefaultPortForwarding {
+		t.Fatal("direct connections are enabled in proxy only mode")
+	}
+	if host := bt.config.ListenHost("tcp4"); host != "127.0.0.1" {
+		t.Fatalf("incoming peers are listened on %q", host)
+	}
+
+	// peers can't go through wrong proxy, so they aren't dialed at all
+	bt.config = torrent.NewDefaultClientConfig()
+	proxy.Set(proxy.Config{URL: "socks5://127.0.0.1", Only: true})
+	bt.configureProxy()
+	if bt.config.ProxyURL != "" || !bt.config.DisableTCP || !bt.config.DisableUTP {
+		t.Fatal("peers are dialed directly with wrong proxy in proxy only mode")
+	}
+}
+
+func TestAnnounceProxyOnly(t *testing.T) {
+	t.Cleanup(func() { proxy.Set(proxy.Config{}) })
+	bt := newTestBTS(t, 8*testPieceLength)
+	spec, _ := testSpec(t, testPieceLength)
+	torr := addTestTorrent(t, bt, spec)
+
+	proxy.Set(proxy.Config{URL: "socks5://127.0.0.1:1080", Only: true})
+	_, err := torr.announce(t.Context(), "udp://127.0.0.1:6969/announce", tracker.Started)
+	if !errors.Is(err, proxy.ErrProxyOnly) {
+		t.Fatalf("udp announce in proxy only mode: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package torr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/anacrolix/torrent"
+
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+const (
+	bufferTick    = 500 * time.Millisecond
+	bufferSeconds = 10       // seconds of media buffered at least
+	bufferDefault = 32 << 20 // target while bitrate of media is unknown
+)
+
+// Buffer loads file with id from pos till it can be played without stalling at current download speed,
+// progress is published by BufferProgressEvent. Buffering is stopped when ctx is done
+func (t *Torrent) Buffer(ctx context.Context, id int, pos int64) error {
+	file := t.FileByID(id)
+	if file == nil {
+		return fmt.Errorf("file with id %v not found", id)
+	}
+	reader := t.NewReader(file)
+	if reader == nil {
+		return ErrTorrentClosed
+	}
+	defer t.CloseReader(reader)
+	// readahead of buffer reader is the target, it isn't sized by updateRA
+	t.muTorrent.Lock()
+	t.buffering = reader
+	t.muTorrent.Unlock()
+	defer func() {
+		t.muTorrent.Lock()
+		if t.buffering == reader {
+			t.buffering = nil
+		}
+		t.muTorrent.Unlock()
+	}()
+	if _, err := reader.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(bufferTick)
+	defer ticker.Stop()
+	for {
+		st := t.bufferStatus(file, id, pos)
+		// reader prioritizes pieces up to target
+		reader.SetReadahead(st.Target)
+		publish(&BufferProgressEvent{st})
+		if st.Done {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.closed:
+			return ErrTorrentClosed
+		}
+	}
+}
+
+// bufferStatus estimates data needed from pos: at least bufferSeconds of media,
+// more when download is slower than media, so the rest is loaded while playing
+func (t *Torrent) bufferStatus(file *torrent.File, id int, pos int64) *state.BufferStatus {
+	st := &state.BufferStatus{
+		Hash:     t.Hash().HexString(),
+		FileId:   id,
+		Position: pos,
+		ETA:      -1,
+	}
+	t.muTorrent.Lock()
+	st.Speed = t.DownloadSpeed
+	t.muTorrent.Unlock()
+	st.BitRate, st.Duration = t.MediaInfo(file.Path())
+	if st.BitRate == 0 {
+		t.probeMedia(file)
+	}
+
+	var limit int64
+	if cache := t.GetCache(); cache != nil {
+		limit = cache.GetCapacity() * int64(settings.BTsets.ReaderReadAHead) / 100
+	}
+	st.Target, st.Capped = bufferTarget(st.BitRate, st.Speed, max(file.Length()-pos, 0), limit)
+	st.Ready = min(t.completeFrom(file, pos), st.Target)
+
+	if st.Target > 0 {
+		st.Percent = float64(st.Ready) * 100 / float64(st.Target)
+	} else {
+		st.Percent = 100
+	}
+	st.Done = st.Ready >= st.Target
+	switch {
+	case st.Done:
+		st.ETA = 0
+	case st.Speed > 0:
+		st.ETA = float64(st.Target-st.Ready) / st.Speed
+	}
+	return st
+}
+
+// bufferTarget returns data needed from position with left bytes of file, capped is set
+// when readahead limit of cache, 0 - no limit, is lower and playback may stall after buffering
+func bufferTarget(bitRate int64, speed float64, left, limit int64) (target int64, capped bool) {
+	target = bufferDefault
+	if bitRate > 0 {
+		rate := float64(bitRate) / 8
+		target = int64(rate * bufferSeconds)
+		if speed < rate {
+			// playback of the rest takes left/rate, download falls behind by rate-speed every second
+			target = max(target, int64((rate-speed)*float64(left)/rate))
+		}
+	}
+	target = min(target, left)
+	// data out of reader range is evicted from cache
+	if limit > 0 && target > limit {
+		return limit, true
+	}
+	return target, false
+}
+
+// completeFrom returns size of contiguous complete data of file from pos
+func (t *Torrent) completeFrom(file *torrent.File, pos int64) int64 {
+	pieceLength := t.Info().PieceLength
+	start, end := file.Offset()+pos, file.Offset()+file.Length()
+	off := start
+	for id := int(start / pieceLength); off < end && t.Torrent.PieceState(id).Complete; id++ {
+		off = int64(id+1) * pieceLength
+	}
+	return min(off, end) - start
+}
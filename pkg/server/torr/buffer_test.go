@@ -0,0 +1,59 @@
+package torr
+
+import (
+	"testing"
+
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+)
+
+func TestBufferTarget(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		name    string
+		bitRate int64 // bits per second, 0 - unknown
+		speed   float64
+		left    int64
+		limit   int64
+		want    int64
+		capped  bool
+	}{
+		{name: "unknown bitrate", left: 1 << 30, want: bufferDefault},
+		{name: "unknown bitrate end of file", left: mb, want: mb},
+		{name: "speed equals rate", bitRate: 8 * mb, speed: mb, left: 1 << 30, want: bufferSeconds * mb},
+		{name: "speed above rate", bitRate: 8 * mb, speed: 4 * mb, left: 1 << 30, want: bufferSeconds * mb},
+		// download falls behind by half of rate, half of the rest is buffered
+		{name: "speed below rate", bitRate: 8 * mb, speed: mb / 2, left: 1000 * mb, want: 500 * mb},
+		{name: "speed below rate short rest", bitRate: 8 * mb, speed: mb / 2, left: 4 * mb, want: 4 * mb},
+		{name: "no speed", bitRate: 8 * mb, left: 1000 * mb, want: 1000 * mb},
+		{name: "capped by cache", bitRate: 8 * mb, speed: mb / 2, left: 1000 * mb, limit: 200 * mb, want: 200 * mb, capped: true},
+		{name: "under cache limit", bitRate: 8 * mb, speed: 4 * mb, left: 1000 * mb, limit: 200 * mb, want: bufferSeconds * mb},
+		{name: "rest under cache limit", bitRate: 8 * mb, speed: mb / 2, left: 100 * mb, limit: 80 * mb, want: 50 * mb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, capped := bufferTarget(tt.bitRate, tt.speed, tt.left, tt.limit)
+			if target != tt.want || capped != tt.capped {
+				t.Fatalf("target %d capped %v, want %d %v", target, capped, tt.want, tt.capped)
+			}
+		})
+	}
+}
+
+func TestBufferStatusCapped(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	spec, data := testSpec(t, 64*testPieceLength)
+	torr := addTestTorrent(t, bt, spec)
+	fillPieces(torr, data, 0, 1)
+	file := torr.Files()[0]
+	// a second of media is the whole file
+	torr.SetMediaInfo(file.Path(), 64*testPieceLength*8, 0)
+
+	st := torr.bufferStatus(file, 0, 0)
+	limit := int64(8*testPieceLength) * int64(settings.BTsets.ReaderReadAHead) / 100
+	if !st.Capped || st.Target != limit {
+		t.Fatalf("target %d capped %v, want %d true", st.Target, st.Capped, limit)
+	}
+	if st.Ready != 2*testPieceLength || st.Done {
+		t.Fatalf("ready %d done %v", st.Ready, st.Done)
+	}
+}
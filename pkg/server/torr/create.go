@@ -0,0 +1,460 @@
+package torr
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/storage/filestor"
+)
+
+const (
+	createMinPieceLength = 16 << 10
+	createMaxPieceLength = 16 << 20 // bigger pieces don't fit the stream cache
+	createMaxWorkers     = 8
+	createProgressTick   = 500 * time.Millisecond
+)
+
+var ErrCreateCancelled = errors.New("torrent creation cancelled")
+
+// CreateOptions describes torrent created from local files
+type CreateOptions struct {
+	Path        string     // file or directory
+	Output      string     // .torrent file or directory for it, empty - not written
+	Trackers    [][]string // tiers
+	WebSeeds    []string
+	Private     bool
+	Comment     string
+	PieceLength int64 // 0 - chosen by total size
+	Seed        bool  // add torrent into library and seed it from Path
+	Title       string
+	Category    string
+}
+
+// createJob is a running creation, progress is changed by hashing workers
+type createJob struct {
+	cancel context.CancelFunc
+	p      state.CreateProgress
+	hashed atomic.Int64
+	mu     sync.Mutex
+}
+
+var (
+	createJobs   = make(map[string]*createJob)
+	muCreateJobs sync.Mutex
+)
+
+type createFile struct {
+	path   string
+	offset int64
+	length int64
+}
+
+func (j *createJob) update(fn func(p *state.CreateProgress)) {
+	j.mu.Lock()
+	fn(&j.p)
+	j.mu.Unlock()
+}
+
+func (j *createJob) progress() *state.CreateProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	p := j.p
+	p.Hashed = j.hashed.Load()
+	return &p
+}
+
+func (j *createJob) publish() {
+	publish(&CreateProgressEvent{CreateProgress: j.progress()})
+}
+
+// CreateTorrent hashes files, writes .torrent and starts seeding if asked,
+// it returns when torrent is created, progress is published with CreateProgressEvent
+func CreateTorrent(ctx context.Context, opts CreateOptions) (*metainfo.MetaInfo, error) {
+	root, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCreateOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	job := &createJob{cancel: cancel}
+	job.p.Path = root
+	job.p.Started = time.Now().Unix()
+	muCreateJobs.Lock()
+	if _, ok := createJobs[root]; ok {
+		muCreateJobs.Unlock()
+		return nil, fmt.Errorf("torrent is already being created from %s", root)
+	}
+	createJobs[root] = job
+	muCreateJobs.Unlock()
+	defer func() {
+		muCreateJobs.Lock()
+		delete(createJobs, root)
+		muCreateJobs.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		tick := time.NewTicker(createProgressTick)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				job.publish()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	mi, err := job.create(ctx, root, &opts)
+	close(done)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ErrCreateCancelled
+		}
+		job.update(func(p *state.CreateProgress) { p.Error = err.Error() })
+		log.TLogln("Error create torrent from", root+":", err)
+	} else {
+		job.update(func(p *state.CreateProgress) { p.Done = true })
+		log.TLogln("Torrent created from", root, mi.HashInfoBytes().HexString())
+	}
+	job.publish()
+	return mi, err
+}
+
+// CancelCreate stops creation of torrent from path
+func CancelCreate(path string) error {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	muCreateJobs.Lock()
+	defer muCreateJobs.Unlock()
+	job, ok := createJobs[root]
+	if !ok {
+		return fmt.Errorf("torrent is not being created from %s", root)
+	}
+	job.cancel()
+	return nil
+}
+
+// CreateProgress returns progress of running creation or nil
+func CreateProgress(path string) *state.CreateProgress {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	muCreateJobs.Lock()
+	job := createJobs[root]
+	muCreateJobs.Unlock()
+	if job == nil {
+		return nil
+	}
+	return job.progress()
+}
+
+func checkCreateOptions(opts *CreateOptions) error {
+	if opts.PieceLength != 0 && (opts.PieceLength < createMinPieceLength || opts.PieceLength > createMaxPieceLength ||
+		opts.PieceLength&(opts.PieceLength-1) != 0) {
+		return fmt.Errorf("piece length must be a power of two from %d to %d", createMinPieceLength, createMaxPieceLength)
+	}
+	var tiers [][]string
+	for _, tier := range opts.Trackers {
+		var list []string
+		for _, u := range tier {
+			if u = strings.TrimSpace(u); u == "" {
+				continue
+			}
+			if err := validTrackerURL(u); err != nil {
+				return err
+			}
+			list = append(list, u)
+		}
+		if len(list) > 0 {
+			tiers = append(tiers, list)
+		}
+	}
+	opts.Trackers = tiers
+	var seeds []string
+	for _, u := range opts.WebSeeds {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		pu, err := url.Parse(u)
+		if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+			return fmt.Errorf("wrong web seed url: %s", u)
+		}
+		seeds = append(seeds, u)
+	}
+	opts.WebSeeds = seeds
+	if opts.Seed && bts == nil {
+		return errors.New("BT client not connected")
+	}
+	return nil
+}
+
+func (j *createJob) create(ctx context.Context, root string, opts *CreateOptions) (*metainfo.MetaInfo, error) {
+	info, files, err := createInfo(root)
+	if err != nil {
+		return nil, err
+	}
+	total := info.TotalLength()
+	info.PieceLength = opts.PieceLength
+	if info.PieceLength == 0 {
+		info.PieceLength = min(metainfo.ChoosePieceLength(total), createMaxPieceLength)
+	}
+	if opts.Private {
+		private := true
+		info.Private = &private
+	}
+	j.update(func(p *state.CreateProgress) {
+		p.Name = info.Name
+		p.Files = len(files)
+		p.PieceLength = info.PieceLength
+		p.Pieces = int((total + info.PieceLength - 1) / info.PieceLength)
+		p.Total = total
+	})
+	j.publish()
+
+	info.Pieces, err = hashPieces(ctx, files, total, info.PieceLength, &j.hashed)
+	if err != nil {
+		return nil, err
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	mi := &metainfo.MetaInfo{
+		InfoBytes:    infoBytes,
+		AnnounceList: opts.Trackers,
+		UrlList:      opts.WebSeeds,
+		Comment:      opts.Comment,
+		CreatedBy:    createdBy,
+		CreationDate: time.Now().Unix(),
+	}
+	if len(mi.AnnounceList) > 0 {
+		mi.Announce = mi.AnnounceList[0][0]
+	}
+	j.update(func(p *state.CreateProgress) { p.Hash = mi.HashInfoBytes().HexString() })
+
+	if opts.Output != "" {
+		out, err := writeMetaInfo(mi, opts.Output)
+		if err != nil {
+			return nil, err
+		}
+		j.update(func(p *state.CreateProgress) { p.Output = out })
+	}
+	if opts.Seed {
+		if err := seedCreated(mi, info, root, opts); err != nil {
+			return nil, err
+		}
+		j.update(func(p *state.CreateProgress) { p.Seeding = true })
+	}
+	return mi, nil
+}
+
+// createInfo lists files of root in the order of torrent, pieces are not hashed yet
+func createInfo(root string) (*metainfo.Info, []createFile, error) {
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &metainfo.Info{Name: filepath.Base(root)}
+	if !fi.IsDir() {
+		if !fi.Mode().IsRegular() {
+			return nil, nil, fmt.Errorf("not a regular file: %s", root)
+		}
+		info.Length = fi.Size()
+		return info, []createFile{{path: root, length: fi.Size()}}, nil
+	}
+
+	var paths []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil, fmt.Errorf("no files in %s", root)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return filepath.ToSlash(paths[i]) < filepath.ToSlash(paths[j])
+	})
+
+	var files []createFile
+	var offset int64
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.Files = append(info.Files, metainfo.FileInfo{
+			Path:   strings.Split(filepath.ToSlash(rel), "/"),
+			Length: fi.Size(),
+		})
+		files = append(files, createFile{path: path, offset: offset, length: fi.Size()})
+		offset += fi.Size()
+	}
+	return info, files, nil
+}
+
+// hashPieces hashes pieces of files in parallel, hashed counts processed bytes
+func hashPieces(ctx context.Context, files []createFile, total, pieceLength int64, hashed *atomic.Int64) ([]byte, error) {
+	count := int((total + pieceLength - 1) / pieceLength)
+	pieces := make([]byte, count*sha1.Size)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ids := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		firstErr error
+		muErr    sync.Mutex
+	)
+	workers := min(runtime.NumCPU(), createMaxWorkers, max(count, 1))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &createReader{files: files}
+			defer r.close()
+			buf := make([]byte, pieceLength)
+			for id := range ids {
+				off := int64(id) * pieceLength
+				b := buf[:min(pieceLength, total-off)]
+				if err := r.readAt(b, off); err != nil {
+					muErr.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					muErr.Unlock()
+					cancel()
+					continue
+				}
+				sum := sha1.Sum(b)
+				copy(pieces[id*sha1.Size:], sum[:])
+				hashed.Add(int64(len(b)))
+			}
+		}()
+	}
+feed:
+	for id := 0; id < count; id++ {
+		select {
+		case ids <- id:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(ids)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return pieces, nil
+}
+
+// createReader reads range of torrent from files, last opened file is kept open
+type createReader struct {
+	files []createFile
+	path  string
+	f     *os.File
+}
+
+func (r *createReader) readAt(b []byte, off int64) error {
+	end := off + int64(len(b))
+	for _, cf := range r.files {
+		if cf.offset+cf.length <= off || cf.offset >= end || cf.length == 0 {
+			continue
+		}
+		start := max(off, cf.offset)
+		stop := min(end, cf.offset+cf.length)
+		if r.path != cf.path {
+			r.close()
+			f, err := os.Open(cf.path)
+			if err != nil {
+				return err
+			}
+			r.f, r.path = f, cf.path
+		}
+		_, err := r.f.ReadAt(b[start-off:stop-off], start-cf.offset)
+		if err == io.EOF {
+			return fmt.Errorf("file is changed while hashing: %s", cf.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *createReader) close() {
+	if r.f != nil {
+		r.f.Close()
+		r.f, r.path = nil, ""
+	}
+}
+
+// seedCreated adds created torrent into library, it is seeded from the files it was created from
+func seedCreated(mi *metainfo.MetaInfo, info *metainfo.Info, root string, opts *CreateOptions) error {
+	dir := filepath.Dir(root)
+	hash := mi.HashInfoBytes()
+	// files are just hashed, keep storage needn't check them again
+	if err := filestor.NewStorage(dir).SetCompleted(hash, info.NumPieces()); err != nil {
+		return err
+	}
+	title := opts.Title
+	if title == "" {
+		title = info.Name
+	}
+	tor, err := AddTorrent(torrent.TorrentSpecFromMetaInfo(mi), title, "", "", opts.Category)
+	if err != nil {
+		return err
+	}
+	tor.SetOrigin(mi)
+	if err := tor.AddWebSeeds(opts.WebSeeds); err != nil {
+		return err
+	}
+	if err := tor.seedFiles(dir); err != nil {
+		return err
+	}
+	saveKeepState(tor)
+	return nil
+}
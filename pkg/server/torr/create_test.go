@@ -0,0 +1,137 @@
+package torr
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// writeCreateTestFiles writes files of sizes under root, the sizes don't match pieces
+func writeCreateTestFiles(t *testing.T, root string, files map[string]int) {
+	t.Helper()
+	for name, size := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, size)
+		rand.Read(data)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateTorrentPieces(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "movie")
+	writeCreateTestFiles(t, dir, map[string]int{
+		"a.mkv":           3<<20 + 12345,
+		"Subs/b.srt":      40000,
+		"Subs/c.srt":      1,
+		"empty.txt":       0,
+		"Extras/d/e.mp4":  1<<20 - 7,
+		"Extras/d/f.nfo":  777,
+		"Z last file.txt": 65536,
+	})
+	single := filepath.Join(t.TempDir(), "single.bin")
+	writeCreateTestFiles(t, filepath.Dir(single), map[string]int{"single.bin": 100000})
+
+	tests := []struct {
+		name        string
+		path        string
+		pieceLength int64
+	}{
+		{name: "automatic piece length", path: dir},
+		{name: "many pieces", path: dir, pieceLength: createMinPieceLength},
+		{name: "single file", path: single},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mi, err := CreateTorrent(context.Background(), CreateOptions{Path: tt.path, PieceLength: tt.pieceLength})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := mi.UnmarshalInfo()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := metainfo.Info{PieceLength: tt.pieceLength}
+			if err = want.BuildFromFilePath(tt.path); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != want.Name || got.Length != want.Length || got.PieceLength != want.PieceLength {
+				t.Fatalf("info %s %d %d, want %s %d %d", got.Name, got.Length, got.PieceLength, want.Name, want.Length, want.PieceLength)
+			}
+			if !slices.EqualFunc(got.Files, want.Files, func(a, b metainfo.FileInfo) bool {
+				return a.Length == b.Length && slices.Equal(a.Path, b.Path)
+			}) {
+				t.Fatalf("files %v, want %v", got.Files, want.Files)
+			}
+			if !bytes.Equal(got.Pieces, want.Pieces) {
+				t.Fatalf("%d pieces differ from %d pieces of metainfo", got.NumPieces(), want.NumPieces())
+			}
+		})
+	}
+}
+
+func TestCreateTorrentCancel(t *testing.T) {
+	// sparse file is hashed long enough to be cancelled
+	path := filepath.Join(t.TempDir(), "big.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 4 << 30
+	if err = f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := CreateTorrent(context.Background(), CreateOptions{Path: path, PieceLength: createMinPieceLength})
+		done <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for p := CreateProgress(path); p == nil || p.Hashed == 0; p = CreateProgress(path) {
+		if time.Now().After(deadline) {
+			t.Fatal("hashing isn't started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err = CancelCreate(path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hashing isn't stopped")
+	}
+	if !errors.Is(err, ErrCreateCancelled) {
+		t.Fatalf("err %v, want %v", err, ErrCreateCancelled)
+	}
+	if p := CreateProgress(path); p != nil {
+		t.Fatal("cancelled creation is in progress")
+	}
+
+	// workers stop taking pieces when context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var hashed atomic.Int64
+	files := []createFile{{path: path, length: size}}
+	if _, err = hashPieces(ctx, files, size, createMinPieceLength, &hashed); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err %v, want %v", err, context.Canceled)
+	}
+	if n := hashed.Load(); n >= size {
+		t.Fatalf("hashed %d bytes of cancelled torrent", n)
+	}
+}
@@ -2,11 +2,15 @@ package torr
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
 
 	"github.com/german2285/TorrPlayer/pkg/server/settings"
 	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
 	"github.com/german2285/TorrPlayer/pkg/server/torr/utils"
+	utils2 "github.com/german2285/TorrPlayer/pkg/server/utils"
 
+	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/metainfo"
 )
 
@@ -41,8 +45,21 @@ func AddTorrentDB(torr *Torrent) {
 	}
 	// don't override timestamp from DB on edit
 	t.Timestamp = torr.Timestamp // time.Now().Unix()
+	t.DownloadLimit = torr.DownloadLimit
+	t.UploadLimit = torr.UploadLimit
+	t.Priority = int(torr.Priority)
+	t.Keep = torr.KeepState
+	t.Retrackers = torr.RetrackersMode
+	t.WebSeeds = torr.webSeedURLs()
+	t.CreationDate = torr.CreationDate
+	t.Comment = torr.Comment
+	t.Unwanted, t.SelectOnly = torr.selection()
+	t.Seed = torr.SeedPolicy
+	t.Uploaded, t.Downloaded = torr.totals()
+	t.SeedSeconds = torr.SeedSeconds
 
 	settings.AddTorrent(t)
+	torr.saveMetainfo()
 }
 
 func GetTorrentDB(hash metainfo.Hash) *Torrent {
@@ -57,7 +74,21 @@ func GetTorrentDB(hash metainfo.Hash) *Torrent {
 			torr.Timestamp = db.Timestamp
 			torr.Size = db.Size
 			torr.Data = db.Data
-			torr.Stat = state.TorrentInDB
+			torr.DownloadLimit = db.DownloadLimit
+			torr.UploadLimit = db.UploadLimit
+			torr.Priority = state.TorrentPriority(db.Priority)
+			torr.KeepState = db.Keep
+			torr.RetrackersMode = db.Retrackers
+			torr.WebSeeds = db.WebSeeds
+			torr.Unwanted = db.Unwanted
+			torr.SelectOnly = db.SelectOnly
+			torr.CreationDate = db.CreationDate
+			torr.Comment = db.Comment
+			torr.SeedPolicy = db.Seed
+			torr.Uploaded = db.Uploaded
+			torr.Downloaded = db.Downloaded
+			torr.SeedSeconds = db.SeedSeconds
+			torr.stat = state.TorrentInDB
 			return torr
 		}
 	}
@@ -66,6 +97,38 @@ func GetTorrentDB(hash metainfo.Hash) *Torrent {
 
 func RemTorrentDB(hash metainfo.Hash) {
 	settings.RemTorrent(hash)
+	settings.RemMetainfo(hash.HexString())
+}
+
+// GetMetainfoDB returns saved info of torrent or nil if metadata was never downloaded
+func GetMetainfoDB(hash metainfo.Hash) *metainfo.Info {
+	buf := settings.GetMetainfo(hash.HexString())
+	if len(buf) == 0 {
+		return nil
+	}
+	info := new(metainfo.Info)
+	if err := bencode.Unmarshal(buf, info); err != nil {
+		return nil
+	}
+	return info
+}
+
+// infoFileStats returns files of info, same order and ids as in torrent status
+func infoFileStats(info *metainfo.Info) []*state.TorrentFileStat {
+	var ret []*state.TorrentFileStat
+	for _, fi := range info.UpvertedFiles() {
+		ret = append(ret, &state.TorrentFileStat{
+			Path:   strings.Join(append([]string{info.BestName()}, fi.BestPath()...), "/"),
+			Length: fi.Length,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return utils2.CompareStrings(ret[i].Path, ret[j].Path)
+	})
+	for i, f := range ret {
+		f.Id = i + 1 // in web id 0 is undefined
+	}
+	return ret
 }
 
 func ListTorrentsDB() map[metainfo.Hash]*Torrent {
@@ -80,7 +143,21 @@ func ListTorrentsDB() map[metainfo.Hash]*Torrent {
 		torr.Timestamp = db.Timestamp
 		torr.Size = db.Size
 		torr.Data = db.Data
-		torr.Stat = state.TorrentInDB
+		torr.DownloadLimit = db.DownloadLimit
+		torr.UploadLimit = db.UploadLimit
+		torr.Priority = state.TorrentPriority(db.Priority)
+		torr.KeepState = db.Keep
+		torr.RetrackersMode = db.Retrackers
+		torr.WebSeeds = db.WebSeeds
+		torr.Unwanted = db.Unwanted
+		torr.SelectOnly = db.SelectOnly
+		torr.CreationDate = db.CreationDate
+		torr.Comment = db.Comment
+		torr.SeedPolicy = db.Seed
+		torr.Uploaded = db.Uploaded
+		torr.Downloaded = db.Downloaded
+		torr.SeedSeconds = db.SeedSeconds
+		torr.stat = state.TorrentInDB
 		ret[torr.TorrentSpec.InfoHash] = torr
 	}
 	return ret
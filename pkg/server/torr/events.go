@@ -0,0 +1,224 @@
+package torr
+
+import (
+	"sync"
+
+	"github.com/german2285/TorrPlayer/pkg/server/torr/health"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+// Event is a torrent lifecycle event published on the event bus
+type Event interface {
+	// EventName is the event name, e.g. "torrent:added"
+	EventName() string
+	// EventHash is the hex infohash of the torrent
+	EventHash() string
+}
+
+type TorrentAddedEvent struct {
+	Hash  string `json:"hash"`
+	Title string `json:"title"`
+}
+
+type MetadataReceivedEvent struct {
+	Hash      string `json:"hash"`
+	Name      string `json:"name"`
+	Peers     int    `json:"peers"`
+	Seeders   int    `json:"seeders"`
+	FileCount int    `json:"fileCount"`
+	TotalSize int64  `json:"totalSize"`
+}
+
+// MetadataProgressEvent is published while metadata is fetched and when the fetch failed
+type MetadataProgressEvent struct {
+	Hash string `json:"hash"`
+	*state.MetadataProgress
+}
+
+type StateChangedEvent struct {
+	Hash string            `json:"hash"`
+	From state.TorrentStat `json:"from"`
+	To   state.TorrentStat `json:"to"`
+	Stat string            `json:"stat"`
+}
+
+type PreloadProgressEvent struct {
+	Hash           string  `json:"hash"`
+	PreloadedBytes int64   `json:"preloadedBytes"`
+	PreloadSize    int64   `json:"preloadSize"`
+	DownloadSpeed  float64 `json:"downloadSpeed"`
+}
+
+type PieceCompletedEvent struct {
+	Hash  string `json:"hash"`
+	Piece int    `json:"piece"`
+}
+
+type ReaderOpenedEvent struct {
+	Hash    string `json:"hash"`
+	Path    string `json:"path"`
+	Readers int    `json:"readers"`
+}
+
+type ReaderClosedEvent struct {
+	Hash    string `json:"hash"`
+	Path    string `json:"path"`
+	Readers int    `json:"readers"`
+}
+
+type TorrentClosedEvent struct {
+	Hash    string `json:"hash"`
+	Expired bool   `json:"expired"` // closed by disconnect timeout
+}
+
+type KeepProgressEvent struct {
+	Hash      string `json:"hash"`
+	Path      string `json:"path"`
+	Completed int64  `json:"completed"`
+	Total     int64  `json:"total"`
+	Paused    bool   `json:"paused"`
+	Done      bool   `json:"done"`
+}
+
+type ExportProgressEvent struct {
+	Hash    string `json:"hash"`
+	Path    string `json:"path"` // file in torrent
+	Dest    string `json:"dest"`
+	Written int64  `json:"written"`
+	Total   int64  `json:"total"`
+	Done    bool   `json:"done"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthEvent is published when swarm health of torrent was probed
+type HealthEvent struct {
+	*health.Health
+}
+
+// PeerBannedEvent is published when smart ban blocked a peer sending corrupt pieces
+type PeerBannedEvent struct {
+	Hash   string `json:"hash"`
+	Addr   string `json:"addr"`
+	Reason string `json:"reason"`
+}
+
+// CreateProgressEvent is published while torrent is created from local files
+type CreateProgressEvent struct {
+	*state.CreateProgress
+}
+
+// BufferProgressEvent is published while file is buffered before playback
+type BufferProgressEvent struct {
+	*state.BufferStatus
+}
+
+// NetInterfaceEvent is published when bound interface goes up or down
+type NetInterfaceEvent struct {
+	*state.NetInterface
+}
+
+func (e *TorrentAddedEvent) EventName() string     { return "torrent:added" }
+func (e *MetadataReceivedEvent) EventName() string { return "torrent:metadata" }
+func (e *MetadataProgressEvent) EventName() string { return "torrent:metadataProgress" }
+func (e *StateChangedEvent) EventName() string     { return "torrent:state" }
+func (e *PreloadProgressEvent) EventName() string  { return "torrent:preload" }
+func (e *PieceCompletedEvent) EventName() string   { return "torrent:piece" }
+func (e *ReaderOpenedEvent) EventName() string     { return "torrent:readerOpened" }
+func (e *ReaderClosedEvent) EventName() string     { return "torrent:readerClosed" }
+func (e *TorrentClosedEvent) EventName() string    { return "torrent:closed" }
+func (e *KeepProgressEvent) EventName() string     { return "torrent:keep" }
+func (e *ExportProgressEvent) EventName() string   { return "torrent:export" }
+func (e *HealthEvent) EventName() string           { return "torrent:health" }
+func (e *PeerBannedEvent) EventName() string       { return "peer:banned" }
+func (e *NetInterfaceEvent) EventName() string     { return "network:interface" }
+func (e *CreateProgressEvent) EventName() string   { return "torrent:create" }
+func (e *BufferProgressEvent) EventName() string   { return "buffer:progress" }
+
+func (e *TorrentAddedEvent) EventHash() string     { return e.Hash }
+func (e *MetadataReceivedEvent) EventHash() string { return e.Hash }
+func (e *MetadataProgressEvent) EventHash() string { return e.Hash }
+func (e *StateChangedEvent) EventHash() string     { return e.Hash }
+func (e *PreloadProgressEvent) EventHash() string  { return e.Hash }
+func (e *PieceCompletedEvent) EventHash() string   { return e.Hash }
+func (e *ReaderOpenedEvent) EventHash() string     { return e.Hash }
+func (e *ReaderClosedEvent) EventHash() string     { return e.Hash }
+func (e *TorrentClosedEvent) EventHash() string    { return e.Hash }
+func (e *KeepProgressEvent) EventHash() string     { return e.Hash }
+func (e *ExportProgressEvent) EventHash() string   { return e.Hash }
+func (e *HealthEvent) EventHash() string           { return e.Hash }
+func (e *PeerBannedEvent) EventHash() string       { return e.Hash }
+func (e *NetInterfaceEvent) EventHash() string     { return "" }
+func (e *CreateProgressEvent) EventHash() string   { return e.Hash }
+func (e *BufferProgressEvent) EventHash() string   { return e.Hash }
+
+// Subscription receives events from the bus until closed
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	bus     *EventBus
+	dropped int64
+}
+
+// Dropped returns count of events lost because the subscriber was too slow
+func (s *Subscription) Dropped() int64 {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
+
+// Close unsubscribes and closes C
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
+
+// EventBus delivers events to all subscribers without blocking publishers,
+// events are dropped for subscribers with full buffers
+type EventBus struct {
+	subs map[*Subscription]struct{}
+	mu   sync.Mutex
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*Subscription]struct{})}
+}
+
+func (b *EventBus) Subscribe(buffer int) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, bus: b}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *EventBus) Publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+var events = NewEventBus()
+
+// SubscribeEvents subscribes to torrent lifecycle events of all torrents
+func SubscribeEvents(buffer int) *Subscription {
+	return events.Subscribe(buffer)
+}
+
+func publish(ev Event) {
+	events.Publish(ev)
+}
@@ -0,0 +1,84 @@
+package torr
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// ExportFile copies file of torrent to dest, progress is published with ExportProgressEvent
+func (t *Torrent) ExportFile(ctx context.Context, file *torrent.File, dest string) (err error) {
+	hash := t.Hash().HexString()
+	total := file.Length()
+	var written int64
+	defer func() {
+		ev := &ExportProgressEvent{
+			Hash:    hash,
+			Path:    file.Path(),
+			Dest:    dest,
+			Written: written,
+			Total:   total,
+			Done:    err == nil,
+		}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		publish(ev)
+	}()
+
+	if !t.GotInfo() {
+		return ErrTorrentClosed
+	}
+	if err = os.MkdirAll(filepath.Dir(dest), 0o777); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dest)
+		}
+	}()
+
+	reader := t.NewReader(file)
+	if reader == nil {
+		return ErrTorrentClosed
+	}
+	defer t.CloseReader(reader)
+	reader.SetResponsive()
+
+	buf := make([]byte, 1<<20)
+	last := time.Now()
+	for written < total {
+		n, rerr := reader.ReadContext(ctx, buf)
+		if n > 0 {
+			if _, err = out.Write(buf[:n]); err != nil {
+				return err
+			}
+			written += int64(n)
+		}
+		if rerr == io.EOF && written >= total {
+			break
+		}
+		if rerr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return rerr
+		}
+		if time.Since(last) > time.Second/2 {
+			last = time.Now()
+			publish(&ExportProgressEvent{Hash: hash, Path: file.Path(), Dest: dest, Written: written, Total: total})
+		}
+	}
+	return nil
+}
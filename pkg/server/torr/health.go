@@ -0,0 +1,159 @@
+package torr
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/health"
+)
+
+const (
+	healthProbeTimeout = 20 * time.Second
+	healthDHTTimeout   = 10 * time.Second
+	// interval of refreshing health of library torrents
+	healthInterval = 30 * time.Minute
+	// probes running at the same time in the monitor
+	healthParallel = 3
+)
+
+var (
+	healthCache   = make(map[metainfo.Hash]*health.Health)
+	muHealth      sync.Mutex
+	healthMonitor sync.Once
+)
+
+// ProbeHealth scrapes trackers of torrent and counts DHT peers, result is cached and published as HealthEvent
+func ProbeHealth(ctx context.Context, spec *torrent.TorrentSpec) *health.Health {
+	if bts != nil && bts.NetworkPaused() {
+		return &health.Health{Hash: spec.InfoHash.HexString(), Badge: health.BadgeUnknown}
+	}
+	h := health.Probe(ctx, spec.InfoHash, probeTrackers(spec), countDHTPeers, healthProbeTimeout)
+	muHealth.Lock()
+	healthCache[spec.InfoHash] = h
+	muHealth.Unlock()
+	publish(&HealthEvent{h})
+	return h
+}
+
+// GetHealth returns last probed health of torrent or nil
+func GetHealth(hashHex string) *health.Health {
+	hash := metainfo.NewHashFromHex(hashHex)
+	muHealth.Lock()
+	defer muHealth.Unlock()
+	return healthCache[hash]
+}
+
+// probeTrackers returns scrapable trackers of torrent like the torrent announces them
+func probeTrackers(spec *torrent.TorrentSpec) []string {
+	mode := settings.BTsets.RetrackersMode
+	if db := GetTorrentDB(spec.InfoHash); db != nil && db.RetrackersMode != nil {
+		mode = *db.RetrackersMode
+	}
+	var ret []string
+	for _, tr := range trackerList(spec.Trackers, mode) {
+		if strings.HasPrefix(tr.URL, "http") || strings.HasPrefix(tr.URL, "udp") {
+			ret = append(ret, tr.URL)
+		}
+	}
+	return ret
+}
+
+// countDHTPeers counts unique peers answered to get_peers, node doesn't announce itself
+func countDHTPeers(ctx context.Context, hash metainfo.Hash) int {
+	if bts == nil {
+		return 0
+	}
+	client := bts.getClient()
+	if client == nil {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthDHTTimeout)
+	defer cancel()
+
+	peers := make(map[string]struct{})
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, s := range client.DhtServers() {
+		ann, err := s.Announce(hash, 0, false)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer ann.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case pv, ok := <-ann.Peers():
+					if !ok {
+						return
+					}
+					mu.Lock()
+					for _, p := range pv.Peers {
+						peers[p.String()] = struct{}{}
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return len(peers)
+}
+
+// StartHealthMonitor periodically refreshes health of torrents in the library
+func StartHealthMonitor() {
+	healthMonitor.Do(func() {
+		go func() {
+			for {
+				refreshHealth()
+				time.Sleep(time.Minute)
+			}
+		}()
+	})
+}
+
+// refreshHealth probes torrents with health older than healthInterval
+func refreshHealth() {
+	// trackers must not be requested outside of the bound interface
+	if bts != nil && bts.NetworkPaused() {
+		return
+	}
+	var stale []*torrent.TorrentSpec
+	for hash, tor := range ListTorrentsDB() {
+		muHealth.Lock()
+		h := healthCache[hash]
+		muHealth.Unlock()
+		if h != nil && time.Since(time.Unix(h.Checked, 0)) < healthInterval {
+			continue
+		}
+		if tor.TorrentSpec != nil {
+			stale = append(stale, tor.TorrentSpec)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	log.TLogln("refresh health of", len(stale), "torrents")
+	sem := make(chan struct{}, healthParallel)
+	var wg sync.WaitGroup
+	for _, spec := range stale {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			ProbeHealth(context.Background(), spec)
+		}()
+	}
+	wg.Wait()
+}
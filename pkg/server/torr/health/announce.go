@@ -0,0 +1,182 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/tracker"
+
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
+)
+
+// Announce is announce of torrent to tracker, it is sent from bound interface unlike announces of the client
+type Announce struct {
+	URL       string
+	Request   tracker.AnnounceRequest
+	ClientIP4 net.IP
+	ClientIP6 net.IP
+	UserAgent string
+}
+
+// Do sends announce to http(s) or udp tracker
+func (a Announce) Do(ctx context.Context) (tracker.AnnounceResponse, error) {
+	u, err := url.Parse(a.URL)
+	if err != nil {
+		return tracker.AnnounceResponse{}, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return a.announceHTTP(ctx, u)
+	case "udp", "udp4", "udp6":
+		return a.announceUDP(ctx, u)
+	}
+	return tracker.AnnounceResponse{}, tracker.ErrBadScheme
+}
+
+// the client doesn't verify certificates of trackers, many of them are self signed
+var announceClient = func() *http.Client {
+	c := proxy.TrackerClient(0)
+	c.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return c
+}()
+
+type httpAnnounceResponse struct {
+	FailureReason string                    `bencode:"failure reason"`
+	Interval      int32                     `bencode:"interval"`
+	Complete      int32                     `bencode:"complete"`
+	Incomplete    int32                     `bencode:"incomplete"`
+	Peers         tracker.Peers             `bencode:"peers"`
+	Peers6        krpc.CompactIPv6NodeAddrs `bencode:"peers6"` // BEP 7
+}
+
+func (a Announce) announceHTTP(ctx context.Context, u *url.URL) (tracker.AnnounceResponse, error) {
+	var ret tracker.AnnounceResponse
+	r := a.Request
+	q := u.Query()
+	q.Set("info_hash", string(r.InfoHash[:]))
+	q.Set("peer_id", string(r.PeerId[:]))
+	q.Set("port", strconv.Itoa(int(r.Port)))
+	q.Set("uploaded", strconv.FormatInt(r.Uploaded, 10))
+	q.Set("downloaded", strconv.FormatInt(r.Downloaded, 10))
+	q.Set("left", strconv.FormatUint(r.Left, 10))
+	if r.Event != tracker.None {
+		q.Set("event", r.Event.String())
+	}
+	q.Set("key", strconv.FormatUint(uint64(uint32(r.Key)), 16))
+	if r.NumWant >= 0 {
+		q.Set("numwant", strconv.Itoa(int(r.NumWant)))
+	}
+	q.Set("compact", "1")
+	q.Set("supportcrypto", "1")
+	if a.ClientIP4 != nil {
+		q.Set("ipv4", a.ClientIP4.String())
+	}
+	if a.ClientIP6 != nil {
+		q.Set("ipv6", a.ClientIP6.String())
+	}
+	au := *u
+	au.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, au.String(), nil)
+	if err != nil {
+		return ret, err
+	}
+	if a.UserAgent != "" {
+		req.Header.Set("User-Agent", a.UserAgent)
+	}
+	resp, err := announceClient.Do(req)
+	if err != nil {
+		return ret, err
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ret, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ret, fmt.Errorf("tracker response: %s", resp.Status)
+	}
+	var ar httpAnnounceResponse
+	if err = bencode.Unmarshal(buf, &ar); err != nil {
+		if _, ok := err.(bencode.ErrUnusedTrailingBytes); !ok {
+			return ret, fmt.Errorf("error decode announce: %v", err)
+		}
+	}
+	if ar.FailureReason != "" {
+		return ret, errors.New(ar.FailureReason)
+	}
+	ret.Interval = ar.Interval
+	ret.Seeders = ar.Complete
+	ret.Leechers = ar.Incomplete
+	ret.Peers = ar.Peers
+	for _, na := range ar.Peers6 {
+		ret.Peers = append(ret.Peers, tracker.Peer{}.FromNodeAddr(na))
+	}
+	return ret, nil
+}
+
+func (a Announce) announceUDP(ctx context.Context, u *url.URL) (tracker.AnnounceResponse, error) {
+	var ret tracker.AnnounceResponse
+	conn, connID, err := dialUDP(ctx, u)
+	if err != nil {
+		return ret, err
+	}
+	defer conn.Close()
+
+	r := a.Request
+	// peers are ipv6 addresses over ipv6, address of client is sent for ipv4 only
+	ipv6 := conn.RemoteAddr().(*net.UDPAddr).IP.To4() == nil
+	if ip := a.ClientIP4.To4(); ip != nil && !ipv6 {
+		r.IPAddress = binary.BigEndian.Uint32(ip)
+	} else {
+		r.IPAddress = 0
+	}
+	var req bytes.Buffer
+	tid := rand.Int31()
+	binary.Write(&req, binary.BigEndian, struct {
+		ConnectionID  int64
+		Action        int32
+		TransactionID int32
+	}{connID, udpAnnounce, tid})
+	binary.Write(&req, binary.BigEndian, r)
+	// url data of BEP 41, it is limited by 255 bytes
+	if uri := u.RequestURI(); len(uri) <= 255 {
+		req.Write([]byte{2, byte(len(uri))})
+		req.WriteString(uri)
+	}
+	resp, err := udpRequest(ctx, conn, req.Bytes(), udpAnnounce, tid, 12)
+	if err != nil {
+		return ret, err
+	}
+	ret.Interval = int32(binary.BigEndian.Uint32(resp[0:]))
+	ret.Leechers = int32(binary.BigEndian.Uint32(resp[4:]))
+	ret.Seeders = int32(binary.BigEndian.Uint32(resp[8:]))
+
+	var peers interface {
+		encoding.BinaryUnmarshaler
+		NodeAddrs() []krpc.NodeAddr
+	} = &krpc.CompactIPv4NodeAddrs{}
+	if ipv6 {
+		peers = &krpc.CompactIPv6NodeAddrs{}
+	}
+	if err = peers.UnmarshalBinary(resp[12:]); err != nil {
+		return ret, err
+	}
+	for _, na := range peers.NodeAddrs() {
+		ret.Peers = append(ret.Peers, tracker.Peer{}.FromNodeAddr(na))
+	}
+	return ret, nil
+}
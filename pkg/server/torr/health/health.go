@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// badges of swarm health
+const (
+	BadgeGood    = "good"
+	BadgeWeak    = "weak"
+	BadgeDead    = "dead"
+	BadgeUnknown = "unknown"
+)
+
+// seeders count of healthy swarm
+const goodSeeders = 5
+
+type TrackerResult struct {
+	URL       string `json:"url"`
+	Seeders   int    `json:"seeders"`
+	Leechers  int    `json:"leechers"`
+	Completed int    `json:"completed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Health of torrent swarm, counts are the best answer of trackers
+type Health struct {
+	Hash      string           `json:"hash"`
+	Seeders   int              `json:"seeders"`
+	Leechers  int              `json:"leechers"`
+	Completed int              `json:"completed"`
+	DHTPeers  int              `json:"dhtPeers"`
+	Trackers  []*TrackerResult `json:"trackers"`
+	Badge     string           `json:"badge"`
+	Checked   int64            `json:"checked"` // unix time
+}
+
+// PeerCounter counts peers of torrent, e.g. with DHT get_peers
+type PeerCounter func(ctx context.Context, hash metainfo.Hash) int
+
+// Probe scrapes all trackers in parallel and counts peers, probe lasts not longer than timeout
+func Probe(ctx context.Context, hash metainfo.Hash, trackers []string, peers PeerCounter, timeout time.Duration) *Health {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	h := &Health{Hash: hash.HexString()}
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for _, tr := range trackers {
+		if tr == "" || seen[tr] {
+			continue
+		}
+		seen[tr] = true
+		res := &TrackerResult{URL: tr}
+		h.Trackers = append(h.Trackers, res)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st, err := ScrapeTracker(ctx, res.URL, hash)
+			if err != nil {
+				res.Error = err.Error()
+				return
+			}
+			res.Seeders = st.Seeders
+			res.Leechers = st.Leechers
+			res.Completed = st.Completed
+		}()
+	}
+	if peers != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.DHTPeers = peers(ctx, hash)
+		}()
+	}
+	wg.Wait()
+
+	answered := false
+	for _, res := range h.Trackers {
+		if res.Error != "" {
+			continue
+		}
+		answered = true
+		h.Seeders = max(h.Seeders, res.Seeders)
+		h.Leechers = max(h.Leechers, res.Leechers)
+		h.Completed = max(h.Completed, res.Completed)
+	}
+	switch {
+	case h.Seeders >= goodSeeders:
+		h.Badge = BadgeGood
+	case h.Seeders > 0 || h.DHTPeers > 0:
+		h.Badge = BadgeWeak
+	case answered:
+		h.Badge = BadgeDead
+	default:
+		h.Badge = BadgeUnknown
+	}
+	h.Checked = time.Now().Unix()
+	return h
+}
+
+// Reachability of tracker
+type Reachability struct {
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Latency   int64  `json:"latency"` // in ms
+	Error     string `json:"error,omitempty"`
+}
+
+// CheckTrackers pings trackers, parallel pings at once
+func CheckTrackers(ctx context.Context, trackers []string, parallel int, timeout time.Duration) []*Reachability {
+	ret := make([]*Reachability, len(trackers))
+	sem := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for i, tr := range trackers {
+		ret[i] = &Reachability{URL: tr}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(r *Reachability) {
+			defer func() { <-sem; wg.Done() }()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			lat, err := Ping(ctx, r.URL)
+			if err != nil {
+				r.Error = err.Error()
+				return
+			}
+			r.Reachable = true
+			r.Latency = lat.Milliseconds()
+		}(ret[i])
+	}
+	wg.Wait()
+	return ret
+}
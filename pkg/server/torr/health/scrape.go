@@ -0,0 +1,246 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
+)
+
+var (
+	ErrScrapeNotSupported = errors.New("tracker doesn't support scrape")
+	ErrNoTorrent          = errors.New("tracker doesn't know torrent")
+)
+
+// Scrape is the answer of tracker about torrent
+type Scrape struct {
+	Seeders   int `json:"seeders"`
+	Leechers  int `json:"leechers"`
+	Completed int `json:"completed"`
+}
+
+// ScrapeTracker asks tracker with announce url about swarm of torrent, http(s) and udp trackers are supported
+func ScrapeTracker(ctx context.Context, announce string, hash metainfo.Hash) (*Scrape, error) {
+	u, err := url.Parse(announce)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return scrapeHTTP(ctx, u, hash)
+	case "udp", "udp4", "udp6":
+		return scrapeUDP(ctx, u, hash)
+	}
+	return nil, fmt.Errorf("unsupported tracker scheme: %s", u.Scheme)
+}
+
+// trackers are requested through proxy if it is set and from bound interface, timeouts are set by contexts
+var httpClient = proxy.TrackerClient(0)
+
+// scrapeURL converts announce url to scrape url, see BEP 48
+func scrapeURL(u *url.URL) (*url.URL, error) {
+	i := strings.LastIndex(u.Path, "/")
+	if i < 0 || !strings.HasPrefix(u.Path[i+1:], "announce") {
+		return nil, ErrScrapeNotSupported
+	}
+	ret := *u
+	ret.Path = u.Path[:i+1] + "scrape" + strings.TrimPrefix(u.Path[i+1:], "announce")
+	return &ret, nil
+}
+
+type httpScrapeResponse struct {
+	Files         map[string]httpScrapeFile `bencode:"files"`
+	FailureReason string                    `bencode:"failure reason"`
+}
+
+type httpScrapeFile struct {
+	Complete   int `bencode:"complete"`
+	Incomplete int `bencode:"incomplete"`
+	Downloaded int `bencode:"downloaded"`
+}
+
+func scrapeHTTP(ctx context.Context, u *url.URL, hash metainfo.Hash) (*Scrape, error) {
+	su, err := scrapeURL(u)
+	if err != nil {
+		return nil, err
+	}
+	q := su.Query()
+	q.Set("info_hash", string(hash[:]))
+	su.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, su.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracker response: %s", resp.Status)
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var sr httpScrapeResponse
+	if err := bencode.Unmarshal(buf, &sr); err != nil {
+		return nil, fmt.Errorf("error decode scrape: %v", err)
+	}
+	if sr.FailureReason != "" {
+		return nil, errors.New(sr.FailureReason)
+	}
+	f, ok := sr.Files[string(hash[:])]
+	if !ok {
+		return nil, ErrNoTorrent
+	}
+	return &Scrape{Seeders: f.Complete, Leechers: f.Incomplete, Completed: f.Downloaded}, nil
+}
+
+// udp tracker protocol, see BEP 15
+const (
+	udpProtocolID  = 0x41727101980
+	udpConnect     = 0
+	udpAnnounce    = 1
+	udpScrape      = 2
+	udpError       = 3
+	udpTries       = 2
+	udpTryDuration = 5 * time.Second
+)
+
+// dialUDP dials udp tracker of url from bound interface and gets connection id
+func dialUDP(ctx context.Context, u *url.URL) (net.Conn, int64, error) {
+	if err := proxy.Direct(u.Host); err != nil {
+		return nil, 0, err
+	}
+	conn, err := proxy.DialContext(ctx, u.Scheme, u.Host)
+	if err != nil {
+		return nil, 0, err
+	}
+	var req bytes.Buffer
+	tid := rand.Int31()
+	binary.Write(&req, binary.BigEndian, struct {
+		ProtocolID    int64
+		Action        int32
+		TransactionID int32
+	}{udpProtocolID, udpConnect, tid})
+	resp, err := udpRequest(ctx, conn, req.Bytes(), udpConnect, tid, 8)
+	if err != nil {
+		conn.Close()
+		return nil, 0, err
+	}
+	return conn, int64(binary.BigEndian.Uint64(resp)), nil
+}
+
+func scrapeUDP(ctx context.Context, u *url.URL, hash metainfo.Hash) (*Scrape, error) {
+	conn, connID, err := dialUDP(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var req bytes.Buffer
+	tid := rand.Int31()
+	binary.Write(&req, binary.BigEndian, struct {
+		ConnectionID  int64
+		Action        int32
+		TransactionID int32
+		InfoHash      [20]byte
+	}{connID, udpScrape, tid, hash})
+	resp, err := udpRequest(ctx, conn, req.Bytes(), udpScrape, tid, 12)
+	if err != nil {
+		return nil, err
+	}
+	return &Scrape{
+		Seeders:   int(binary.BigEndian.Uint32(resp[0:])),
+		Completed: int(binary.BigEndian.Uint32(resp[4:])),
+		Leechers:  int(binary.BigEndian.Uint32(resp[8:])),
+	}, nil
+}
+
+// udpRequest sends request with retries and returns body of response with the action and transaction
+func udpRequest(ctx context.Context, conn net.Conn, req []byte, action, tid int32, minLen int) ([]byte, error) {
+	buf := make([]byte, 2048)
+	var lastErr error
+	for try := 0; try < udpTries; try++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(udpTryDuration)
+		if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+			deadline = dl
+		}
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if n < 8 || int32(binary.BigEndian.Uint32(buf[4:])) != tid {
+				// answer to other request
+				continue
+			}
+			switch int32(binary.BigEndian.Uint32(buf)) {
+			case action:
+				if n-8 < minLen {
+					return nil, errors.New("short tracker response")
+				}
+				return buf[8:n], nil
+			case udpError:
+				return nil, errors.New(string(buf[8:n]))
+			default:
+				return nil, errors.New("unexpected tracker response")
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// Ping checks that tracker answers, http tracker may answer with any status, udp tracker must answer to connect
+func Ping(ctx context.Context, announce string) (time.Duration, error) {
+	u, err := url.Parse(announce)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	switch u.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, announce, nil)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+	case "udp", "udp4", "udp6":
+		conn, _, err := dialUDP(ctx, u)
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+	default:
+		return 0, fmt.Errorf("unsupported tracker scheme: %s", u.Scheme)
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,220 @@
+package health
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
+)
+
+var (
+	testHash = metainfo.NewHashFromHex("0123456789abcdef0123456789abcdef01234567")
+	testPeer = tracker.Peer{IP: net.IPv4(10, 1, 2, 3), Port: 6881}
+)
+
+func TestScrapeHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tr/scrape" {
+			http.NotFound(w, r)
+			return
+		}
+		resp := map[string]any{"files": map[string]any{}}
+		if r.URL.Query().Get("info_hash") == string(testHash[:]) {
+			resp["files"] = map[string]any{
+				string(testHash[:]): map[string]int{"complete": 12, "incomplete": 5, "downloaded": 340},
+			}
+		}
+		buf, _ := bencode.Marshal(resp)
+		w.Write(buf)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	st, err := ScrapeTracker(ctx, srv.URL+"/tr/announce", testHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *st != (Scrape{Seeders: 12, Leechers: 5, Completed: 340}) {
+		t.Fatalf("wrong scrape: %+v", *st)
+	}
+
+	if _, err = ScrapeTracker(ctx, srv.URL+"/tr/announce", metainfo.Hash{}); err != ErrNoTorrent {
+		t.Fatalf("unknown torrent error: %v", err)
+	}
+	if _, err = ScrapeTracker(ctx, srv.URL+"/tr/ann", testHash); err != ErrScrapeNotSupported {
+		t.Fatalf("tracker without scrape error: %v", err)
+	}
+}
+
+// udpTracker answers connect, announce and scrape requests of BEP 15, announce gets one peer of family of tracker
+func udpTracker(t *testing.T, network, addr string) net.PacketConn {
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		t.Skip("no", network, "listener:", err)
+	}
+	go func() {
+		const connID = 0x1122334455667788
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 16 {
+				continue
+			}
+			action := binary.BigEndian.Uint32(buf[8:])
+			resp := binary.BigEndian.AppendUint32(nil, action)
+			resp = append(resp, buf[12:16]...)
+			switch action {
+			case udpConnect:
+				resp = binary.BigEndian.AppendUint64(resp, connID)
+			case udpScrape:
+				if binary.BigEndian.Uint64(buf) != connID || n < 36 || string(buf[16:36]) != string(testHash[:]) {
+					continue
+				}
+				resp = binary.BigEndian.AppendUint32(resp, 7)
+				resp = binary.BigEndian.AppendUint32(resp, 90)
+				resp = binary.BigEndian.AppendUint32(resp, 3)
+			case udpAnnounce:
+				if binary.BigEndian.Uint64(buf) != connID || n < 98 || string(buf[16:36]) != string(testHash[:]) {
+					continue
+				}
+				resp = binary.BigEndian.AppendUint32(resp, 1800)
+				resp = binary.BigEndian.AppendUint32(resp, 3)
+				resp = binary.BigEndian.AppendUint32(resp, 7)
+				if network == "udp4" {
+					resp = append(resp, testPeer.IP.To4()...)
+				} else {
+					resp = append(resp, testPeer.IP.To16()...)
+				}
+				resp = binary.BigEndian.AppendUint16(resp, uint16(testPeer.Port))
+			}
+			conn.WriteTo(resp, from)
+		}
+	}()
+	return conn
+}
+
+func TestScrapeUDP(t *testing.T) {
+	for _, tc := range []struct{ scheme, network, addr string }{
+		{"udp", "udp4", "127.0.0.1:0"},
+		{"udp4", "udp4", "127.0.0.1:0"},
+		{"udp6", "udp6", "[::1]:0"},
+	} {
+		t.Run(tc.scheme, func(t *testing.T) {
+			conn := udpTracker(t, tc.network, tc.addr)
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			announce := tc.scheme + "://" + conn.LocalAddr().String() + "/announce"
+			st, err := ScrapeTracker(ctx, announce, testHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *st != (Scrape{Seeders: 7, Leechers: 3, Completed: 90}) {
+				t.Fatalf("wrong scrape: %+v", *st)
+			}
+			if _, err = Ping(ctx, announce); err != nil {
+				t.Fatal(err)
+			}
+			res, err := Announce{URL: announce, Request: testRequest()}.Do(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkAnnounce(t, res)
+		})
+	}
+}
+
+func TestScrapeProxyOnly(t *testing.T) {
+	conn := udpTracker(t, "udp4", "127.0.0.1:0")
+	defer conn.Close()
+	proxy.Set(proxy.Config{URL: "socks5://127.0.0.1:1080", Only: true})
+	defer proxy.Set(proxy.Config{})
+
+	// udp can't go through proxy
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	announce := "udp://" + conn.LocalAddr().String() + "/announce"
+	if _, err := ScrapeTracker(ctx, announce, testHash); !errors.Is(err, proxy.ErrProxyOnly) {
+		t.Fatalf("udp scrape in proxy only mode: %v", err)
+	}
+	if _, err := Ping(ctx, announce); !errors.Is(err, proxy.ErrProxyOnly) {
+		t.Fatalf("udp ping in proxy only mode: %v", err)
+	}
+}
+
+func testRequest() tracker.AnnounceRequest {
+	return tracker.AnnounceRequest{InfoHash: testHash, Left: 100, Event: tracker.Started, NumWant: -1, Port: 6881}
+}
+
+func checkAnnounce(t *testing.T, res tracker.AnnounceResponse) {
+	t.Helper()
+	if res.Interval != 1800 || res.Seeders != 7 || res.Leechers != 3 {
+		t.Fatalf("wrong announce: %+v", res)
+	}
+	if len(res.Peers) != 1 || !res.Peers[0].IP.Equal(testPeer.IP) || res.Peers[0].Port != testPeer.Port {
+		t.Fatalf("wrong peers: %v", res.Peers)
+	}
+}
+
+func TestAnnounceHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("info_hash") != string(testHash[:]) || q.Get("event") != "started" || q.Get("left") != "100" ||
+			q.Get("compact") != "1" || q.Has("numwant") {
+			w.Write([]byte("d14:failure reason11:bad requeste"))
+			return
+		}
+		peers := append(testPeer.IP.To4(), byte(testPeer.Port>>8), byte(testPeer.Port))
+		buf, _ := bencode.Marshal(map[string]any{
+			"interval": 1800, "complete": 7, "incomplete": 3, "peers": string(peers),
+		})
+		w.Write(buf)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := Announce{URL: srv.URL + "/announce", Request: testRequest()}.Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAnnounce(t, res)
+
+	req := testRequest()
+	req.Event = tracker.None
+	if _, err = (Announce{URL: srv.URL + "/announce", Request: req}).Do(ctx); err == nil || err.Error() != "bad request" {
+		t.Fatalf("failure reason of tracker: %v", err)
+	}
+}
+
+func TestAnnounceBound(t *testing.T) {
+	conn := udpTracker(t, "udp4", "127.0.0.1:0")
+	defer conn.Close()
+	proxy.SetBind(net.IPv4(127, 0, 0, 2), nil)
+	defer proxy.SetBind(nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := (Announce{URL: "udp://" + conn.LocalAddr().String(), Request: testRequest()}).Do(ctx); err != nil {
+		t.Skip("loopback address can't be bound:", err)
+	}
+	// ipv6 tracker can't be reached from interface without ipv6 address
+	if _, err := (Announce{URL: "udp6://[::1]:6969", Request: testRequest()}).Do(ctx); err == nil {
+		t.Fatal("ipv6 tracker is announced from interface without ipv6")
+	}
+}
@@ -0,0 +1,90 @@
+package torr
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/anacrolix/torrent/iplist"
+)
+
+// ipFilter is the blocklist of the client, blocklist and bans are changed without client restart.
+// Peers are checked on connect, established connections are not closed by the client.
+type ipFilter struct {
+	blocklist iplist.Ranger
+	banned    map[string]string // ip -> reason
+	rejected  atomic.Int64
+	mu        sync.RWMutex
+}
+
+func newIPFilter() *ipFilter {
+	return &ipFilter{banned: make(map[string]string)}
+}
+
+func (f *ipFilter) Lookup(ip net.IP) (r iplist.Range, ok bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if reason, banned := f.banned[ip.String()]; banned {
+		r, ok = iplist.Range{First: ip, Last: ip, Description: reason}, true
+	} else if f.blocklist != nil {
+		r, ok = f.blocklist.Lookup(ip)
+	}
+	if ok {
+		f.rejected.Add(1)
+	}
+	return
+}
+
+// Rejected returns count of blocked lookups
+func (f *ipFilter) Rejected() int64 {
+	return f.rejected.Load()
+}
+
+func (f *ipFilter) NumRanges() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	n := len(f.banned)
+	if f.blocklist != nil {
+		n += f.blocklist.NumRanges()
+	}
+	return n
+}
+
+// SetBlocklist replaces blocklist, nil - no blocklist
+func (f *ipFilter) SetBlocklist(r iplist.Ranger) {
+	f.mu.Lock()
+	f.blocklist = r
+	f.mu.Unlock()
+}
+
+// Ban blocks ip, returns false if ip was banned already
+func (f *ipFilter) Ban(ip net.IP, reason string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.banned[ip.String()]; ok {
+		return false
+	}
+	f.banned[ip.String()] = reason
+	return true
+}
+
+func (f *ipFilter) Unban(ip net.IP) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.banned[ip.String()]; !ok {
+		return false
+	}
+	delete(f.banned, ip.String())
+	return true
+}
+
+// Banned returns banned ips with reasons
+func (f *ipFilter) Banned() map[string]string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	ret := make(map[string]string, len(f.banned))
+	for ip, reason := range f.banned {
+		ret[ip] = reason
+	}
+	return ret
+}
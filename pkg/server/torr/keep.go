@@ -0,0 +1,266 @@
+package torr
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+
+	"github.com/anacrolix/torrent"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/storage/filestor"
+)
+
+var ErrNotKept = errors.New("torrent is not in keep mode")
+
+// keepJob downloads files of torrent completely into keep storage,
+// the rolling cache reads pieces evicted from memory back from it
+type keepJob struct {
+	storage *filestor.Storage
+	torrent *filestor.Torrent
+	files   []*torrent.File
+	done    bool
+}
+
+func (j *keepJob) progress() (completed, total int64) {
+	for _, f := range j.files {
+		completed += j.torrent.BytesCompleted(f.Offset(), f.Length())
+		total += f.Length()
+	}
+	return
+}
+
+// Keep starts full download of files into dir with the layout of torrent, empty files - all files
+func (t *Torrent) Keep(dir string, files []string) error {
+	if dir == "" {
+		return errors.New("keep path is empty")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !t.GotInfo() {
+		return errors.New("torrent don't get info")
+	}
+	t.stopKeep()
+	t.muTorrent.Lock()
+	t.KeepState = &settings.KeepState{Path: dir, Files: files}
+	t.muTorrent.Unlock()
+	return t.applyKeep()
+}
+
+// seedFiles seeds torrent from files in dir the torrent was created from
+func (t *Torrent) seedFiles(dir string) error {
+	if !t.GotInfo() {
+		return errors.New("torrent don't get info")
+	}
+	t.stopKeep()
+	t.muTorrent.Lock()
+	t.KeepState = &settings.KeepState{Path: dir, Seed: true}
+	t.muTorrent.Unlock()
+	return t.applyKeep()
+}
+
+// PauseKeep stops full download, already downloaded files stay in keep storage
+func (t *Torrent) PauseKeep() error {
+	return t.setKeepPaused(true)
+}
+
+// ResumeKeep continues full download
+func (t *Torrent) ResumeKeep() error {
+	return t.setKeepPaused(false)
+}
+
+func (t *Torrent) setKeepPaused(paused bool) error {
+	t.muTorrent.Lock()
+	if t.KeepState == nil {
+		t.muTorrent.Unlock()
+		return ErrNotKept
+	}
+	ks := *t.KeepState
+	ks.Paused = paused
+	t.KeepState = &ks
+	t.muTorrent.Unlock()
+	return t.applyKeep()
+}
+
+// CancelKeep turns keep mode off, downloaded files are not removed
+func (t *Torrent) CancelKeep() {
+	t.stopKeep()
+	t.muTorrent.Lock()
+	t.KeepState = nil
+	t.muTorrent.Unlock()
+}
+
+// setKeepState restores keep mode from DB, it starts when metadata is received
+func (t *Torrent) setKeepState(ks *settings.KeepState) {
+	if ks == nil {
+		return
+	}
+	cp := *ks
+	t.muTorrent.Lock()
+	t.KeepState = &cp
+	t.muTorrent.Unlock()
+	if err := t.applyKeep(); err != nil {
+		log.TLogln("Error keep torrent:", err)
+	}
+}
+
+// applyKeep opens keep storage for the torrent with info and sets priority of kept files
+func (t *Torrent) applyKeep() error {
+	t.muKeep.Lock()
+	defer t.muKeep.Unlock()
+
+	t.muTorrent.Lock()
+	ks := t.KeepState
+	cache := t.cache
+	job := t.keep
+	t.muTorrent.Unlock()
+	if ks == nil || cache == nil || t.Torrent == nil || t.State() == state.TorrentClosed {
+		return nil
+	}
+	info := t.Torrent.Info()
+	if info == nil {
+		return nil
+	}
+
+	if job == nil {
+		stor := filestor.NewStorage(ks.Path)
+		impl, err := stor.OpenTorrent(info, t.Hash())
+		if err != nil {
+			return err
+		}
+		job = &keepJob{
+			storage: stor,
+			torrent: impl.(*filestor.Torrent),
+			files:   t.keepFiles(ks.Files),
+		}
+		if len(job.files) == 0 {
+			stor.Close()
+			return errors.New("no files to keep")
+		}
+		cache.SetKeep(impl)
+		t.muTorrent.Lock()
+		t.keep = job
+		t.muTorrent.Unlock()
+		log.TLogln("Keep torrent", t.Hash().HexString(), "to", ks.Path)
+	}
+
+	prio := torrent.PiecePriorityNormal
+	if ks.Paused {
+		prio = torrent.PiecePriorityNone
+	}
+	for _, f := range job.files {
+		f.SetPriority(prio)
+	}
+	return nil
+}
+
+// stopKeep detaches keep storage from the torrent
+func (t *Torrent) stopKeep() {
+	t.muKeep.Lock()
+	defer t.muKeep.Unlock()
+
+	t.muTorrent.Lock()
+	job := t.keep
+	cache := t.cache
+	t.keep = nil
+	t.muTorrent.Unlock()
+	if job == nil {
+		return
+	}
+	if t.State() != state.TorrentClosed {
+		for _, f := range job.files {
+			f.SetPriority(torrent.PiecePriorityNone)
+		}
+		if cache != nil {
+			cache.SetKeep(nil)
+		}
+	}
+	job.storage.Close()
+}
+
+// closeKeep saves keep storage on close, keep state stays for the next load
+func (t *Torrent) closeKeep() {
+	t.muTorrent.Lock()
+	job := t.keep
+	t.keep = nil
+	t.muTorrent.Unlock()
+	if job != nil {
+		job.storage.Close()
+	}
+}
+
+// keepFiles returns files with paths, empty paths - all files, unwanted files are never kept
+func (t *Torrent) keepFiles(paths []string) []*torrent.File {
+	var ret []*torrent.File
+	for _, f := range t.Files() {
+		if !t.fileWanted(f.Path()) {
+			continue
+		}
+		if len(paths) == 0 || slices.Contains(paths, f.Path()) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// keepActive reports whether torrent downloads files in keep mode or seeds files it was created from
+func (t *Torrent) keepActive() bool {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if t.keep == nil || t.KeepState == nil || t.KeepState.Paused {
+		return false
+	}
+	// created torrent stays active to seed its files
+	return !t.keep.done || t.KeepState.Seed
+}
+
+// KeepStatus returns progress of keep mode or nil if torrent is not kept
+func (t *Torrent) KeepStatus() *state.KeepStatus {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if t.KeepState == nil {
+		return nil
+	}
+	st := &state.KeepStatus{
+		Path:   t.KeepState.Path,
+		Files:  t.KeepState.Files,
+		Paused: t.KeepState.Paused,
+		Seed:   t.KeepState.Seed,
+	}
+	if t.keep != nil {
+		st.Completed, st.Total = t.keep.progress()
+		st.Done = st.Total > 0 && st.Completed == st.Total
+	}
+	return st
+}
+
+// keepProgressEvent publishes progress of keep mode while files are downloaded
+func (t *Torrent) keepProgressEvent() {
+	st := t.KeepStatus()
+	if st == nil || st.Total == 0 {
+		return
+	}
+	t.muTorrent.Lock()
+	if t.keep == nil || t.keep.done {
+		t.muTorrent.Unlock()
+		return
+	}
+	t.keep.done = st.Done
+	t.muTorrent.Unlock()
+
+	if st.Done {
+		log.TLogln("Keep torrent done", t.Hash().HexString())
+	}
+	publish(&KeepProgressEvent{
+		Hash:      t.Hash().HexString(),
+		Path:      st.Path,
+		Completed: st.Completed,
+		Total:     st.Total,
+		Paused:    st.Paused,
+		Done:      st.Done,
+	})
+}
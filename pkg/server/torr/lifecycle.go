@@ -0,0 +1,118 @@
+package torr
+
+import (
+	"context"
+	"errors"
+
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+var ErrTorrentClosed = errors.New("torrent closed")
+
+// lifecycle of torrent:
+//
+//	InDB -> Added -> GettingInfo -> Working <-> Preload
+//
+// every state may go to Closed, Closed is final
+var transitions = map[state.TorrentStat][]state.TorrentStat{
+	state.TorrentInDB:        {state.TorrentAdded},
+	state.TorrentAdded:       {state.TorrentGettingInfo},
+	state.TorrentGettingInfo: {state.TorrentWorking},
+	state.TorrentWorking:     {state.TorrentPreload},
+	state.TorrentPreload:     {state.TorrentWorking},
+}
+
+func canTransit(from, to state.TorrentStat) bool {
+	if from == state.TorrentClosed {
+		return false
+	}
+	if to == state.TorrentClosed {
+		return true
+	}
+	for _, st := range transitions[from] {
+		if st == to {
+			return true
+		}
+	}
+	return false
+}
+
+// State returns current lifecycle state of torrent
+func (t *Torrent) State() state.TorrentStat {
+	t.muStat.Lock()
+	defer t.muStat.Unlock()
+	return t.stat
+}
+
+// setStat moves torrent to the state if lifecycle allows it
+func (t *Torrent) setStat(to state.TorrentStat) bool {
+	t.muStat.Lock()
+	from := t.stat
+	if !canTransit(from, to) {
+		t.muStat.Unlock()
+		return false
+	}
+	t.changeStatLocked(to)
+	t.muStat.Unlock()
+
+	t.publishStat(from, to)
+	return true
+}
+
+// casStat moves torrent to the state only if it is in the state from
+func (t *Torrent) casStat(from, to state.TorrentStat) bool {
+	t.muStat.Lock()
+	if t.stat != from || !canTransit(from, to) {
+		t.muStat.Unlock()
+		return false
+	}
+	t.changeStatLocked(to)
+	t.muStat.Unlock()
+
+	t.publishStat(from, to)
+	return true
+}
+
+func (t *Torrent) changeStatLocked(to state.TorrentStat) {
+	t.stat = to
+	// wake up all waiters
+	if t.statCh != nil {
+		close(t.statCh)
+	}
+	t.statCh = make(chan struct{})
+}
+
+func (t *Torrent) publishStat(from, to state.TorrentStat) {
+	publish(&StateChangedEvent{
+		Hash: t.Hash().HexString(),
+		From: from,
+		To:   to,
+		Stat: to.String(),
+	})
+}
+
+// waitStat blocks until cond is true for the current state, torrent is closed or ctx is done
+func (t *Torrent) waitStat(ctx context.Context, cond func(st state.TorrentStat) bool) (state.TorrentStat, error) {
+	for {
+		t.muStat.Lock()
+		st := t.stat
+		if t.statCh == nil {
+			t.statCh = make(chan struct{})
+		}
+		ch := t.statCh
+		t.muStat.Unlock()
+
+		if cond(st) {
+			return st, nil
+		}
+		if st == state.TorrentClosed {
+			return st, ErrTorrentClosed
+		}
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return st, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package torr
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/storage/torrstor"
+)
+
+const testPieceLength = 32 << 10
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "torr")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	settings.Path = dir
+	settings.InitSets(false, false)
+	settings.BTsets.RetrackersMode = 0
+	code := m.Run()
+	settings.CloseDB()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestBTS returns server with client which doesn't go to network, torrents are filled by fillPieces
+func newTestBTS(t *testing.T, capacity int64) *BTServer {
+	t.Helper()
+	bt := NewBTS()
+	bt.storage = torrstor.NewStorage(capacity)
+	bt.config = torrent.NewDefaultClientConfig()
+	bt.config.DataDir = t.TempDir()
+	bt.config.DefaultStorage = bt.storage
+	bt.config.NoDHT = true
+	bt.config.DisableTrackers = true
+	bt.config.DisablePEX = true
+	bt.config.NoDefaultPortForwarding = true
+	bt.config.DisableIPv6 = true
+	bt.config.ListenPort = 0
+	bt.config.ListenHost = func(string) string { return "127.0.0.1" }
+	bt.config.Seed = true
+	bt.config.IPBlocklist = bt.filter
+	client, err := torrent.NewClient(bt.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt.client = client
+	InitApiHelper(bt)
+	t.Cleanup(func() {
+		for _, torr := range bt.ListTorrents() {
+			torr.Close()
+		}
+		bt.Disconnect()
+	})
+	return bt
+}
+
+// testSpec builds torrent of files with random data
+func testSpec(t *testing.T, sizes ...int64) (*torrent.TorrentSpec, []byte) {
+	t.Helper()
+	info := metainfo.Info{Name: "test", PieceLength: testPieceLength}
+	var total int64
+	for i, size := range sizes {
+		info.Files = append(info.Files, metainfo.FileInfo{Path: []string{fmt.Sprintf("file%d.bin", i)}, Length: size})
+		total += size
+	}
+	data := make([]byte, total)
+	rand.Read(data)
+	for off := int64(0); off < total; off += testPieceLength {
+		sum := sha1.Sum(data[off:min(off+testPieceLength, total)])
+		info.Pieces = append(info.Pieces, sum[:]...)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &torrent.TorrentSpec{
+		InfoBytes:   infoBytes,
+		InfoHash:    metainfo.Hash(sha1.Sum(infoBytes)),
+		DisplayName: info.Name,
+	}, data
+}
+
+// addTestTorrent adds torrent and waits for its info and cache
+func addTestTorrent(t *testing.T, bt *BTServer, spec *torrent.TorrentSpec) *Torrent {
+	t.Helper()
+	torr, err := NewTorrent(spec, bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !torr.GotInfo() {
+		t.Fatal("no info of torrent")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = torr.WaitInfoContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return torr
+}
+
+// fillPieces writes data of pieces from first to last to storage as if they are downloaded
+func fillPieces(torr *Torrent, data []byte, first, last int) {
+	for i := first; i <= last; i++ {
+		off := int64(i) * testPieceLength
+		p := torr.Torrent.Piece(i)
+		p.Storage().WriteAt(data[off:min(off+testPieceLength, int64(len(data)))], 0)
+		p.VerifyData()
+	}
+}
+
+// skipRace skips test with connected peers in race mode: status of the client,
+// which is sampled for peers and smart ban, dumps stats of connections without atomics
+func skipRace(t *testing.T) {
+	if raceEnabled {
+		t.Skip("status of the client races with connections")
+	}
+}
+
+// connectTestPeer connects torrent to the client of seeder over loopback
+func connectTestPeer(torr *Torrent, seeder *BTServer) {
+	torr.Torrent.AddPeers([]torrent.Peer{{IP: net.IPv4(127, 0, 0, 1), Port: seeder.client.LocalPort()}})
+}
+
+// readTestFile reads whole file with reader of torrent, reader prioritizes pieces as stream does
+func readTestFile(ctx context.Context, torr *Torrent, file *torrent.File) ([]byte, error) {
+	reader := torr.NewReader(file)
+	if reader == nil {
+		return nil, ErrTorrentClosed
+	}
+	defer torr.CloseReader(reader)
+	buf := make([]byte, file.Length())
+	for n := 0; n < len(buf); {
+		m, err := reader.ReadContext(ctx, buf[n:])
+		n += m
+		if err != nil && n < len(buf) {
+			return buf[:n], err
+		}
+	}
+	return buf, nil
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	spec, data := testSpec(t, 20*testPieceLength+100, 9*testPieceLength, 1000)
+	torr := addTestTorrent(t, bt, spec)
+
+	var wg sync.WaitGroup
+	filled := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(filled)
+		fillPieces(torr, data, 0, torr.Info().NumPieces()-1)
+	}()
+
+	files := torr.Files()
+	for i := 0; i < 8; i++ {
+		file := files[i%len(files)]
+		wg.Add(1)
+		go func(i int, file *torrent.File) {
+			defer wg.Done()
+			reader := torr.NewReader(file)
+			if reader == nil {
+				t.Error("reader of working torrent is nil")
+				return
+			}
+			defer torr.CloseReader(reader)
+			pos := int64(i) * 1000 % file.Length()
+			if _, err := reader.Seek(pos, io.SeekStart); err != nil {
+				t.Error(err)
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			buf := make([]byte, file.Length()-pos)
+			for n := 0; n < len(buf); {
+				m, err := reader.ReadContext(ctx, buf[n:])
+				n += m
+				if err != nil && n < len(buf) {
+					t.Errorf("read %s at %d: %v", file.Path(), pos+int64(n), err)
+					return
+				}
+			}
+			if !bytes.Equal(buf, data[file.Offset()+pos:file.Offset()+file.Length()]) {
+				t.Errorf("wrong data of %s", file.Path())
+			}
+		}(i, file)
+	}
+	// status is read by ui while torrent works
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-filled:
+					return
+				default:
+				}
+				torr.Status()
+				torr.CacheState()
+				torr.FileByID(i%len(files) + 1)
+				torr.GetCache().Filled()
+				torr.progressEvent()
+				bt.storage.SetCapacity(int64(8+i) * testPieceLength)
+				time.Sleep(10 * time.Millisecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentRemove(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	spec, data := testSpec(t, 12*testPieceLength, 3*testPieceLength)
+	torr := addTestTorrent(t, bt, spec)
+	fillPieces(torr, data, 0, 3)
+
+	var wg sync.WaitGroup
+	file := torr.Files()[0]
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader := torr.NewReader(file)
+			if reader == nil {
+				// torrent is already closed
+				return
+			}
+			defer torr.CloseReader(reader)
+			buf := make([]byte, file.Length())
+			// piece 4 isn't loaded, read is waiting till torrent is closed
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			for n := 0; n < len(buf); {
+				m, err := reader.ReadContext(ctx, buf[n:])
+				n += m
+				if err != nil {
+					if ctx.Err() != nil {
+						t.Error("read isn't interrupted by close")
+					}
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			torr.Status()
+			torr.progressEvent()
+			bt.RemoveTorrent(spec.InfoHash)
+			torr.Close()
+		}()
+	}
+	wg.Wait()
+
+	if st := torr.State(); st != state.TorrentClosed {
+		t.Fatalf("state of removed torrent is %v", st)
+	}
+	if bt.GetTorrent(spec.InfoHash) != nil {
+		t.Fatal("removed torrent is in list")
+	}
+	if torr.NewReader(file) != nil {
+		t.Fatal("reader of closed torrent isn't nil")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	var list []*Torrent
+	for i := 0; i < 4; i++ {
+		spec, data := testSpec(t, 4*testPieceLength)
+		torr := addTestTorrent(t, bt, spec)
+		fillPieces(torr, data, 0, 1)
+		list = append(list, torr)
+	}
+
+	var wg sync.WaitGroup
+	for _, torr := range list {
+		torr.muStat.Lock()
+		torr.expiredTime = time.Now().Add(-time.Second)
+		torr.muStat.Unlock()
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(torr *Torrent) {
+				defer wg.Done()
+				torr.progressEvent()
+				torr.Status()
+				torr.GotInfo()
+			}(torr)
+		}
+	}
+	wg.Wait()
+
+	for _, torr := range list {
+		if st := torr.State(); st != state.TorrentClosed {
+			t.Errorf("state of expired torrent is %v", st)
+		}
+	}
+	if n := len(bt.ListTorrents()); n != 0 {
+		t.Fatalf("%d expired torrents are in list", n)
+	}
+}
+
+func TestRestoreKeepsSettings(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	spec, _ := testSpec(t, testPieceLength, testPieceLength)
+	torr := addTestTorrent(t, bt, spec)
+	unwanted := torr.Files()[1].Path()
+	torr.SetSeedPolicy(&settings.SeedPolicy{Ratio: 2})
+	if err := torr.AddWebSeeds([]string{"http://127.0.0.1:1/"}); err != nil {
+		t.Fatal(err)
+	}
+	torr.SetUnwanted([]string{unwanted})
+	torr.CreationDate, torr.Comment = 1700000000, "comment"
+
+	snap := torr.suspend()
+	torr.Close()
+	bt.restore([]*torrentSnapshot{snap})
+	torr = bt.GetTorrent(spec.InfoHash)
+	if torr == nil {
+		t.Fatal("torrent isn't restored")
+	}
+	torr.muTorrent.Lock()
+	defer torr.muTorrent.Unlock()
+	if torr.SeedPolicy == nil || torr.SeedPolicy.Ratio != 2 {
+		t.Errorf("seed policy %+v", torr.SeedPolicy)
+	}
+	if len(torr.WebSeeds) != 1 || torr.WebSeeds[0] != "http://127.0.0.1:1/" {
+		t.Errorf("web seeds %v", torr.WebSeeds)
+	}
+	if len(torr.Unwanted) != 1 || torr.Unwanted[0] != unwanted {
+		t.Errorf("unwanted %v", torr.Unwanted)
+	}
+	if torr.CreationDate != 1700000000 || torr.Comment != "comment" {
+		t.Errorf("header %d %q", torr.CreationDate, torr.Comment)
+	}
+}
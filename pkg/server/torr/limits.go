@@ -0,0 +1,79 @@
+package torr
+
+import (
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+// SetLimits sets own rate limits of torrent in kb and its priority, 0 - only client limits work
+func (t *Torrent) SetLimits(down, up int, priority state.TorrentPriority) {
+	if down < 0 {
+		down = 0
+	}
+	if up < 0 {
+		up = 0
+	}
+	t.muTorrent.Lock()
+	t.DownloadLimit = down
+	t.UploadLimit = up
+	t.Priority = priority
+	t.muTorrent.Unlock()
+	t.applyLimits()
+}
+
+// applyLimits passes limits to cache and sets connections count for the effective priority,
+// it is called every second because auto priority follows readers and preload
+func (t *Torrent) applyLimits() {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if t.Torrent == nil || t.State() == state.TorrentClosed {
+		return
+	}
+	if t.cache != nil {
+		t.cache.SetLimits(t.DownloadLimit*1024, t.UploadLimit*1024)
+	}
+	conns := connsForPriority(t.effectivePriority())
+	if conns != t.maxConns {
+		t.maxConns = conns
+		t.Torrent.SetMaxEstablishedConns(conns)
+	}
+}
+
+// effectivePriority must be called with muTorrent held
+func (t *Torrent) effectivePriority() state.TorrentPriority {
+	if t.Priority != state.PriorityAuto {
+		return t.Priority
+	}
+	if t.cache != nil && t.cache.Readers() > 0 {
+		return state.PriorityHigh
+	}
+	if t.State() == state.TorrentPreload {
+		return state.PriorityLow
+	}
+	return state.PriorityNormal
+}
+
+func connsForPriority(priority state.TorrentPriority) int {
+	conns := settings.BTsets.ConnectionsLimit
+	switch priority {
+	case state.PriorityLow:
+		conns /= 2
+		if conns < 5 {
+			conns = 5
+		}
+	case state.PriorityHigh:
+		conns *= 2
+	}
+	return conns
+}
+
+// effectiveLimit returns limit which really works for torrent, 0 - unlimited
+func effectiveLimit(own, global int) int {
+	if own > 0 && (global <= 0 || own < global) {
+		return own
+	}
+	if global > 0 {
+		return global
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package torr
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+func TestUploadLimitDoesntStallClient(t *testing.T) {
+	skipRace(t)
+	seeder := newTestBTS(t, 128*testPieceLength)
+	leecher := newTestBTS(t, 128*testPieceLength)
+	capped, cappedData := testSpec(t, 64*testPieceLength)
+	free, freeData := testSpec(t, 16*testPieceLength)
+
+	seedCapped := addTestTorrent(t, seeder, capped)
+	seedFree := addTestTorrent(t, seeder, free)
+	fillPieces(seedCapped, cappedData, 0, seedCapped.Info().NumPieces()-1)
+	fillPieces(seedFree, freeData, 0, seedFree.Info().NumPieces()-1)
+	// 1 kb/s, one chunk in 16 seconds
+	seedCapped.SetLimits(0, 1, state.PriorityNormal)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	leechCapped := addTestTorrent(t, leecher, capped)
+	leechFree := addTestTorrent(t, leecher, free)
+	connectTestPeer(leechCapped, seeder)
+	connectTestPeer(leechFree, seeder)
+	go readTestFile(ctx, leechCapped, leechCapped.Files()[0])
+
+	// capped torrent is uploaded while the other one is downloaded and read locally
+	time.Sleep(time.Second)
+	start := time.Now()
+	buf, err := readTestFile(ctx, seedFree, seedFree.Files()[0])
+	if err != nil || !bytes.Equal(buf, freeData) {
+		t.Fatalf("local read of seeder: %v", err)
+	}
+	if buf, err = readTestFile(ctx, leechFree, leechFree.Files()[0]); err != nil || !bytes.Equal(buf, freeData) {
+		t.Fatalf("download of torrent without limit: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("torrent without limit is downloaded in %v", d)
+	}
+	if n := leechCapped.Torrent.BytesCompleted(); n > 2*testPieceLength {
+		t.Fatalf("%d bytes of capped torrent are uploaded", n)
+	}
+}
@@ -0,0 +1,329 @@
+package torr
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+	"time"
+
+	"github.com/anacrolix/torrent"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+)
+
+const (
+	raDefault    = 16 << 20 // readahead while bitrate of media is unknown
+	raMin        = 4 << 20
+	raSeconds    = 30 // seconds of media ahead of reader
+	raSlowFactor = 3  // readahead grows up to x3 when download is slower than media
+
+	probeTimeout = time.Minute
+	probeScan    = 4 << 20 // bytes of mkv scanned for segment info
+)
+
+var errUnknownContainer = errors.New("unknown container")
+
+// mediaInfo is bitrate and duration of media file of torrent
+type mediaInfo struct {
+	BitRate  int64   // bits per second
+	Duration float64 // in seconds
+}
+
+// MediaInfo returns bitrate in bits per second and duration in seconds of file, zeros - unknown
+func (t *Torrent) MediaInfo(path string) (int64, float64) {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if mi := t.media[path]; mi != nil {
+		return mi.BitRate, mi.Duration
+	}
+	return 0, 0
+}
+
+// SetMediaInfo sets bitrate and duration of file, bitrate is counted from duration if it is unknown
+func (t *Torrent) SetMediaInfo(path string, bitRate int64, duration float64) {
+	if bitRate <= 0 && duration > 0 {
+		for _, f := range t.Files() {
+			if f.Path() == path {
+				bitRate = int64(float64(f.Length()*8) / duration)
+				break
+			}
+		}
+	}
+	if bitRate <= 0 {
+		return
+	}
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if t.media == nil {
+		t.media = make(map[string]*mediaInfo)
+	}
+	t.media[path] = &mediaInfo{BitRate: bitRate, Duration: duration}
+}
+
+// setProbedMediaInfo saves bitrate of ffprobe, it is a string of bits per second
+func (t *Torrent) setProbedMediaInfo(path, bitRate string, duration float64) {
+	br, _ := strconv.ParseInt(bitRate, 10, 64)
+	t.SetMediaInfo(path, br, duration)
+}
+
+// probeMedia reads duration of file from mkv or mp4 container once, bitrate is the average one
+func (t *Torrent) probeMedia(file *torrent.File) {
+	t.muTorrent.Lock()
+	if t.probed == nil {
+		t.probed = make(map[string]bool)
+	}
+	if t.probed[file.Path()] {
+		t.muTorrent.Unlock()
+		return
+	}
+	t.probed[file.Path()] = true
+	t.muTorrent.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(t.ctx, probeTimeout)
+		defer cancel()
+		rd := file.NewReader()
+		defer rd.Close()
+		duration, err := containerDuration(ctxReader{ctx, rd}, file.Length())
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, errUnknownContainer) {
+				log.TLogln("Error probe media", file.Path()+":", err)
+			}
+			return
+		}
+		t.SetMediaInfo(file.Path(), 0, duration)
+	}()
+}
+
+// readaheadFor returns readahead of reader of file: raSeconds of media at its bitrate,
+// more while download is slower than media, bounded by share of cache of one reader
+func (t *Torrent) readaheadFor(file *torrent.File, readers int, speed float64, capacity, share int64) int64 {
+	ra := int64(raDefault)
+	if bitRate, _ := t.MediaInfo(file.Path()); bitRate > 0 {
+		rate := float64(bitRate) / 8
+		secs := float64(raSeconds)
+		if speed > 0 && speed < rate {
+			secs *= min(rate/speed, raSlowFactor)
+		}
+		ra = int64(rate * secs)
+	}
+	ra = max(ra, raMin, 2*t.Info().PieceLength)
+	if readers < 1 {
+		readers = 1
+	}
+	return min(ra, capacity/int64(readers)*share/100)
+}
+
+// ctxReader reads from torrent until ctx is done
+type ctxReader struct {
+	ctx context.Context
+	torrent.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	return r.Reader.ReadContext(r.ctx, p)
+}
+
+// containerDuration returns duration of mkv or mp4 file in seconds
+func containerDuration(r io.ReadSeeker, size int64) (float64, error) {
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return 0, err
+	}
+	switch {
+	case binary.BigEndian.Uint32(magic[:4]) == mkvIDEBML:
+		return mkvDuration(r)
+	case string(magic[4:]) == "ftyp":
+		return mp4Duration(r, size)
+	}
+	return 0, errUnknownContainer
+}
+
+// matroska ids, https://www.matroska.org/technical/elements.html
+const (
+	mkvIDEBML          = 0x1A45DFA3
+	mkvIDSegment       = 0x18538067
+	mkvIDInfo          = 0x1549A966
+	mkvIDTimecodeScale = 0x2AD7B1
+	mkvIDDuration      = 0x4489
+	mkvIDCluster       = 0x1F43B675
+)
+
+func mkvDuration(r io.ReadSeeker) (float64, error) {
+	if _, err := r.Seek(4, io.SeekStart); err != nil {
+		return 0, err
+	}
+	size, _, err := ebmlVint(r, false)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = r.Seek(int64(size), io.SeekCurrent); err != nil {
+		return 0, err
+	}
+	if id, _, _, err := ebmlElement(r); err != nil || id != mkvIDSegment {
+		return 0, errors.New("mkv segment not found")
+	}
+
+	for scanned := int64(0); scanned < probeScan; {
+		id, size, _, err := ebmlElement(r)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case id == mkvIDInfo && size > 0:
+			return mkvInfoDuration(r, size)
+		case id == mkvIDCluster || size < 0:
+			return 0, errors.New("mkv segment info not found")
+		}
+		if _, err = r.Seek(size, io.SeekCurrent); err != nil {
+			return 0, err
+		}
+		scanned += size
+	}
+	return 0, errors.New("mkv segment info not found")
+}
+
+func mkvInfoDuration(r io.Reader, size int64) (float64, error) {
+	scale, duration := uint64(1000000), 0.0
+	for size > 0 {
+		id, n, hl, err := ebmlElement(r)
+		if err != nil {
+			return 0, err
+		}
+		if n < 0 || n > size {
+			return 0, errors.New("wrong mkv segment info")
+		}
+		size -= hl + n
+		if (id != mkvIDTimecodeScale && id != mkvIDDuration) || n > 8 {
+			if _, err = io.CopyN(io.Discard, r, n); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		buf := make([]byte, n)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		switch id {
+		case mkvIDTimecodeScale:
+			scale = 0
+			for _, b := range buf {
+				scale = scale<<8 | uint64(b)
+			}
+		case mkvIDDuration:
+			switch n {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(buf)))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(buf))
+			}
+		}
+	}
+	if duration <= 0 {
+		return 0, errors.New("mkv duration not found")
+	}
+	return duration * float64(scale) / 1e9, nil
+}
+
+// ebmlElement reads id, size and header length of element, unknown size is returned as -1
+func ebmlElement(r io.Reader) (uint64, int64, int64, error) {
+	id, il, err := ebmlVint(r, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	size, l, err := ebmlVint(r, false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if size == 1<<(7*l)-1 {
+		return id, -1, int64(il + l), nil
+	}
+	return id, int64(size), int64(il + l), nil
+}
+
+// ebmlVint reads variable size integer, ids keep length marker
+func ebmlVint(r io.Reader, marker bool) (uint64, int, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return 0, 0, err
+	}
+	l := bits.LeadingZeros8(b[0]) + 1
+	if l > 8 {
+		return 0, 0, errors.New("wrong ebml integer")
+	}
+	if _, err := io.ReadFull(r, b[1:l]); err != nil {
+		return 0, 0, err
+	}
+	v := uint64(b[0])
+	if !marker {
+		v &= 0xFF >> l
+	}
+	for i := 1; i < l; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, l, nil
+}
+
+func mp4Duration(r io.ReadSeeker, size int64) (float64, error) {
+	start, end, err := mp4Box(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	if start, _, err = mp4Box(r, start, end, "mvhd"); err != nil {
+		return 0, err
+	}
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var buf [32]byte
+	if _, err = io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(buf[20:24]))
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(buf[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+	if timescale == 0 || duration == 0 {
+		return 0, errors.New("mp4 duration not found")
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// mp4Box returns body of box with typ between start and end
+func mp4Box(r io.ReadSeeker, start, end int64, typ string) (int64, int64, error) {
+	for off := start; off+8 <= end; {
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		var hdr [16]byte
+		if _, err := io.ReadFull(r, hdr[:8]); err != nil {
+			return 0, 0, err
+		}
+		size, hl := int64(binary.BigEndian.Uint32(hdr[:4])), int64(8)
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			if _, err := io.ReadFull(r, hdr[8:]); err != nil {
+				return 0, 0, err
+			}
+			size, hl = int64(binary.BigEndian.Uint64(hdr[8:])), 16
+		}
+		if size < hl {
+			return 0, 0, errors.New("wrong mp4 box")
+		}
+		if string(hdr[4:8]) == typ {
+			return off + hl, min(off+size, end), nil
+		}
+		off += size
+	}
+	return 0, 0, errors.New("mp4 box not found: " + typ)
+}
@@ -0,0 +1,176 @@
+package torr
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// mp4TestBox builds mp4 box, large boxes get 64 bit size
+func mp4TestBox(typ string, large bool, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	var buf bytes.Buffer
+	if large {
+		binary.Write(&buf, binary.BigEndian, uint32(1))
+		buf.WriteString(typ)
+		binary.Write(&buf, binary.BigEndian, uint64(16+len(data)))
+	} else {
+		binary.Write(&buf, binary.BigEndian, uint32(8+len(data)))
+		buf.WriteString(typ)
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// mvhdTestBody builds body of mvhd box of version 0 or 1
+func mvhdTestBody(version byte, timescale uint32, duration uint64) []byte {
+	body := make([]byte, 100)
+	body[0] = version
+	if version == 1 {
+		binary.BigEndian.PutUint32(body[20:], timescale)
+		binary.BigEndian.PutUint64(body[24:], duration)
+	} else {
+		binary.BigEndian.PutUint32(body[12:], timescale)
+		binary.BigEndian.PutUint32(body[16:], uint32(duration))
+	}
+	return body
+}
+
+// ebmlTestElement builds ebml element with 8 byte size, unknown size if body is nil
+func ebmlTestElement(id uint32, body ...[]byte) []byte {
+	var buf bytes.Buffer
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || buf.Len() > 0 {
+			buf.WriteByte(b)
+		}
+	}
+	size := uint64(1)<<56 - 1
+	if body != nil {
+		size = uint64(len(bytes.Join(body, nil)))
+	}
+	binary.Write(&buf, binary.BigEndian, size|1<<56)
+	buf.Write(bytes.Join(body, nil))
+	return buf.Bytes()
+}
+
+func mkvTestFile(info ...[]byte) []byte {
+	return bytes.Join([][]byte{
+		ebmlTestElement(mkvIDEBML, []byte{0x42, 0x82, 0x84, 'w', 'e', 'b', 'm'}),
+		ebmlTestElement(mkvIDSegment),
+		ebmlTestElement(0xEC, make([]byte, 10)), // void
+		ebmlTestElement(mkvIDInfo, info...),
+		ebmlTestElement(mkvIDCluster),
+	}, nil)
+}
+
+func TestContainerDuration(t *testing.T) {
+	ftyp := mp4TestBox("ftyp", false, []byte("isom\x00\x00\x02\x00"))
+	mdat := mp4TestBox("mdat", true, make([]byte, 1<<20))
+	moov := mp4TestBox("moov", false, mp4TestBox("trak", false, make([]byte, 20)), mp4TestBox("mvhd", false, mvhdTestBody(0, 1000, 5400000)))
+	moov1 := mp4TestBox("moov", false, mp4TestBox("mvhd", false, mvhdTestBody(1, 90000, 90000*3600)))
+	dur64 := make([]byte, 8)
+	binary.BigEndian.PutUint64(dur64, math.Float64bits(5400000))
+	dur32 := make([]byte, 4)
+	binary.BigEndian.PutUint32(dur32, math.Float32bits(3600))
+
+	tests := []struct {
+		name string
+		data []byte
+		want float64
+		err  bool
+	}{
+		{name: "mp4 moov at head", data: bytes.Join([][]byte{ftyp, moov, mdat}, nil), want: 5400},
+		{name: "mp4 moov at tail", data: bytes.Join([][]byte{ftyp, mdat, moov}, nil), want: 5400},
+		{name: "mp4 mvhd version 1", data: bytes.Join([][]byte{ftyp, mdat, moov1}, nil), want: 3600},
+		{name: "mp4 without moov", data: bytes.Join([][]byte{ftyp, mdat}, nil), err: true},
+		{
+			name: "mkv",
+			data: mkvTestFile(ebmlTestElement(mkvIDTimecodeScale, []byte{0x0F, 0x42, 0x40}), ebmlTestElement(mkvIDDuration, dur64)),
+			want: 5400,
+		},
+		{
+			name: "mkv float duration and timecode scale",
+			data: mkvTestFile(ebmlTestElement(mkvIDDuration, dur32), ebmlTestElement(mkvIDTimecodeScale, []byte{0x3B, 0x9A, 0xCA, 0x00})),
+			want: 3600,
+		},
+		{name: "mkv without duration", data: mkvTestFile(ebmlTestElement(mkvIDTimecodeScale, []byte{0x0F, 0x42, 0x40})), err: true},
+		{name: "unknown", data: make([]byte, 64), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := containerDuration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("no error, duration %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("duration %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// addPieceTestTorrent adds torrent of one small file with piece length
+func addPieceTestTorrent(t *testing.T, bt *BTServer, pieceLength int64) *Torrent {
+	t.Helper()
+	data := make([]byte, 1024)
+	sum := sha1.Sum(data)
+	info := metainfo.Info{Name: "piece.mkv", PieceLength: pieceLength, Length: int64(len(data)), Pieces: sum[:]}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addTestTorrent(t, bt, &torrent.TorrentSpec{InfoBytes: infoBytes, InfoHash: metainfo.Hash(sha1.Sum(infoBytes))})
+}
+
+func TestReadaheadFor(t *testing.T) {
+	bt := newTestBTS(t, 64*testPieceLength)
+	spec, _ := testSpec(t, testPieceLength)
+	small := addTestTorrent(t, bt, spec)
+	big := addPieceTestTorrent(t, bt, 8<<20)
+
+	const mb = 1 << 20
+	tests := []struct {
+		name     string
+		torr     *Torrent
+		bitRate  int64 // bits per second, 0 - unknown
+		readers  int
+		speed    float64
+		capacity int64
+		share    int64
+		want     int64
+	}{
+		{name: "unknown bitrate", torr: small, readers: 1, capacity: 1 << 30, share: 100, want: raDefault},
+		{name: "speed is unknown", torr: small, bitRate: 8 * mb, readers: 1, capacity: 1 << 30, share: 100, want: 30 * mb},
+		{name: "speed above rate", torr: small, bitRate: 8 * mb, readers: 1, speed: 2 * mb, capacity: 1 << 30, share: 100, want: 30 * mb},
+		{name: "speed below rate", torr: small, bitRate: 8 * mb, readers: 1, speed: mb / 2, capacity: 1 << 30, share: 100, want: 60 * mb},
+		{name: "slow factor", torr: small, bitRate: 8 * mb, readers: 1, speed: mb / 10, capacity: 1 << 30, share: 100, want: 90 * mb},
+		{name: "raMin", torr: small, bitRate: 80 << 10, readers: 1, capacity: 1 << 30, share: 100, want: raMin},
+		{name: "two pieces", torr: big, bitRate: 80 << 10, readers: 1, capacity: 1 << 30, share: 100, want: 16 * mb},
+		{name: "share of cache", torr: small, bitRate: 8 * mb, readers: 2, capacity: 100 * mb, share: 50, want: 25 * mb},
+		{name: "no readers", torr: small, bitRate: 8 * mb, capacity: 40 * mb, share: 50, want: 20 * mb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tt.torr.Files()[0]
+			tt.torr.muTorrent.Lock()
+			tt.torr.media = nil
+			tt.torr.muTorrent.Unlock()
+			tt.torr.SetMediaInfo(file.Path(), tt.bitRate, 0)
+			if got := tt.torr.readaheadFor(file, tt.readers, tt.speed, tt.capacity, tt.share); got != tt.want {
+				t.Fatalf("readahead %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package torr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+const (
+	metaAttempts       = 5
+	metaAttemptTimeout = 20 * time.Second // doubled every attempt
+	metaAttemptMax     = 2 * time.Minute
+	metaProgressTick   = 2 * time.Second
+	metaDHTTimeout     = 15 * time.Second
+	metaChunkSize      = 16 << 10
+)
+
+var ErrMetadataCancelled = errors.New("metadata fetch cancelled")
+
+// progress of metadata fetches, failed ones are kept to show the reason
+var (
+	metaJobs   = make(map[metainfo.Hash]*state.MetadataProgress)
+	muMetaJobs sync.Mutex
+)
+
+// fetchInfo waits metadata with retries, peers are requested again from trackers and dht between attempts
+func (t *Torrent) fetchInfo() error {
+	if t.Torrent == nil || t.ctx == nil {
+		return ErrTorrentClosed
+	}
+	hash := t.Hash()
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	t.muTorrent.Lock()
+	t.metaCancel = cancel
+	t.muTorrent.Unlock()
+
+	p := &state.MetadataProgress{Attempts: metaAttempts, Started: time.Now().Unix()}
+	timeout := metaAttemptTimeout
+	for attempt := 1; ; attempt++ {
+		p.Attempt = attempt
+		err := t.waitInfoAttempt(ctx, p, timeout)
+		if err == nil {
+			p.Done = true
+			t.publishMetaProgress(p)
+			muMetaJobs.Lock()
+			delete(metaJobs, hash)
+			muMetaJobs.Unlock()
+			return nil
+		}
+		switch {
+		case ctx.Err() != nil && t.ctx.Err() == nil:
+			err = ErrMetadataCancelled
+		case errors.Is(err, ErrTorrentClosed):
+		case attempt < metaAttempts:
+			log.TLogln("No metadata, retry", hash.HexString(), "attempt", attempt+1)
+			t.requeryPeers(ctx)
+			timeout = min(timeout*2, metaAttemptMax)
+			continue
+		default:
+			err = metaFailure(p)
+		}
+		p.Error = err.Error()
+		t.publishMetaProgress(p)
+		log.TLogln("Error get metadata", hash.HexString()+":", err)
+		return err
+	}
+}
+
+// waitInfoAttempt waits metadata for timeout, progress is published meanwhile
+func (t *Torrent) waitInfoAttempt(ctx context.Context, p *state.MetadataProgress, timeout time.Duration) error {
+	actx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- t.WaitInfoContext(actx) }()
+
+	ticker := time.NewTicker(metaProgressTick)
+	defer ticker.Stop()
+	t.updateMetaProgress(p)
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			t.updateMetaProgress(p)
+		}
+	}
+}
+
+// metaFailure explains why metadata wasn't received
+func metaFailure(p *state.MetadataProgress) error {
+	switch {
+	case p.Peers == 0:
+		return errors.New("no peers found, trackers and DHT don't know the torrent")
+	case p.ActivePeers == 0:
+		return fmt.Errorf("found %d peers, but none of them accepted connection", p.Peers)
+	case p.ExtendedPeers == 0:
+		return fmt.Errorf("connected to %d peers, but none of them supports extension protocol to send metadata", p.ActivePeers)
+	case p.Size > 0:
+		return fmt.Errorf("metadata is received partially: %d of %d bytes", p.Received, p.Size)
+	}
+	return errors.New("peers didn't send metadata")
+}
+
+func (t *Torrent) updateMetaProgress(p *state.MetadataProgress) {
+	client := t.bt.getClient()
+	if client == nil || t.Torrent == nil {
+		return
+	}
+	st := t.Torrent.Stats()
+	p.Peers = st.TotalPeers
+	p.ActivePeers = st.ActivePeers
+
+	status, _ := t.bt.clientStatus()
+	hash := t.Hash().HexString()
+	p.Size, p.Received = parseMetadataStatus(bytes.NewReader(status), hash)
+	// the client doesn't tell which peers support ut_metadata
+	peers, _ := parsePeers(bytes.NewReader(status), hash)
+	p.ExtendedPeers = 0
+	for _, peer := range peers {
+		if peer.Extended {
+			p.ExtendedPeers++
+		}
+	}
+	t.publishMetaProgress(p)
+}
+
+// parseMetadataStatus reads metadata size and received bytes of torrent from status of the client
+func parseMetadataStatus(r *bytes.Reader, hash string) (size, received int64) {
+	inside := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Infohash: ") {
+			if inside {
+				break
+			}
+			inside = strings.TrimPrefix(line, "Infohash: ") == hash
+			continue
+		}
+		if !inside {
+			continue
+		}
+		if s, ok := strings.CutPrefix(line, "Metadata length: "); ok {
+			size, _ = strconv.ParseInt(s, 10, 64)
+		} else if s, ok := strings.CutPrefix(line, "Metadata have: "); ok {
+			received = int64(strings.Count(s, "H")) * metaChunkSize
+			break
+		}
+	}
+	return size, min(received, size)
+}
+
+func (t *Torrent) publishMetaProgress(p *state.MetadataProgress) {
+	cp := *p
+	muMetaJobs.Lock()
+	metaJobs[t.Hash()] = &cp
+	muMetaJobs.Unlock()
+	publish(&MetadataProgressEvent{Hash: t.Hash().HexString(), MetadataProgress: &cp})
+}
+
+// requeryPeers reannounces to trackers and searches dht for peers of torrent
+func (t *Torrent) requeryPeers(ctx context.Context) {
+	t.Reannounce("")
+	client := t.bt.getClient()
+	if client == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, metaDHTTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, s := range client.DhtServers() {
+		ann, err := s.Announce(t.Hash(), 0, false)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer ann.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case pv, ok := <-ann.Peers():
+					if !ok {
+						return
+					}
+					peers := make([]torrent.Peer, 0, len(pv.Peers))
+					for _, p := range pv.Peers {
+						peers = append(peers, torrent.Peer{IP: p.IP, Port: p.Port, Source: "Hg"})
+					}
+					t.Torrent.AddPeers(peers)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// CancelMetadata stops metadata fetch, the torrent is closed then
+func (t *Torrent) CancelMetadata() bool {
+	t.muTorrent.Lock()
+	cancel := t.metaCancel
+	t.muTorrent.Unlock()
+	if cancel == nil || t.Torrent == nil || t.Torrent.Info() != nil {
+		return false
+	}
+	cancel()
+	return true
+}
+
+// MetadataProgress returns progress of metadata fetch of torrent, nil - not fetching and not failed
+func MetadataProgress(hashHex string) *state.MetadataProgress {
+	muMetaJobs.Lock()
+	defer muMetaJobs.Unlock()
+	if p := metaJobs[metainfo.NewHashFromHex(hashHex)]; p != nil {
+		cp := *p
+		return &cp
+	}
+	return nil
+}
+
+func forgetMetadata(hash metainfo.Hash) {
+	muMetaJobs.Lock()
+	delete(metaJobs, hash)
+	muMetaJobs.Unlock()
+}
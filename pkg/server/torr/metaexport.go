@@ -0,0 +1,176 @@
+package torr
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/version"
+)
+
+var ErrNoMetainfo = errors.New("torrent metadata is not downloaded")
+
+// createdBy is written into metainfo of exported and created torrents
+var createdBy = "TorrPlayer " + version.Version
+
+// exportTorrent returns running torrent or torrent from DB
+func exportTorrent(hashHex string) (*Torrent, error) {
+	hash := metainfo.NewHashFromHex(hashHex)
+	if bts != nil {
+		if tor := bts.GetTorrent(hash); tor != nil {
+			return tor, nil
+		}
+	}
+	if tor := GetTorrentDB(hash); tor != nil {
+		return tor, nil
+	}
+	return nil, fmt.Errorf("torrent not found: %s", hashHex)
+}
+
+// infoBytes returns bencoded info of torrent from client, spec or metainfo store
+func (t *Torrent) infoBytes() []byte {
+	if t.Torrent != nil && t.Torrent.Info() != nil {
+		return t.Torrent.Metainfo().InfoBytes
+	}
+	if t.TorrentSpec != nil && len(t.TorrentSpec.InfoBytes) > 0 {
+		return t.TorrentSpec.InfoBytes
+	}
+	return settings.GetMetainfo(t.Hash().HexString())
+}
+
+// announceList groups current trackers of torrent by tiers
+func (t *Torrent) announceList() metainfo.AnnounceList {
+	var ret metainfo.AnnounceList
+	tier := -1
+	for _, tr := range t.TrackerList() {
+		if tr.Tier != tier || len(ret) == 0 {
+			ret = append(ret, nil)
+			tier = tr.Tier
+		}
+		ret[len(ret)-1] = append(ret[len(ret)-1], tr.URL)
+	}
+	return ret
+}
+
+// SetOrigin keeps creation date and comment of .torrent the torrent is added from, they are exported with it
+func (t *Torrent) SetOrigin(mi *metainfo.MetaInfo) {
+	if mi == nil {
+		return
+	}
+	t.CreationDate = mi.CreationDate
+	t.Comment = mi.Comment
+}
+
+// MetaInfo builds metainfo with current trackers of torrent, info must be known,
+// creation date and comment are of the original .torrent, they are omitted for magnets
+func (t *Torrent) MetaInfo() (*metainfo.MetaInfo, error) {
+	buf := t.infoBytes()
+	if len(buf) == 0 {
+		return nil, ErrNoMetainfo
+	}
+	mi := &metainfo.MetaInfo{
+		InfoBytes:    buf,
+		AnnounceList: t.announceList(),
+		CreationDate: t.CreationDate,
+		UrlList:      t.webSeedURLs(),
+		Comment:      t.Comment,
+		CreatedBy:    createdBy,
+	}
+	if len(mi.AnnounceList) > 0 {
+		mi.Announce = mi.AnnounceList[0][0]
+	}
+	return mi, nil
+}
+
+// Magnet builds magnet link with display name and current trackers of torrent
+func (t *Torrent) Magnet() metainfo.Magnet {
+	m := metainfo.Magnet{
+		InfoHash:    t.Hash(),
+		DisplayName: t.Title,
+	}
+	if buf := t.infoBytes(); len(buf) > 0 {
+		var info metainfo.Info
+		if err := bencode.Unmarshal(buf, &info); err == nil {
+			m.DisplayName = info.BestName()
+		}
+	}
+	if m.DisplayName == "" && t.TorrentSpec != nil {
+		m.DisplayName = t.TorrentSpec.DisplayName
+	}
+	m.Trackers = t.announceList().DistinctValues()
+	if ws := t.webSeedURLs(); len(ws) > 0 {
+		m.Params = url.Values{"ws": ws}
+	}
+	return m
+}
+
+// ExportTorrentFile writes .torrent of torrent, path may be a directory
+func ExportTorrentFile(hashHex, path string) (string, error) {
+	tor, err := exportTorrent(hashHex)
+	if err != nil {
+		return "", err
+	}
+	mi, err := tor.MetaInfo()
+	if err != nil {
+		return "", err
+	}
+	return writeMetaInfo(mi, path)
+}
+
+// writeMetaInfo writes .torrent to path, file is named by torrent if path is a directory
+func writeMetaInfo(mi *metainfo.MetaInfo, path string) (string, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(path, exportName(info.BestName())+".torrent")
+	}
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	err = mi.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+// ExportMagnet returns magnet link of torrent
+func ExportMagnet(hashHex string) (string, error) {
+	tor, err := exportTorrent(hashHex)
+	if err != nil {
+		return "", err
+	}
+	return tor.Magnet().String(), nil
+}
+
+// exportName replaces chars which are not allowed in file names
+func exportName(name string) string {
+	ret := []rune(name)
+	for i, r := range ret {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			ret[i] = '_'
+		}
+	}
+	if len(ret) == 0 {
+		return "torrent"
+	}
+	return string(ret)
+}
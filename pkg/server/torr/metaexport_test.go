@@ -0,0 +1,40 @@
+package torr
+
+import (
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestMetaInfoOrigin(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	spec, _ := testSpec(t, testPieceLength)
+	torr := addTestTorrent(t, bt, spec)
+	torr.Title = "Library title"
+
+	// magnets have no creation date and comment
+	mi, err := torr.MetaInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.CreationDate != 0 || mi.Comment != "" {
+		t.Fatalf("export of magnet has creation date %d and comment %q", mi.CreationDate, mi.Comment)
+	}
+
+	torr.SetOrigin(&metainfo.MetaInfo{CreationDate: 1500000000, Comment: "original comment"})
+	AddTorrentDB(torr)
+	t.Cleanup(func() { RemTorrentDB(spec.InfoHash) })
+	db := GetTorrentDB(spec.InfoHash)
+	if db == nil {
+		t.Fatal("torrent isn't saved")
+	}
+	for _, tor := range []*Torrent{torr, db} {
+		mi, err := tor.MetaInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mi.CreationDate != 1500000000 || mi.Comment != "original comment" {
+			t.Fatalf("export has creation date %d and comment %q", mi.CreationDate, mi.Comment)
+		}
+	}
+}
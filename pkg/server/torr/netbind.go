@@ -0,0 +1,218 @@
+package torr
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wlynxg/anet"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+const netCheckInterval = 3 * time.Second
+
+var ErrNetworkDown = errors.New("network interface is down, torrents are paused")
+
+// lookupInterface finds interface by name or by one of its addresses
+func lookupInterface(name string) *state.NetInterface {
+	st := &state.NetInterface{Name: name, Checked: time.Now().Unix()}
+	ifaces, err := anet.Interfaces()
+	if err != nil {
+		return st
+	}
+	ip := net.ParseIP(name)
+	for _, i := range ifaces {
+		addrs, _ := anet.InterfaceAddrsByInterface(&i)
+		var ips []string
+		match := i.Name == name
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipnet.IP.String())
+				match = match || ip != nil && ipnet.IP.Equal(ip)
+			}
+		}
+		if match {
+			st.Found = true
+			st.Up = i.Flags&net.FlagUp == net.FlagUp && len(ips) > 0
+			st.Addrs = ips
+			return st
+		}
+	}
+	return st
+}
+
+// bindIPs returns addresses to bind, address from settings is preferred
+func bindIPs(st *state.NetInterface) (v4, v6 net.IP) {
+	if ip := net.ParseIP(st.Name); ip != nil {
+		if ip.To4() != nil {
+			return ip, nil
+		}
+		return nil, ip
+	}
+	for _, s := range st.Addrs {
+		ip := net.ParseIP(s)
+		if ip == nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip.To4() != nil && v4 == nil {
+			v4 = ip
+		} else if ip.To4() == nil && v6 == nil {
+			v6 = ip
+		}
+	}
+	return
+}
+
+// configureBind binds listen sockets, dht, peer connections, trackers and fetches to interface from settings
+func (bt *BTServer) configureBind() {
+	name := settings.BTsets.BindInterface
+	if name == "" {
+		proxy.SetBind(nil, nil)
+		return
+	}
+	st := lookupInterface(name)
+	v4, v6 := bindIPs(st)
+	log.TLogln("Bind to interface", name, v4, v6)
+	if v4 == nil && v6 == nil {
+		// nothing to bind, don't leak through other interfaces
+		log.TLogln("Interface is down:", name)
+		v4 = net.IPv4(127, 0, 0, 1)
+	}
+	bt.config.DisableIPv4 = v4 == nil
+	bt.config.DisableIPv6 = bt.config.DisableIPv6 || v6 == nil
+	// incoming peers are direct connections, they are listened on loopback in proxy only mode
+	if !proxy.Only() {
+		bt.config.ListenHost = func(network string) string {
+			if strings.Contains(network, "6") {
+				if v6 != nil {
+					return v6.String()
+				}
+				return "::1"
+			}
+			if v4 != nil {
+				return v4.String()
+			}
+			return "127.0.0.1"
+		}
+	}
+	proxy.SetBind(v4, v6)
+	// proxy is dialed from the interface
+	via := proxy.URL()
+	if via != nil {
+		log.TLogln("Dial proxy from interface", name)
+	}
+	bt.config.ProxyURL = proxy.BindURL(v4, v6, via)
+}
+
+// watchInterface checks interface from settings, kill switch pauses torrents while it is down
+func (bt *BTServer) watchInterface() {
+	for {
+		bt.checkInterface()
+		time.Sleep(netCheckInterval)
+	}
+}
+
+func (bt *BTServer) checkInterface() {
+	name := settings.BTsets.BindInterface
+	var st *state.NetInterface
+	if name != "" {
+		st = lookupInterface(name)
+	} else {
+		st = &state.NetInterface{Checked: time.Now().Unix()}
+	}
+	st.KillSwitch = name != "" && settings.BTsets.KillSwitch
+
+	bt.muNetStat.Lock()
+	prev := bt.netStat
+	bt.netStat = st
+	bt.muNetStat.Unlock()
+	paused := bt.netPaused.Load()
+
+	switch {
+	case paused && (!st.KillSwitch || st.Up):
+		bt.resumeNetwork()
+	case !paused && st.KillSwitch && !st.Up:
+		bt.pauseNetwork()
+	case prev != nil && prev.Name == st.Name && prev.Up && st.Up && !slices.Equal(prev.Addrs, st.Addrs):
+		log.TLogln("Interface address changed, reconnect client")
+		if err := bt.Reconnect(); err != nil {
+			log.TLogln("Error reconnect client:", err)
+		}
+	}
+
+	if prev == nil || prev.Name != st.Name || prev.Up != st.Up || prev.KillSwitch != st.KillSwitch ||
+		!slices.Equal(prev.Addrs, st.Addrs) {
+		publish(&NetInterfaceEvent{bt.NetInterface()})
+	}
+}
+
+// pauseNetwork closes torrents and the client, readers wait for resumeNetwork
+func (bt *BTServer) pauseNetwork() {
+	bt.muNet.Lock()
+	defer bt.muNet.Unlock()
+	if bt.netSnaps != nil {
+		return
+	}
+	log.TLogln("Interface is down, pause torrents:", settings.BTsets.BindInterface)
+	bt.netPaused.Store(true)
+	bt.netSnaps = bt.suspendAll()
+	bt.Disconnect()
+}
+
+func (bt *BTServer) resumeNetwork() {
+	bt.muNet.Lock()
+	defer bt.muNet.Unlock()
+	snaps := bt.netSnaps
+	if snaps == nil {
+		return
+	}
+	log.TLogln("Interface is up, resume torrents:", settings.BTsets.BindInterface)
+	if err := bt.Connect(); err != nil {
+		log.TLogln("Error connect client:", err)
+		return
+	}
+	bt.netSnaps = nil
+	bt.netPaused.Store(false)
+	bt.restore(snaps)
+}
+
+// NetworkPaused reports that torrents are paused by kill switch
+func (bt *BTServer) NetworkPaused() bool {
+	return bt.netPaused.Load()
+}
+
+// NetInterface returns status of interface from settings
+func (bt *BTServer) NetInterface() *state.NetInterface {
+	bt.muNetStat.Lock()
+	defer bt.muNetStat.Unlock()
+	if bt.netStat == nil {
+		return &state.NetInterface{Name: settings.BTsets.BindInterface}
+	}
+	st := *bt.netStat
+	st.Paused = bt.netPaused.Load()
+	return &st
+}
+
+// NetInterfaces returns interfaces which are up to choose one for binding
+func NetInterfaces() []*state.NetInterface {
+	ifaces, err := anet.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var ret []*state.NetInterface
+	for _, i := range ifaces {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if st := lookupInterface(i.Name); st.Up {
+			ret = append(ret, st)
+		}
+	}
+	return ret
+}
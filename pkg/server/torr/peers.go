@@ -0,0 +1,386 @@
+package torr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+// the client doesn't export its connections, peers are read from status of the client
+var (
+	reConnHeader = regexp.MustCompile(`^\s*\d+\. (".*)$`)
+	reConnTimes  = regexp.MustCompile(`connected: ([\d.]+)s ago`)
+	reConnStats  = regexp.MustCompile(`^\s+(\d+)/(\d+) completed, (\d+) pieces touched, good chunks: (\d+)/(\d+)-(\d+) .*flags: (\S*), dr: (\S+) KiB/s`)
+	reConnNext   = regexp.MustCompile(`^\s+next pieces: \[([\d ]*)\]`)
+)
+
+const (
+	chunkSize = 16 << 10
+	// status of the client is written under its lock, torrents sampled within statusAge share it
+	statusAge = time.Second
+	// source of peers added by user
+	peerSourceManual = "M"
+)
+
+var peerSources = map[string]string{
+	"Tr":             "tracker",
+	"I":              "incoming",
+	"Hg":             "dht",
+	"Ha":             "dht",
+	"X":              "pex",
+	peerSourceManual: "manual",
+}
+
+// Azureus style peer ids, see BEP 20
+var peerClients = map[string]string{
+	"AZ": "Vuze",
+	"BI": "BiglyBT",
+	"BT": "BitTorrent",
+	"DE": "Deluge",
+	"FD": "Free Download Manager",
+	"KT": "KTorrent",
+	"LT": "libtorrent",
+	"lt": "libTorrent",
+	"qB": "qBittorrent",
+	"SD": "Thunder",
+	"TR": "Transmission",
+	"UM": "µTorrent Mac",
+	"UT": "µTorrent",
+	"UW": "µTorrent Web",
+	"WW": "WebTorrent",
+	"XL": "Xunlei",
+	"GT": "anacrolix/torrent",
+}
+
+var ErrBadPeerAddr = errors.New("wrong peer address")
+
+// statusFormatOnce reports status of the client which can't be parsed, peers list and smart ban don't work then
+var statusFormatOnce sync.Once
+
+// peerSample is the previous state of connection to count speeds and find peers of failed pieces
+type peerSample struct {
+	time       time.Time
+	downChunks int64
+	upChunks   int64
+	downSpeed  float64
+	upSpeed    float64
+	// pieces dirtied by peer and not hashed yet, and the first pieces it requests
+	touched int
+	next    []int
+}
+
+// Peers returns connected peers of torrent
+func (t *Torrent) Peers() []*state.PeerStat {
+	if t.Torrent == nil {
+		return nil
+	}
+	status, at := t.bt.clientStatus()
+	if status == nil {
+		return nil
+	}
+	peers, samples := parsePeers(bytes.NewReader(status), t.Hash().HexString())
+	if (len(peers) == 0 || len(samples) == 0) && t.Torrent.Stats().ActivePeers > 0 {
+		statusFormatOnce.Do(func() {
+			log.TLogln("Error parse peers from status of the client, torrent", t.Hash().HexString(), "has connections")
+		})
+	}
+
+	t.muTorrent.Lock()
+	for _, p := range peers {
+		cur := samples[p.Addr]
+		if prev, ok := t.peerSamples[p.Addr]; ok {
+			if dt := at.Sub(prev.time).Seconds(); dt > 0 {
+				cur.downSpeed = float64(max(cur.downChunks-prev.downChunks, 0)*chunkSize) / dt
+				cur.upSpeed = float64(max(cur.upChunks-prev.upChunks, 0)*chunkSize) / dt
+			} else {
+				// the same status, speeds are counted already
+				cur.downSpeed, cur.upSpeed = prev.downSpeed, prev.upSpeed
+			}
+			p.DownloadSpeed, p.UploadSpeed = cur.downSpeed, cur.upSpeed
+		}
+	}
+	for _, s := range samples {
+		s.time = at
+	}
+	t.peerSamples = samples
+	t.peersSampled = at
+	t.muTorrent.Unlock()
+	return peers
+}
+
+// clientStatus returns status of the client and time it was written, it is written once for all torrents within statusAge
+func (bt *BTServer) clientStatus() ([]byte, time.Time) {
+	client := bt.getClient()
+	if client == nil {
+		return nil, time.Time{}
+	}
+	bt.muStatus.Lock()
+	defer bt.muStatus.Unlock()
+	if bt.status == nil || time.Since(bt.statusTime) >= statusAge {
+		var buf bytes.Buffer
+		client.WriteStatus(&buf)
+		bt.status = buf.Bytes()
+		bt.statusTime = time.Now()
+	}
+	return bt.status, bt.statusTime
+}
+
+// parsePeers reads connections of torrent with hash from status of the client
+func parsePeers(r io.Reader, hash string) ([]*state.PeerStat, map[string]*peerSample) {
+	var peers []*state.PeerStat
+	samples := make(map[string]*peerSample)
+	var cur *state.PeerStat
+	inside := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Infohash: ") {
+			inside = strings.TrimPrefix(line, "Infohash: ") == hash
+			cur = nil
+			continue
+		}
+		if !inside {
+			continue
+		}
+		if m := reConnHeader.FindStringSubmatch(line); m != nil {
+			cur = parseConnHeader(m[1])
+			if cur != nil {
+				peers = append(peers, cur)
+			}
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if m := reConnTimes.FindStringSubmatch(line); m != nil {
+			sec, _ := strconv.ParseFloat(m[1], 64)
+			cur.ConnectedSeconds = int64(sec)
+			continue
+		}
+		if m := reConnStats.FindStringSubmatch(line); m != nil {
+			cur.Pieces, _ = strconv.Atoi(m[1])
+			cur.TotalPieces, _ = strconv.Atoi(m[2])
+			touched, _ := strconv.Atoi(m[3])
+			useful, _ := strconv.ParseInt(m[4], 10, 64)
+			written, _ := strconv.ParseInt(m[6], 10, 64)
+			parseConnFlags(cur, m[7])
+			// average speed while interested till the next sample
+			if dr, err := strconv.ParseFloat(m[8], 64); err == nil && dr > 0 && dr < 1e9 {
+				cur.DownloadSpeed = dr * 1024
+			}
+			samples[cur.Addr] = &peerSample{downChunks: useful, upChunks: written, touched: touched}
+			continue
+		}
+		// next pieces follow stats of connection
+		if m := reConnNext.FindStringSubmatch(line); m != nil {
+			if s := samples[cur.Addr]; s != nil {
+				for _, f := range strings.Fields(m[1]) {
+					if id, err := strconv.Atoi(f); err == nil {
+						s.next = append(s.next, id)
+					}
+				}
+			}
+			cur = nil
+		}
+	}
+	return peers, samples
+}
+
+// parseConnHeader parses `"peer id" extensions local-remote`
+func parseConnHeader(s string) *state.PeerStat {
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return nil
+	}
+	id, _ := strconv.Unquote(quoted)
+	fields := strings.Fields(s[len(quoted):])
+	if len(fields) < 2 {
+		return nil
+	}
+	addrs := strings.SplitN(fields[len(fields)-1], "-", 2)
+	if len(addrs) != 2 {
+		return nil
+	}
+	var ext pp.PeerExtensionBits
+	if b, err := hex.DecodeString(fields[len(fields)-2]); err == nil && len(b) == len(ext) {
+		copy(ext[:], b)
+	}
+	return &state.PeerStat{
+		Addr:     addrs[1],
+		PeerID:   strings.Trim(strconv.QuoteToASCII(id), `"`),
+		Client:   peerClient(id),
+		Extended: ext.SupportsExtended(),
+	}
+}
+
+// parseConnFlags parses flags like `ic-EHgU-i`: local interest and choke, connection, peer interest and choke
+func parseConnFlags(p *state.PeerStat, flags string) {
+	parts := strings.SplitN(flags, "-", 3)
+	if len(parts) != 3 {
+		return
+	}
+	p.AmInterested = strings.Contains(parts[0], "i")
+	p.AmChoking = strings.Contains(parts[0], "c")
+	p.PeerInterested = strings.Contains(parts[2], "i")
+	p.PeerChoking = strings.Contains(parts[2], "c")
+
+	conn := parts[1]
+	if strings.HasPrefix(conn, "E") || strings.HasPrefix(conn, "e") {
+		p.Encrypted = true
+		conn = conn[1:]
+	}
+	p.Network = "tcp"
+	if strings.HasSuffix(conn, "U") {
+		p.Network = "utp"
+		conn = strings.TrimSuffix(conn, "U")
+	}
+	p.Source = peerSources[conn]
+	if p.Source == "" {
+		p.Source = "unknown"
+	}
+}
+
+// peerClient returns client name from Azureus style peer id
+func peerClient(id string) string {
+	if len(id) < 8 || id[0] != '-' || id[7] != '-' {
+		return "Unknown"
+	}
+	name, ok := peerClients[id[1:3]]
+	if !ok {
+		return "Unknown (" + id[1:3] + ")"
+	}
+	var ver []string
+	for _, c := range id[3:7] {
+		ver = append(ver, string(c))
+	}
+	return strings.TrimSpace(name + " " + strings.TrimRight(strings.Join(ver, "."), ".0"))
+}
+
+// parsePeerAddr parses ip:port, port is optional when withPort is false
+func parsePeerAddr(addr string, withPort bool) (net.IP, int, error) {
+	host, portStr, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil {
+		if withPort {
+			return nil, 0, ErrBadPeerAddr
+		}
+		host = strings.Trim(strings.TrimSpace(addr), "[]")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, ErrBadPeerAddr
+	}
+	port := 0
+	if portStr != "" {
+		port, err = strconv.Atoi(portStr)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, 0, ErrBadPeerAddr
+		}
+	}
+	return ip, port, nil
+}
+
+// AddPeer connects torrent to peer with address ip:port
+func (t *Torrent) AddPeer(addr string) error {
+	ip, port, err := parsePeerAddr(addr, true)
+	if err != nil {
+		return err
+	}
+	if t.Torrent == nil {
+		return ErrTorrentClosed
+	}
+	t.Torrent.AddPeers([]torrent.Peer{{IP: ip, Port: port, Source: peerSourceManual}})
+	return nil
+}
+
+// BanPeer blocks ip of peer for all torrents till restart and drops its connections, addr is ip or ip:port
+func (bt *BTServer) BanPeer(addr, reason string) error {
+	ip, _, err := parsePeerAddr(addr, false)
+	if err != nil {
+		return err
+	}
+	if bt.filter.Ban(ip, reason) {
+		log.TLogln("ban peer", ip.String()+":", reason)
+	}
+	bt.dropPeer(ip)
+	return nil
+}
+
+// dropPeer drops connections of torrents to ip, the filter only rejects new ones.
+// The client can't drop one connection, so all connections of torrent with the peer
+// are dropped and the other peers are connected again. Returns count of torrents reconnected
+func (bt *BTServer) dropPeer(ip net.IP) int {
+	// connection may be opened after the status was written
+	bt.muStatus.Lock()
+	bt.status = nil
+	bt.muStatus.Unlock()
+	status, _ := bt.clientStatus()
+	if status == nil {
+		return 0
+	}
+	dropped := 0
+	for hash, t := range bt.ListTorrents() {
+		peers, _ := parsePeers(bytes.NewReader(status), hash.HexString())
+		var keep []torrent.Peer
+		found := false
+		for _, p := range peers {
+			pip, port, err := parsePeerAddr(p.Addr, true)
+			if err != nil {
+				continue
+			}
+			if pip.Equal(ip) {
+				found = true
+				continue
+			}
+			keep = append(keep, torrent.Peer{IP: pip, Port: port})
+		}
+		if !found {
+			continue
+		}
+		t.muTorrent.Lock()
+		if t.Torrent != nil && t.State() != state.TorrentClosed {
+			conns := t.Torrent.SetMaxEstablishedConns(0)
+			t.Torrent.AddPeers(keep)
+			t.Torrent.SetMaxEstablishedConns(conns)
+			dropped++
+		}
+		t.muTorrent.Unlock()
+	}
+	if dropped > 0 {
+		log.TLogln("Drop connections of", ip.String()+", reconnect", dropped, "torrents")
+	}
+	return dropped
+}
+
+func (bt *BTServer) UnbanPeer(addr string) error {
+	ip, _, err := parsePeerAddr(addr, false)
+	if err != nil {
+		return err
+	}
+	if !bt.filter.Unban(ip) {
+		return fmt.Errorf("peer is not banned: %s", ip)
+	}
+	settings.RemBan(ip.String())
+	return nil
+}
+
+// BannedPeers returns banned ips with reasons
+func (bt *BTServer) BannedPeers() map[string]string {
+	return bt.filter.Banned()
+}
@@ -0,0 +1,137 @@
+package torr
+
+import (
+	"sort"
+	"time"
+
+	"github.com/anacrolix/torrent"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	utils2 "github.com/german2285/TorrPlayer/pkg/server/utils"
+)
+
+// prefetchTick starts prefetch of the next file when a reader passes PrefetchNext percent of its file
+func (t *Torrent) prefetchTick() {
+	prc := int64(settings.BTsets.PrefetchNext)
+	cache := t.GetCache()
+	if prc <= 0 || cache == nil || t.Torrent == nil || t.Torrent.Info() == nil {
+		return
+	}
+	for _, r := range cache.ListReaders() {
+		file := r.File()
+		if file.Length() == 0 {
+			continue
+		}
+		next := t.nextFileID(file.Path())
+		if next == 0 {
+			continue
+		}
+		passed := r.Offset()*100/file.Length() >= prc
+		t.muTorrent.Lock()
+		started := t.prefetched == next
+		switch {
+		case passed:
+			t.prefetched = next
+		case started:
+			// reader went back, next file is prefetched again when it passes
+			t.prefetched = 0
+		}
+		t.muTorrent.Unlock()
+		if passed && !started {
+			go t.Prefetch(next, preloadSize())
+		}
+	}
+}
+
+// nextFileID returns id of the wanted file after file with path, 0 - file is the last one
+func (t *Torrent) nextFileID(path string) int {
+	files := t.Files()
+	sort.Slice(files, func(i, j int) bool {
+		return utils2.CompareStrings(files[i].Path(), files[j].Path())
+	})
+	for i, f := range files {
+		if f.Path() != path {
+			continue
+		}
+		for j := i + 1; j < len(files); j++ {
+			if t.fileWanted(files[j].Path()) {
+				return j + 1
+			}
+		}
+		return 0
+	}
+	return 0
+}
+
+// Prefetch loads the beginning and the end of file while other file of torrent is read.
+// Pieces get lower priority than pieces of readers and stay in cache till the file is opened,
+// prefetch takes a quarter of cache at most
+func (t *Torrent) Prefetch(index int, size int64) {
+	cache := t.GetCache()
+	if size <= 0 || t.ctx == nil || cache == nil || t.Info() == nil {
+		return
+	}
+	file := t.findFileIndex(index)
+	if file == nil || !t.fileWanted(file.Path()) {
+		return
+	}
+	if limit := cache.GetCapacity() / 4; size > limit {
+		size = limit
+	}
+
+	pieceLength := t.Info().PieceLength
+	startEnd, endStart := preloadBounds(file, pieceLength, size)
+	pieces := filePieces(file, pieceLength, 0, startEnd)
+	if endStart > startEnd {
+		pieces = append(pieces, filePieces(file, pieceLength, endStart, file.Length())...)
+	}
+	if len(pieces) == 0 {
+		return
+	}
+	cache.SetPrefetch(file, pieces)
+	log.TLogln("Prefetch:", t.Hash().HexString(), file.Path(), utils2.Format(float64(size)))
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		left := 0
+		for _, id := range pieces {
+			ps := t.Torrent.PieceState(id)
+			if ps.Complete {
+				continue
+			}
+			left++
+			if ps.Priority == torrent.PiecePriorityNone {
+				t.Torrent.Piece(id).SetPriority(torrent.PiecePriorityNormal)
+			}
+		}
+		if left == 0 {
+			log.TLogln("End prefetch:", t.Hash().HexString(), file.Path())
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-t.closed:
+			return
+		case <-t.ctx.Done():
+			return
+		}
+		if cache.PrefetchFile() != file.Path() {
+			// file is opened or other file is prefetched
+			return
+		}
+	}
+}
+
+// filePieces returns pieces of range [start, end) of file
+func filePieces(file *torrent.File, pieceLength, start, end int64) []int {
+	if end <= start {
+		return nil
+	}
+	var ret []int
+	for id := (file.Offset() + start) / pieceLength; id <= (file.Offset()+end-1)/pieceLength; id++ {
+		ret = append(ret, int(id))
+	}
+	return ret
+}
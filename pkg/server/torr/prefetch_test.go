@@ -0,0 +1,43 @@
+package torr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrefetchSurvivesClean(t *testing.T) {
+	bt := newTestBTS(t, 64*testPieceLength)
+	spec, data := testSpec(t, 16*testPieceLength, 8*testPieceLength)
+	torr := addTestTorrent(t, bt, spec)
+	cache := torr.GetCache()
+
+	// prefetched file is complete, prefetch only marks its pieces
+	fillPieces(torr, data, 16, 23)
+	torr.Prefetch(2, 8*testPieceLength)
+	if path := cache.PrefetchFile(); path != torr.Files()[1].Path() {
+		t.Fatalf("prefetched file %q", path)
+	}
+	// prefetched pieces are the oldest ones, access time is in seconds
+	time.Sleep(1100 * time.Millisecond)
+	fillPieces(torr, data, 0, 5)
+	// cleans started by writes are finished
+	time.Sleep(1500 * time.Millisecond)
+
+	cache.SetCapacity(10 * testPieceLength)
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.GetState().Filled > 10*testPieceLength {
+		if time.Now().After(deadline) {
+			t.Fatal("cache isn't cleaned")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	pieces := cache.GetState().Pieces
+	for id := 16; id <= 23; id++ {
+		if _, ok := pieces[id]; !ok {
+			t.Errorf("prefetched piece %d is removed", id)
+		}
+	}
+	if n := len(pieces); n != 9 {
+		t.Fatalf("%d pieces in cache, want 9", n)
+	}
+}
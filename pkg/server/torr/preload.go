@@ -1,6 +1,7 @@
 package torr
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strconv"
@@ -18,34 +19,50 @@ import (
 )
 
 func (t *Torrent) Preload(index int, size int64) {
-	if size <= 0 {
+	if size <= 0 || t.ctx == nil {
 		return
 	}
+	t.muTorrent.Lock()
 	t.PreloadSize = size
+	t.muTorrent.Unlock()
 
-	if t.Stat == state.TorrentGettingInfo {
-		if !t.WaitInfo() {
+	// wait while other goroutine gets info
+	waitCtx, waitCancel := context.WithTimeout(t.ctx, time.Minute+time.Second*time.Duration(settings.BTsets.TorrentDisconnectTimeout))
+	_, err := t.waitStat(waitCtx, func(st state.TorrentStat) bool {
+		return st != state.TorrentAdded && st != state.TorrentGettingInfo
+	})
+	waitCancel()
+	if err != nil {
+		return
+	}
+	if f := t.findFileIndex(index); f != nil && !t.fileWanted(f.Path()) {
+		log.TLogln("Skip preload of unwanted file:", f.Path())
+		return
+	}
+
+	// preload of streamed torrent doesn't wait in queue
+	if t.bt != nil {
+		urgent := t.GetCache().Readers() > 0
+		if t.bt.queue.Acquire(t.ctx, queuePreload, t.Hash(), urgent) != nil {
 			return
 		}
-		// wait change status
-		time.Sleep(100 * time.Millisecond)
+		defer t.bt.queue.Release(queuePreload, t.Hash())
 	}
 
-	t.muTorrent.Lock()
-	if t.Stat != state.TorrentWorking {
-		t.muTorrent.Unlock()
+	if !t.casStat(state.TorrentWorking, state.TorrentPreload) {
 		return
 	}
 
-	t.Stat = state.TorrentPreload
-	t.muTorrent.Unlock()
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
 
 	defer func() {
-		if t.Stat == state.TorrentPreload {
-			t.Stat = state.TorrentWorking
+		if t.casStat(state.TorrentPreload, state.TorrentWorking) {
 			// Очистка по окончании прелоада
+			t.muTorrent.Lock()
 			t.BitRate = ""
 			t.DurationSeconds = 0
+			t.muTorrent.Unlock()
 		}
 	}()
 
@@ -54,10 +71,6 @@ func (t *Torrent) Preload(index int, size int64) {
 		file = t.Files()[0]
 	}
 
-	if size > file.Length() {
-		size = file.Length()
-	}
-
 	if t.Info() != nil {
 		timeout := time.Second * time.Duration(settings.BTsets.TorrentDisconnectTimeout)
 		if timeout > time.Minute {
@@ -65,11 +78,27 @@ func (t *Torrent) Preload(index int, size int64) {
 		}
 		// Запуск лога в отдельном потоке
 		go func() {
-			for t.Stat == state.TorrentPreload {
-				stat := fmt.Sprint(file.Torrent().InfoHash().HexString(), " ", utils2.Format(float64(t.PreloadedBytes)), "/", utils2.Format(float64(t.PreloadSize)), " Speed:", utils2.Format(t.DownloadSpeed), " Peers:", t.Torrent.Stats().ActivePeers, "/", t.Torrent.Stats().TotalPeers, " [Seeds:", t.Torrent.Stats().ConnectedSeeders, "]")
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for t.State() == state.TorrentPreload {
+				t.muTorrent.Lock()
+				ev := &PreloadProgressEvent{
+					Hash:           t.Hash().HexString(),
+					PreloadedBytes: t.PreloadedBytes,
+					PreloadSize:    t.PreloadSize,
+					DownloadSpeed:  t.DownloadSpeed,
+				}
+				t.muTorrent.Unlock()
+				tst := t.Torrent.Stats()
+				stat := fmt.Sprint(ev.Hash, " ", utils2.Format(float64(ev.PreloadedBytes)), "/", utils2.Format(float64(ev.PreloadSize)), " Speed:", utils2.Format(ev.DownloadSpeed), " Peers:", tst.ActivePeers, "/", tst.TotalPeers, " [Seeds:", tst.ConnectedSeeders, "]")
 				log.TLogln("Preload:", stat)
+				publish(ev)
 				t.AddExpiredTime(timeout)
-				time.Sleep(time.Second)
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}()
 
@@ -79,55 +108,45 @@ func (t *Torrent) Preload(index int, size int64) {
 				link = "https://127.0.0.1:" + settings.SslPort + "/play/" + t.Hash().HexString() + "/" + strconv.Itoa(index)
 			}
 			if data, err := ffprobe.ProbeUrl(link); err == nil {
+				t.muTorrent.Lock()
 				t.BitRate = data.Format.BitRate
 				t.DurationSeconds = data.Format.DurationSeconds
+				t.muTorrent.Unlock()
+				t.setProbedMediaInfo(file.Path(), data.Format.BitRate, data.Format.DurationSeconds)
 			}
 		}
 
-		if t.Stat == state.TorrentClosed {
+		if t.State() == state.TorrentClosed {
 			log.TLogln("End preload: torrent closed")
 			return
 		}
-
-		// startend -> 8/16 MB
-		startend := t.Info().PieceLength
-		if startend < 8<<20 {
-			startend = 8 << 20
-		}
-
 		readerStart := file.NewReader()
 		defer readerStart.Close()
 		readerStart.SetResponsive()
 		readerStart.SetReadahead(0)
-		readerStartEnd := size - startend
-
-		if readerStartEnd < 0 {
-			// Если конец начального ридера оказался за началом
-			readerStartEnd = size
-		}
-		if readerStartEnd > file.Length() {
-			// Если конец начального ридера оказался после конца файла
-			readerStartEnd = file.Length()
-		}
-
-		readerEndStart := file.Length() - startend
+		readerStartEnd, readerEndStart := preloadBounds(file, t.Info().PieceLength, size)
 		readerEndEnd := file.Length()
+		// preloaded ranges mustn't be limited by upload limit of torrent
+		if cache := t.GetCache(); cache != nil {
+			defer cache.LocalReadOff(cache.LocalReadOn(file.Offset(), readerStartEnd))
+			defer cache.LocalReadOff(cache.LocalReadOn(file.Offset()+readerEndStart, readerEndEnd-readerEndStart))
+		}
 
 		var wg sync.WaitGroup
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			offset := int64(0)
 			if readerEndStart > readerStartEnd {
 				// Если конечный ридер не входит в диапозон начального
-				wg.Add(1)
-				defer wg.Done()
-				if t.Stat == state.TorrentPreload {
+				if t.State() == state.TorrentPreload {
 					readerEnd := file.NewReader()
 					readerEnd.SetResponsive()
 					readerEnd.SetReadahead(0)
 					readerEnd.Seek(readerEndStart, io.SeekStart)
 					offset = readerEndStart
 					tmp := make([]byte, 32768)
-					for offset+int64(len(tmp)) < readerEndEnd {
+					for offset+int64(len(tmp)) < readerEndEnd && ctx.Err() == nil {
 						n, err := readerEnd.Read(tmp)
 						if err != nil {
 							break
@@ -148,6 +167,10 @@ func (t *Torrent) Preload(index int, size int64) {
 		offset := int64(0)
 		tmp := make([]byte, 32768)
 		for offset+int64(len(tmp)) < readerStartEnd {
+			if ctx.Err() != nil {
+				log.TLogln("End preload: torrent closed")
+				return
+			}
 			n, err := readerStart.Read(tmp)
 			if err != nil {
 				log.TLogln("Error preload:", err)
@@ -165,6 +188,31 @@ func (t *Torrent) Preload(index int, size int64) {
 	log.TLogln("End preload:", file.Torrent().InfoHash().HexString(), "Peers:", t.Torrent.Stats().ActivePeers, "/", t.Torrent.Stats().TotalPeers, "[ Seeds:", t.Torrent.Stats().ConnectedSeeders, "]")
 }
 
+// preloadBounds returns end of the beginning and start of the end of file preloaded with size,
+// the end is read only if it starts after the beginning
+func preloadBounds(file *torrent.File, pieceLength, size int64) (startEnd, endStart int64) {
+	if size > file.Length() {
+		size = file.Length()
+	}
+	// startend -> 8/16 MB
+	startend := pieceLength
+	if startend < 8<<20 {
+		startend = 8 << 20
+	}
+
+	startEnd = size - startend
+	if startEnd < 0 {
+		// Если конец начального ридера оказался за началом
+		startEnd = size
+	}
+	if startEnd > file.Length() {
+		// Если конец начального ридера оказался после конца файла
+		startEnd = file.Length()
+	}
+	endStart = file.Length() - startend
+	return
+}
+
 func (t *Torrent) findFileIndex(index int) *torrent.File {
 	st := t.Status()
 	var stFile *state.TorrentFileStat
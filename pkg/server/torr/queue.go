@@ -0,0 +1,318 @@
+package torr
+
+import (
+	"context"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+type queueKind int
+
+const (
+	queueActive   = queueKind(iota) // torrent in the swarm
+	queueMetadata                   // metadata fetch in background
+	queuePreload                    // preload of file
+	queueKinds
+)
+
+// queue states of torrent in listing
+const (
+	QueueActive    = "active"
+	QueueMetadata  = "metadata"
+	QueuePreload   = "preload"
+	QueueQueued    = "queued"
+	QueueParked    = "parked"
+	QueueNotLoaded = ""
+)
+
+func queueLimit(kind queueKind) int {
+	switch kind {
+	case queueActive:
+		return settings.BTsets.MaxActiveTorrents
+	case queueMetadata:
+		return settings.BTsets.MaxMetadataFetches
+	case queuePreload:
+		return settings.BTsets.MaxActivePreloads
+	}
+	return 0
+}
+
+type queueWaiter struct {
+	hash  metainfo.Hash
+	ready chan struct{}
+	took  bool // slot was taken for this waiter
+}
+
+// queueLoad is background load of torrent waiting for slots
+type queueLoad struct {
+	hash   metainfo.Hash
+	cancel context.CancelFunc
+}
+
+// queue limits count of active torrents, metadata fetches and preloads,
+// urgent torrents (streamed or opened by user) always get a slot and idle torrents are parked for them
+type queue struct {
+	slots   [queueKinds]map[metainfo.Hash]struct{}
+	waiting [queueKinds][]*queueWaiter
+	parked  map[metainfo.Hash]struct{}
+	loads   map[*queueLoad]struct{}
+	mu      sync.Mutex
+
+	// park closes one idle torrent of the kind, it is called when urgent torrents exceed the limit
+	park func(kind queueKind)
+}
+
+func newQueue(park func(kind queueKind)) *queue {
+	q := &queue{
+		parked: make(map[metainfo.Hash]struct{}),
+		loads:  make(map[*queueLoad]struct{}),
+		park:   park,
+	}
+	for i := range q.slots {
+		q.slots[i] = make(map[metainfo.Hash]struct{})
+	}
+	return q
+}
+
+// Acquire takes a slot of the kind for torrent, it waits for free slot until ctx is done, urgent torrents don't wait
+func (q *queue) Acquire(ctx context.Context, kind queueKind, hash metainfo.Hash, urgent bool) error {
+	q.mu.Lock()
+	if _, ok := q.slots[kind][hash]; ok {
+		q.mu.Unlock()
+		return nil
+	}
+	if kind == queueActive {
+		delete(q.parked, hash)
+	}
+	if urgent || (q.freeLocked(kind) && len(q.waiting[kind]) == 0) {
+		q.slots[kind][hash] = struct{}{}
+		limit := queueLimit(kind)
+		over := limit > 0 && len(q.slots[kind]) > limit
+		q.mu.Unlock()
+		if over && q.park != nil {
+			go q.park(kind)
+		}
+		return nil
+	}
+	w := &queueWaiter{hash: hash, ready: make(chan struct{})}
+	q.waiting[kind] = append(q.waiting[kind], w)
+	q.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-w.ready:
+			// slot was given at the same time
+			if w.took {
+				delete(q.slots[kind], hash)
+				q.promoteLocked(kind)
+			}
+		default:
+			q.removeWaiterLocked(kind, w)
+		}
+		return ctx.Err()
+	}
+}
+
+// Release frees slot of the kind taken by torrent
+func (q *queue) Release(kind queueKind, hash metainfo.Hash) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.slots[kind][hash]; ok {
+		delete(q.slots[kind], hash)
+		q.promoteLocked(kind)
+	}
+}
+
+// ReleaseAll frees all slots of closed torrent
+func (q *queue) ReleaseAll(hash metainfo.Hash) {
+	for kind := queueKind(0); kind < queueKinds; kind++ {
+		q.Release(kind, hash)
+	}
+}
+
+// Parked marks torrent as closed by the queue
+func (q *queue) Parked(hash metainfo.Hash) {
+	q.mu.Lock()
+	q.parked[hash] = struct{}{}
+	q.mu.Unlock()
+}
+
+// loadContext returns context of background load of torrent, it is cancelled by CancelLoads,
+// done must be called when the load is finished
+func (q *queue) loadContext(hash metainfo.Hash) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &queueLoad{hash: hash, cancel: cancel}
+	q.mu.Lock()
+	q.loads[l] = struct{}{}
+	q.mu.Unlock()
+	return ctx, func() {
+		q.mu.Lock()
+		delete(q.loads, l)
+		q.mu.Unlock()
+		cancel()
+	}
+}
+
+// CancelLoads stops background loads of torrent waiting for slots, empty hash - loads of all torrents
+func (q *queue) CancelLoads(hash metainfo.Hash) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for l := range q.loads {
+		if hash == (metainfo.Hash{}) || l.hash == hash {
+			l.cancel()
+			delete(q.loads, l)
+		}
+	}
+}
+
+// Update gives free slots to waiting torrents after limits are changed
+func (q *queue) Update() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for kind := queueKind(0); kind < queueKinds; kind++ {
+		q.promoteLocked(kind)
+	}
+}
+
+// State returns queue state of torrent and its position in the queue, position starts from 1
+func (q *queue) State(hash metainfo.Hash) (string, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for kind := queueKind(0); kind < queueKinds; kind++ {
+		for i, w := range q.waiting[kind] {
+			if w.hash == hash {
+				return QueueQueued, i + 1
+			}
+		}
+	}
+	if _, ok := q.slots[queuePreload][hash]; ok {
+		return QueuePreload, 0
+	}
+	if _, ok := q.slots[queueMetadata][hash]; ok {
+		return QueueMetadata, 0
+	}
+	if _, ok := q.slots[queueActive][hash]; ok {
+		return QueueActive, 0
+	}
+	if _, ok := q.parked[hash]; ok {
+		return QueueParked, 0
+	}
+	return QueueNotLoaded, 0
+}
+
+// holders returns torrents with slots of the kind
+func (q *queue) holders(kind queueKind) []metainfo.Hash {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ret := make([]metainfo.Hash, 0, len(q.slots[kind]))
+	for hash := range q.slots[kind] {
+		ret = append(ret, hash)
+	}
+	return ret
+}
+
+func (q *queue) freeLocked(kind queueKind) bool {
+	limit := queueLimit(kind)
+	return limit <= 0 || len(q.slots[kind]) < limit
+}
+
+func (q *queue) promoteLocked(kind queueKind) {
+	for len(q.waiting[kind]) > 0 {
+		w := q.waiting[kind][0]
+		_, has := q.slots[kind][w.hash]
+		if !has && !q.freeLocked(kind) {
+			return
+		}
+		q.waiting[kind] = q.waiting[kind][1:]
+		if !has {
+			q.slots[kind][w.hash] = struct{}{}
+			w.took = true
+		}
+		close(w.ready)
+	}
+}
+
+func (q *queue) removeWaiterLocked(kind queueKind, w *queueWaiter) {
+	for i, ww := range q.waiting[kind] {
+		if ww == w {
+			q.waiting[kind] = append(q.waiting[kind][:i], q.waiting[kind][i+1:]...)
+			return
+		}
+	}
+}
+
+// parkIdle closes idle torrent with the oldest access to free a slot for urgent one
+func (bt *BTServer) parkIdle(kind queueKind) {
+	if kind != queueActive {
+		// metadata fetches and preloads finish by themselves
+		return
+	}
+	var idle *Torrent
+	for _, hash := range bt.queue.holders(kind) {
+		torr := bt.GetTorrent(hash)
+		if torr == nil || !torr.idle() {
+			continue
+		}
+		if idle == nil || torr.getExpiredTime().Before(idle.getExpiredTime()) {
+			idle = torr
+		}
+	}
+	if idle == nil {
+		return
+	}
+	log.TLogln("Park idle torrent", idle.Hash().HexString())
+	bt.queue.Parked(idle.Hash())
+	idle.Close()
+}
+
+// idle reports whether torrent may be parked, it isn't streamed, preloaded or kept
+func (t *Torrent) idle() bool {
+	return t.State() == state.TorrentWorking && t.GetCache().Readers() == 0 && !t.keepActive()
+}
+
+// loadQueued loads torrent from DB in background when queue gives it slots
+func loadQueued(tor *Torrent) *Torrent {
+	if bts == nil || tor.TorrentSpec == nil {
+		return nil
+	}
+	hash := tor.TorrentSpec.InfoHash
+	// torrent may be removed or client disconnected while it waits for slots
+	ctx, done := bts.queue.loadContext(hash)
+	defer done()
+	if err := bts.queue.Acquire(ctx, queueActive, hash, false); err != nil {
+		return nil
+	}
+	if err := bts.queue.Acquire(ctx, queueMetadata, hash, false); err != nil {
+		bts.queue.Release(queueActive, hash)
+		return nil
+	}
+	defer bts.queue.Release(queueMetadata, hash)
+	if ctx.Err() != nil {
+		bts.queue.Release(queueActive, hash)
+		return nil
+	}
+
+	tr := LoadTorrent(tor)
+	if tr == nil && bts.GetTorrent(hash) == nil {
+		bts.queue.Release(queueActive, hash)
+	}
+	return tr
+}
+
+// QueueState returns queue state of torrent and its position in queue
+func QueueState(hashHex string) (string, int) {
+	if bts == nil {
+		return QueueNotLoaded, 0
+	}
+	return bts.queue.State(metainfo.NewHashFromHex(hashHex))
+}
@@ -0,0 +1,5 @@
+//go:build race
+
+package torr
+
+const raceEnabled = true
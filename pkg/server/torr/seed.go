@@ -0,0 +1,131 @@
+package torr
+
+import (
+	"time"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+// interval of saving upload accounting to DB
+const seedSaveInterval = time.Minute
+
+// restoreSeed sets seeding policy and upload accounting of previous sessions,
+// counters are restored once when torrent is created, torrent in the client already counts them
+func (t *Torrent) restoreSeed(db *Torrent) {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	restored := t.seedRestored
+	t.seedRestored = true
+	if db == nil {
+		return
+	}
+	if db.SeedPolicy != nil {
+		p := *db.SeedPolicy
+		t.SeedPolicy = &p
+	}
+	if !restored {
+		t.Uploaded = db.Uploaded
+		t.Downloaded = db.Downloaded
+		t.SeedSeconds = db.SeedSeconds
+	}
+}
+
+// totals returns uploaded and downloaded bytes of all sessions
+func (t *Torrent) totals() (up, down int64) {
+	t.muTorrent.Lock()
+	up, down = t.Uploaded, t.Downloaded
+	tor := t.Torrent
+	t.muTorrent.Unlock()
+	if tor != nil {
+		st := tor.Stats()
+		up += st.BytesWrittenData.Int64()
+		down += st.BytesReadUsefulData.Int64()
+	}
+	return
+}
+
+// seedPolicyLocked must be called with muTorrent held
+func (t *Torrent) seedPolicyLocked() *settings.SeedPolicy {
+	if t.SeedPolicy != nil {
+		return t.SeedPolicy
+	}
+	return settings.BTsets.SeedPolicy()
+}
+
+// seedingLocked reports whether seeding targets are not reached, muTorrent must be held
+func (t *Torrent) seedingLocked(up, down int64) bool {
+	p := t.seedPolicyLocked()
+	if !p.Enabled() || t.Torrent == nil || settings.BTsets.DisableUpload {
+		return false
+	}
+	if p.Ratio > 0 && (down == 0 || float64(up)/float64(down) >= p.Ratio) {
+		return false
+	}
+	if p.Time > 0 && t.SeedSeconds >= int64(p.Time)*60 {
+		return false
+	}
+	if p.WhileCached && t.cache.Filled() == 0 {
+		return false
+	}
+	return true
+}
+
+// seeding reports whether torrent must stay active to seed
+func (t *Torrent) seeding() bool {
+	if t.State() != state.TorrentWorking {
+		return false
+	}
+	up, down := t.totals()
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	return t.seedingLocked(up, down)
+}
+
+// seedTick counts seeding time and saves accounting, it is called every second
+func (t *Torrent) seedTick() {
+	seeding := t.seeding()
+	cache := t.GetCache()
+
+	t.muTorrent.Lock()
+	if seeding && cache.Readers() == 0 {
+		t.SeedSeconds++
+	}
+	if t.wasSeeding && !seeding {
+		log.TLogln("Seeding finished", t.Hash().HexString())
+	}
+	t.wasSeeding = seeding
+	save := time.Since(t.seedSaved) > seedSaveInterval
+	t.muTorrent.Unlock()
+
+	if save {
+		t.saveSeed()
+	}
+}
+
+// saveSeed saves upload accounting to DB
+func (t *Torrent) saveSeed() {
+	if settings.ReadOnly {
+		return
+	}
+	up, down := t.totals()
+	t.muTorrent.Lock()
+	t.seedSaved = time.Now()
+	seconds := t.SeedSeconds
+	t.muTorrent.Unlock()
+
+	if torrDb := GetTorrentDB(t.Hash()); torrDb != nil {
+		torrDb.Uploaded = up
+		torrDb.Downloaded = down
+		torrDb.SeedSeconds = seconds
+		AddTorrentDB(torrDb)
+	}
+}
+
+// SetSeedPolicy sets own seeding policy of torrent, nil - global policy
+func (t *Torrent) SetSeedPolicy(p *settings.SeedPolicy) {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	t.SeedPolicy = p
+}
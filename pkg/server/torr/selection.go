@@ -0,0 +1,153 @@
+package torr
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+)
+
+// selection returns paths of unwanted files and select-only indexes not applied yet
+func (t *Torrent) selection() ([]string, []int) {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	return slices.Clone(t.Unwanted), slices.Clone(t.SelectOnly)
+}
+
+// fileWanted reports whether file with path in torrent is selected for download
+func (t *Torrent) fileWanted(path string) bool {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	return !slices.Contains(t.Unwanted, path)
+}
+
+// SetUnwanted sets files which are not downloaded by preload and keep, empty paths - all files are wanted
+func (t *Torrent) SetUnwanted(paths []string) {
+	t.muTorrent.Lock()
+	t.Unwanted = slices.Clone(paths)
+	t.SelectOnly = nil
+	kept := t.keep != nil
+	t.muTorrent.Unlock()
+	t.applySelection()
+	if kept {
+		// files of keep job are chosen on start
+		t.stopKeep()
+		if err := t.applyKeep(); err != nil {
+			log.TLogln("Error keep torrent:", err)
+		}
+	}
+}
+
+// SetSelectOnly sets BEP 53 indexes of files to download, others are unwanted.
+// Indexes are in order of files in metadata, they are applied when metadata is received
+func (t *Torrent) SetSelectOnly(idx []int) {
+	if len(idx) == 0 {
+		return
+	}
+	t.muTorrent.Lock()
+	t.SelectOnly = slices.Clone(idx)
+	t.muTorrent.Unlock()
+	t.applySelection()
+}
+
+// applySelection lowers priority of unwanted files and marks their pieces in cache
+func (t *Torrent) applySelection() {
+	if t.Torrent == nil || t.Torrent.Info() == nil {
+		return
+	}
+	info := t.Torrent.Info()
+	files := t.Files()
+
+	t.muTorrent.Lock()
+	if len(t.SelectOnly) > 0 {
+		// BEP 53 indexes are in order of files in metainfo, paths are built as torrent.File.Path
+		var unwanted []string
+		for i, fi := range info.UpvertedFiles() {
+			if !slices.Contains(t.SelectOnly, i) {
+				unwanted = append(unwanted, strings.Join(append([]string{info.BestName()}, fi.BestPath()...), "/"))
+			}
+		}
+		t.Unwanted = unwanted
+		t.SelectOnly = nil
+	}
+	unwanted := t.Unwanted
+	cache := t.cache
+	t.muTorrent.Unlock()
+
+	var pieces []bool
+	if len(unwanted) > 0 {
+		// piece is unwanted when all files in it are unwanted
+		pieces = make([]bool, info.NumPieces())
+		for i := range pieces {
+			pieces[i] = true
+		}
+		for _, f := range files {
+			if slices.Contains(unwanted, f.Path()) {
+				f.SetPriority(torrent.PiecePriorityNone)
+				continue
+			}
+			if f.Length() == 0 {
+				continue
+			}
+			first := int(f.Offset() / info.PieceLength)
+			last := int((f.Offset() + f.Length() - 1) / info.PieceLength)
+			for i := first; i <= last && i < len(pieces); i++ {
+				pieces[i] = false
+			}
+		}
+	}
+	if cache != nil {
+		cache.SetUnwanted(pieces)
+	}
+}
+
+// ParseSelectOnly parses BEP 53 list of indexes and ranges like "0,2,4-6"
+func ParseSelectOnly(s string) ([]int, error) {
+	var ret []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("wrong select-only index: %s", part)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(to); err != nil || last < first {
+				return nil, fmt.Errorf("wrong select-only range: %s", part)
+			}
+		}
+		for i := first; i <= last; i++ {
+			if !slices.Contains(ret, i) {
+				ret = append(ret, i)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// SelectOnlyFromMagnet returns file indexes of so parameters of magnet, wrong values are skipped
+func SelectOnlyFromMagnet(m metainfo.Magnet) []int {
+	var ret []int
+	for _, so := range m.Params["so"] {
+		idx, err := ParseSelectOnly(so)
+		if err != nil {
+			log.TLogln("Error magnet select-only:", err)
+			continue
+		}
+		for _, i := range idx {
+			if !slices.Contains(ret, i) {
+				ret = append(ret, i)
+			}
+		}
+	}
+	return ret
+}
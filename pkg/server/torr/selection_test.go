@@ -0,0 +1,67 @@
+package torr
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"slices"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// unsortedTestSpec builds torrent whose files in metainfo are not in order of paths, each file is one piece
+func unsortedTestSpec(t *testing.T) *torrent.TorrentSpec {
+	t.Helper()
+	info := metainfo.Info{Name: "test", PieceLength: testPieceLength}
+	for _, path := range [][]string{{"b.bin"}, {"a.bin"}, {"c", "d.bin"}, {"10.bin"}, {"9.bin"}} {
+		data := make([]byte, testPieceLength)
+		rand.Read(data)
+		sum := sha1.Sum(data)
+		info.Files = append(info.Files, metainfo.FileInfo{Path: path, Length: testPieceLength})
+		info.Pieces = append(info.Pieces, sum[:]...)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &torrent.TorrentSpec{InfoBytes: infoBytes, InfoHash: metainfo.Hash(sha1.Sum(infoBytes))}
+}
+
+func TestSelectOnlyOrder(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	spec := unsortedTestSpec(t)
+	torr := addTestTorrent(t, bt, spec)
+
+	// BEP 53 indexes are in order of metainfo
+	torr.SetSelectOnly([]int{0, 2, 4})
+	unwanted, selectOnly := torr.selection()
+	if want := []string{"test/a.bin", "test/10.bin"}; !slices.Equal(unwanted, want) || selectOnly != nil {
+		t.Fatalf("unwanted %v select-only %v, want %v", unwanted, selectOnly, want)
+	}
+
+	// ids of web are in order of paths, files of DB get the same ids
+	files := GetTorrentFiles(spec.InfoHash.HexString())
+	dbFiles := infoFileStats(torr.Info())
+	var paths []string
+	for i, f := range files {
+		paths = append(paths, f.Path)
+		if f.Id != i+1 || dbFiles[i].Id != f.Id || dbFiles[i].Path != f.Path {
+			t.Errorf("file %d %s, file of DB %d %s", f.Id, f.Path, dbFiles[i].Id, dbFiles[i].Path)
+		}
+		if f.Unwanted != slices.Contains(unwanted, f.Path) {
+			t.Errorf("file %s unwanted %v", f.Path, f.Unwanted)
+		}
+	}
+	if want := []string{"test/9.bin", "test/10.bin", "test/a.bin", "test/b.bin", "test/c/d.bin"}; !slices.Equal(paths, want) {
+		t.Fatalf("files %v, want %v", paths, want)
+	}
+	if err := SetFileWanted(spec.InfoHash.HexString(), []int{2, 4}); err != nil {
+		t.Fatal(err)
+	}
+	unwanted, _ = torr.selection()
+	if want := []string{"test/9.bin", "test/a.bin", "test/c/d.bin"}; !slices.Equal(unwanted, want) {
+		t.Fatalf("unwanted %v, want %v", unwanted, want)
+	}
+}
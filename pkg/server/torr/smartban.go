@@ -0,0 +1,168 @@
+package torr
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+)
+
+// The client drops the least trusted peer of a piece which failed hash check,
+// but doesn't ban it and doesn't export peers which sent blocks of the piece.
+// Pieces touched by peer are listed in status of the client till they are hashed,
+// so peers which requested the failed piece and lost touched pieces or were dropped
+// by its hash check share a strike, peers with SmartBanFailures strikes are banned in the ip filter.
+// Touched pieces are reaped by passed checks too, so only the sole toucher gets the whole strike.
+
+// samples older than it can't tell which peers touched the failed piece
+const smartBanSampleAge = 3 * time.Second
+
+// pieceFailure is piece which failed hash check at time
+type pieceFailure struct {
+	piece int
+	time  time.Time
+}
+
+func smartBanEnabled() bool {
+	return settings.BTsets != nil && !settings.BTsets.DisableSmartBan
+}
+
+// pieceFailed queues piece which may have failed hash check till peers are sampled after it
+func (t *Torrent) pieceFailed(piece int) {
+	if !smartBanEnabled() {
+		return
+	}
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if slices.ContainsFunc(t.failedPieces, func(f pieceFailure) bool { return f.piece == piece }) {
+		return
+	}
+	t.failedPieces = append(t.failedPieces, pieceFailure{piece, time.Now()})
+}
+
+// confirmFailures returns pieces which really failed hash check. The client publishes
+// the same state when priority of piece is updated around its check,
+// pieces which passed it are complete by now and rechecked pieces are queued again
+func (t *Torrent) confirmFailures(fs []pieceFailure) []pieceFailure {
+	var ret []pieceFailure
+	for _, f := range fs {
+		if ps := t.Torrent.PieceState(f.piece); !ps.Complete && !ps.Checking {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// smartBanTick samples peers of downloading torrent and strikes peers which touched failed pieces
+func (t *Torrent) smartBanTick() {
+	if !smartBanEnabled() {
+		return
+	}
+	t.muTorrent.Lock()
+	if t.Torrent == nil || t.Torrent.Info() == nil {
+		t.muTorrent.Unlock()
+		return
+	}
+	failed := len(t.failedPieces)
+	prev, prevTime := t.peerSamples, t.peersSampled
+	downloading := t.DownloadSpeed > 0
+	t.muTorrent.Unlock()
+
+	if failed == 0 && !downloading {
+		return
+	}
+	t.Peers()
+	if failed == 0 {
+		return
+	}
+
+	t.muTorrent.Lock()
+	cur, curTime := t.peerSamples, t.peersSampled
+	// failures after the status was written wait for the next sample
+	var ready, later []pieceFailure
+	for _, f := range t.failedPieces {
+		if f.time.After(curTime) {
+			later = append(later, f)
+		} else {
+			ready = append(ready, f)
+		}
+	}
+	t.failedPieces = later
+	t.muTorrent.Unlock()
+
+	hash := t.Hash().HexString()
+	for _, f := range t.confirmFailures(ready) {
+		if f.time.Before(prevTime) || f.time.Sub(prevTime) > smartBanSampleAge {
+			log.TLogln("Piece", f.piece, "failed hash check, torrent:", hash)
+			continue
+		}
+		t.bt.strikeTouchers(pieceTouchers(f.piece, prev, cur), hash)
+	}
+}
+
+// pieceTouchers returns peers which requested piece before its hash check and whose touched pieces were reaped by it
+func pieceTouchers(piece int, prev, cur map[string]*peerSample) []string {
+	var addrs []string
+	for addr, p := range prev {
+		if p.touched == 0 || !slices.Contains(p.next, piece) {
+			continue
+		}
+		// the client drops the least trusted peer of failed piece
+		if c, ok := cur[addr]; ok && c.touched >= p.touched {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// strikeTouchers splits strike of failed piece between peers which touched it
+func (bt *BTServer) strikeTouchers(addrs []string, hash string) {
+	for _, addr := range addrs {
+		bt.strikePeer(addr, hash, 1/float64(len(addrs)))
+	}
+}
+
+// strikePeer counts share of corrupt piece of peer and bans peer with too many of them
+func (bt *BTServer) strikePeer(addr, hash string, share float64) {
+	ip, _, err := parsePeerAddr(addr, false)
+	if err != nil {
+		return
+	}
+	key := ip.String()
+	bt.mu.Lock()
+	bt.strikes[key] += share
+	n := bt.strikes[key]
+	bt.mu.Unlock()
+	log.TLogln("Peer", addr, "sent corrupt piece of", hash, "failures:", fmt.Sprintf("%.2f", n))
+	// shares of several pieces may sum up to a bit less than whole strikes
+	if n+1e-9 < float64(settings.BTsets.SmartBanFailures) {
+		return
+	}
+
+	bt.mu.Lock()
+	delete(bt.strikes, key)
+	bt.mu.Unlock()
+	reason := fmt.Sprintf("sent %.0f corrupt pieces", n)
+	if !bt.filter.Ban(ip, reason) {
+		return
+	}
+	log.TLogln("Smart ban peer", addr+":", reason)
+	bt.dropPeer(ip)
+	if settings.BTsets.SmartBanPersist {
+		settings.SetBan(key, reason)
+	}
+	publish(&PeerBannedEvent{Hash: hash, Addr: addr, Reason: reason})
+}
+
+// restoreBans bans peers saved by smart ban
+func (bt *BTServer) restoreBans() {
+	for ip, ban := range settings.ListBans() {
+		if addr := net.ParseIP(ip); addr != nil {
+			bt.filter.Ban(addr, ban.Reason)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package torr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+const testStatusHash = "0123456789abcdef0123456789abcdef01234567"
+
+// testStatus writes connections of torrent like status of the client does
+func testStatus(conns ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Infohash: %s\nNum Pieces: 40 (3 completed)\n", testStatusHash)
+	for i, c := range conns {
+		fmt.Fprintf(&b, "%2d. %s", i+1, c)
+	}
+	return b.String()
+}
+
+func testConn(addr string, touched, useful int, next string) string {
+	return fmt.Sprintf("%-55q 0000000000100005 127.0.0.1:6881-%s\n"+
+		"    last msg: 1s ago, connected: 20.5s ago, last helpful: 1s ago, itime: 10s, etime: 10s\n"+
+		"    40/40 completed, %d pieces touched, good chunks: %d/%d-0 reqq: (25,50,250]-0, flags: i-EH-, dr: 120.5 KiB/s\n"+
+		"    next pieces: [%s]\n", "-qB4650-abcdefghijkl", addr, touched, useful, useful, next)
+}
+
+func TestParsePeers(t *testing.T) {
+	status := testStatus(testConn("10.0.0.1:51000", 2, 30, "5 6 7"), testConn("10.0.0.2:51000", 0, 4, ""))
+	peers, samples := parsePeers(strings.NewReader(status), testStatusHash)
+	if len(peers) != 2 {
+		t.Fatalf("%d peers parsed", len(peers))
+	}
+	if p := peers[0]; p.Addr != "10.0.0.1:51000" || p.Client != "qBittorrent 4.6.5" || p.Pieces != 40 || !p.Encrypted {
+		t.Fatalf("wrong peer: %+v", p)
+	}
+	s := samples["10.0.0.1:51000"]
+	if s.touched != 2 || s.downChunks != 30 || !slices.Equal(s.next, []int{5, 6, 7}) {
+		t.Fatalf("wrong sample: %+v", s)
+	}
+	if s = samples["10.0.0.2:51000"]; s.touched != 0 || len(s.next) != 0 {
+		t.Fatalf("wrong sample: %+v", s)
+	}
+}
+
+func TestParseClientStatus(t *testing.T) {
+	skipRace(t)
+	seeder := newTestBTS(t, 256*testPieceLength)
+	leecher := newTestBTS(t, 256*testPieceLength)
+	spec, data := testSpec(t, 128*testPieceLength)
+	seed := addTestTorrent(t, seeder, spec)
+	fillPieces(seed, data, 0, seed.Info().NumPieces()-1)
+	leech := addTestTorrent(t, leecher, spec)
+	connectTestPeer(leech, seeder)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go readTestFile(ctx, leech, leech.Files()[0])
+
+	// connection is listed while torrent is downloaded, seeds don't keep connections to each other
+	addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+	for ctx.Err() == nil {
+		var buf bytes.Buffer
+		leecher.client.WriteStatus(&buf)
+		peers, samples := parsePeers(&buf, spec.InfoHash.HexString())
+		if len(peers) == 0 {
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+		p := peers[0]
+		if len(peers) != 1 || p.Addr != addr || !strings.HasPrefix(p.Client, "anacrolix/torrent") ||
+			p.Pieces != 128 || p.TotalPieces != 128 {
+			t.Fatalf("wrong peer: %+v", p)
+		}
+		if s := samples[addr]; s == nil || len(s.next) == 0 {
+			t.Fatalf("wrong sample of peer: %+v", s)
+		}
+		return
+	}
+	t.Fatal("no connection in status of the client")
+}
+
+func TestPieceTouchers(t *testing.T) {
+	_, prev := parsePeers(strings.NewReader(testStatus(
+		testConn("10.0.0.1:51000", 2, 30, "5 6 7"), // sent blocks of 6, its touched piece is reaped
+		testConn("10.0.0.2:51000", 1, 10, "6 7"),   // dropped by the client after hash check
+		testConn("10.0.0.3:51000", 1, 10, "6 7"),   // still touches its piece
+		testConn("10.0.0.4:51000", 1, 10, "8 9"),   // doesn't have piece 6
+		testConn("10.0.0.5:51000", 0, 0, "6"),      // hasn't sent anything
+	)), testStatusHash)
+	_, cur := parsePeers(strings.NewReader(testStatus(
+		testConn("10.0.0.1:51000", 1, 40, "6 7"),
+		testConn("10.0.0.3:51000", 1, 20, "6 7"),
+		testConn("10.0.0.4:51000", 0, 20, "9"),
+		testConn("10.0.0.5:51000", 0, 0, "6"),
+	)), testStatusHash)
+
+	got := pieceTouchers(6, prev, cur)
+	slices.Sort(got)
+	if want := []string{"10.0.0.1:51000", "10.0.0.2:51000"}; !slices.Equal(got, want) {
+		t.Fatalf("touchers of failed piece: %v, want %v", got, want)
+	}
+}
+
+func TestStrikeTouchers(t *testing.T) {
+	bt := NewBTS()
+	// honest peer shares every corrupt piece with the bad one
+	for i := 0; i < settings.BTsets.SmartBanFailures; i++ {
+		bt.strikeTouchers([]string{"10.0.0.1:51000", "10.0.0.2:51000"}, testStatusHash)
+	}
+	if banned := bt.filter.Banned(); len(banned) != 0 {
+		t.Fatalf("co-contributors of corrupt pieces are banned: %v", banned)
+	}
+	for i := 0; i < settings.BTsets.SmartBanFailures; i++ {
+		bt.strikeTouchers([]string{"10.0.0.3:51000"}, testStatusHash)
+	}
+	if banned := bt.filter.Banned(); len(banned) != 1 || banned["10.0.0.3"] == "" {
+		t.Fatalf("sole sender of corrupt pieces isn't banned: %v", banned)
+	}
+}
+
+func TestBanPeerDropsConnection(t *testing.T) {
+	skipRace(t)
+	seeder := newTestBTS(t, 64*testPieceLength)
+	leecher := newTestBTS(t, 64*testPieceLength)
+	spec, data := testSpec(t, 32*testPieceLength)
+	seed := addTestTorrent(t, seeder, spec)
+	fillPieces(seed, data, 0, seed.Info().NumPieces()-1)
+	// slow upload keeps connection open
+	seed.SetLimits(0, 1, state.PriorityNormal)
+	leech := addTestTorrent(t, leecher, spec)
+	connectTestPeer(leech, seeder)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go readTestFile(ctx, leech, leech.Files()[0])
+
+	for leech.Torrent.Stats().ActivePeers == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("peer isn't connected")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := leecher.BanPeer("127.0.0.1", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if n := leech.Torrent.Stats().ActivePeers; n != 0 {
+		t.Fatalf("%d connections to banned peer", n)
+	}
+	// banned peer isn't connected again
+	connectTestPeer(leech, seeder)
+	time.Sleep(500 * time.Millisecond)
+	if n := leech.Torrent.Stats().ActivePeers; n != 0 {
+		t.Fatalf("banned peer is connected again: %d", n)
+	}
+}
+
+func TestConfirmFailures(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	spec, data := testSpec(t, 4*testPieceLength)
+	torr := addTestTorrent(t, bt, spec)
+
+	// state of passed piece is published like failed one while its priority is updated
+	fillPieces(torr, data, 0, 0)
+	p := torr.Torrent.Piece(1)
+	p.Storage().WriteAt(make([]byte, testPieceLength), 0)
+	p.VerifyData()
+	now := time.Now()
+	fs := torr.confirmFailures([]pieceFailure{{0, now}, {1, now}})
+	if len(fs) != 1 || fs[0].piece != 1 {
+		t.Fatalf("wrong confirmed failures: %v", fs)
+	}
+
+	// every check of piece publishes the state twice
+	tt := &Torrent{}
+	tt.pieceFailed(1)
+	tt.pieceFailed(1)
+	if len(tt.failedPieces) != 1 {
+		t.Fatalf("piece is queued %d times", len(tt.failedPieces))
+	}
+}
@@ -64,12 +64,178 @@ type TorrentStatus struct {
 	PiecesDirtiedBad    int64       `json:"pieces_dirtied_bad,omitempty"`
 	DurationSeconds     float64     `json:"duration_seconds,omitempty"`
 	BitRate             string      `json:"bit_rate,omitempty"`
+	DownloadLimit       int         `json:"download_limit,omitempty"` // effective, in kb
+	UploadLimit         int         `json:"upload_limit,omitempty"`   // effective, in kb
+	Priority            string      `json:"priority,omitempty"`       // effective
+	MaxConnections      int         `json:"max_connections,omitempty"`
+	Uploaded            int64       `json:"uploaded,omitempty"`   // all sessions
+	Downloaded          int64       `json:"downloaded,omitempty"` // all sessions
+	SeedSeconds         int64       `json:"seed_seconds,omitempty"`
+	Seeding             bool        `json:"seeding,omitempty"`
 
 	FileStats []*TorrentFileStat `json:"file_stats,omitempty"`
 }
 
 type TorrentFileStat struct {
-	Id     int    `json:"id,omitempty"`
-	Path   string `json:"path,omitempty"`
-	Length int64  `json:"length,omitempty"`
+	Id       int    `json:"id,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Length   int64  `json:"length,omitempty"`
+	Unwanted bool   `json:"unwanted,omitempty"`
+}
+
+type TorrentPriority int
+
+const (
+	PriorityAuto = TorrentPriority(iota) // high while streaming, low while preloading
+	PriorityLow
+	PriorityNormal
+	PriorityHigh
+)
+
+func (p TorrentPriority) String() string {
+	switch p {
+	case PriorityAuto:
+		return "auto"
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+func ParsePriority(s string) (TorrentPriority, bool) {
+	for p := PriorityAuto; p <= PriorityHigh; p++ {
+		if p.String() == s {
+			return p, true
+		}
+	}
+	return PriorityAuto, false
+}
+
+type KeepStatus struct {
+	Path      string   `json:"path"`
+	Files     []string `json:"files,omitempty"`
+	Paused    bool     `json:"paused"`
+	Seed      bool     `json:"seed"`
+	Completed int64    `json:"completed"`
+	Total     int64    `json:"total"`
+	Done      bool     `json:"done"`
+}
+
+type TrackerStatus struct {
+	URL          string `json:"url"`
+	Tier         int    `json:"tier"`
+	Source       string `json:"source"`                  // torrent, retracker or file
+	LastAnnounce int64  `json:"last_announce,omitempty"` // unix time
+	NextAnnounce int64  `json:"next_announce,omitempty"` // unix time
+	Peers        int    `json:"peers"`
+	Seeders      int    `json:"seeders"`
+	Leechers     int    `json:"leechers"`
+	Error        string `json:"error,omitempty"`
+	Updating     bool   `json:"updating"`
+}
+
+type PeerStat struct {
+	Addr             string  `json:"addr"`
+	PeerID           string  `json:"peer_id"`
+	Client           string  `json:"client"`
+	Network          string  `json:"network"` // tcp or utp
+	Encrypted        bool    `json:"encrypted"`
+	Source           string  `json:"source"`   // tracker, dht, pex, incoming, manual
+	Extended         bool    `json:"extended"` // supports extension protocol, BEP 10
+	DownloadSpeed    float64 `json:"download_speed"`
+	UploadSpeed      float64 `json:"upload_speed"`
+	Pieces           int     `json:"pieces"`
+	TotalPieces      int     `json:"total_pieces"`
+	AmInterested     bool    `json:"am_interested"`
+	AmChoking        bool    `json:"am_choking"`
+	PeerInterested   bool    `json:"peer_interested"`
+	PeerChoking      bool    `json:"peer_choking"`
+	ConnectedSeconds int64   `json:"connected_seconds"`
+}
+
+type BlocklistSource struct {
+	URL     string `json:"url"` // "blocklist" for file near settings
+	Ranges  int    `json:"ranges"`
+	Updated int64  `json:"updated"` // unix time
+	Error   string `json:"error,omitempty"`
+}
+
+type BlocklistStats struct {
+	Ranges   int                `json:"ranges"` // merged ranges of all sources
+	Banned   int                `json:"banned"`
+	Rejected int64              `json:"rejected"` // peers rejected since start
+	Loaded   int64              `json:"loaded"`   // unix time
+	Updating bool               `json:"updating"`
+	Sources  []*BlocklistSource `json:"sources"`
+}
+
+type NetInterface struct {
+	Name       string   `json:"name"` // interface name or address from settings, empty - not bound
+	Found      bool     `json:"found"`
+	Up         bool     `json:"up"`
+	Addrs      []string `json:"addrs"`
+	KillSwitch bool     `json:"killSwitch"`
+	Paused     bool     `json:"paused"`  // torrents are paused by kill switch
+	Checked    int64    `json:"checked"` // unix time
+}
+
+// WebSeedStatus is state of http source of torrent, BEP 19
+type WebSeedStatus struct {
+	URL        string `json:"url"`
+	Downloaded int64  `json:"downloaded"` // bytes of pieces passed hash check
+	Active     int    `json:"active"`     // pieces fetched now
+	Error      string `json:"error,omitempty"`
+	RetryAt    int64  `json:"retryAt,omitempty"` // unix time, source isn't used till then after error
+}
+
+// CreateProgress is progress of torrent creation from local files
+type CreateProgress struct {
+	Path        string `json:"path"`   // source file or directory
+	Output      string `json:"output"` // written .torrent, empty - not written
+	Hash        string `json:"hash"`   // known when pieces are hashed
+	Name        string `json:"name"`
+	Files       int    `json:"files"`
+	PieceLength int64  `json:"pieceLength"`
+	Pieces      int    `json:"pieces"`
+	Hashed      int64  `json:"hashed"`
+	Total       int64  `json:"total"`
+	Started     int64  `json:"started"` // unix time
+	Done        bool   `json:"done"`
+	Seeding     bool   `json:"seeding"`
+	Error       string `json:"error,omitempty"`
+}
+
+type MetadataProgress struct {
+	Attempt       int    `json:"attempt"`
+	Attempts      int    `json:"attempts"`
+	Peers         int    `json:"peers"` // known peers
+	ActivePeers   int    `json:"activePeers"`
+	ExtendedPeers int    `json:"extendedPeers"` // connected peers with extension protocol of BEP 10, only they may send metadata
+	Size          int64  `json:"size"`          // 0 - unknown yet
+	Received      int64  `json:"received"`
+	Started       int64  `json:"started"` // unix time
+	Done          bool   `json:"done"`
+	Error         string `json:"error,omitempty"` // failure reason
+}
+
+// BufferStatus is progress of buffering of file before playback, target is data from position
+// which lets file play without stalling at current download speed
+type BufferStatus struct {
+	Hash     string  `json:"hash"`
+	FileId   int     `json:"fileId"`
+	Position int64   `json:"position"`
+	Ready    int64   `json:"ready"` // complete data from position
+	Target   int64   `json:"target"`
+	Percent  float64 `json:"percent"`
+	ETA      float64 `json:"eta"`     // in seconds, -1 - unknown
+	Speed    float64 `json:"speed"`   // download speed in bytes
+	BitRate  int64   `json:"bitRate"` // bits per second, 0 - unknown
+	Duration float64 `json:"duration"`
+	Done     bool    `json:"done"`
+	Capped   bool    `json:"capped"` // target is limited by cache, playback may stall
 }
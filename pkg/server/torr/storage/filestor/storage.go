@@ -0,0 +1,78 @@
+package filestor
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	ts "github.com/anacrolix/torrent/storage"
+)
+
+// Storage keeps torrents in real files with the layout of torrent under dir,
+// it is used for torrents in keep mode alongside the rolling cache of torrstor
+type Storage struct {
+	dir string
+
+	torrents map[metainfo.Hash]*Torrent
+	mu       sync.Mutex
+}
+
+func NewStorage(dir string) *Storage {
+	return &Storage{
+		dir:      dir,
+		torrents: make(map[metainfo.Hash]*Torrent),
+	}
+}
+
+func (s *Storage) Dir() string {
+	return s.dir
+}
+
+func (s *Storage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (ts.TorrentImpl, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.torrents[infoHash]; ok {
+		return t, nil
+	}
+	t := newTorrent(s, info, infoHash)
+	s.torrents[infoHash] = t
+	return t, nil
+}
+
+// CloseHash closes storage of torrent, files stay on disk
+func (s *Storage) CloseHash(hash metainfo.Hash) {
+	s.mu.Lock()
+	t, ok := s.torrents[hash]
+	delete(s.torrents, hash)
+	s.mu.Unlock()
+	if ok {
+		t.save()
+	}
+}
+
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	list := s.torrents
+	s.torrents = make(map[metainfo.Hash]*Torrent)
+	s.mu.Unlock()
+	for _, t := range list {
+		t.save()
+	}
+	return nil
+}
+
+// SetCompleted saves all pieces of torrent as completed, it is used for files verified before,
+// it must be called before the torrent is opened
+func (s *Storage) SetCompleted(hash metainfo.Hash, pieces int) error {
+	buf := make([]byte, (pieces+7)/8)
+	for i := 0; i < pieces; i++ {
+		buf[i/8] |= 1 << (7 - uint(i%8))
+	}
+	return os.WriteFile(s.completionName(hash), buf, 0o666)
+}
+
+// completionName is name of file with completed pieces of torrent
+func (s *Storage) completionName(hash metainfo.Hash) string {
+	return filepath.Join(s.dir, "."+hash.HexString()+".keep")
+}
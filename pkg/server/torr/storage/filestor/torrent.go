@@ -0,0 +1,235 @@
+package filestor
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	ts "github.com/anacrolix/torrent/storage"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+)
+
+var errBadPath = errors.New("bad file path in torrent")
+
+type Torrent struct {
+	storage *Storage
+	info    *metainfo.Info
+	hash    metainfo.Hash
+
+	files []fileSpan
+
+	complete []bool
+	mu       sync.Mutex
+}
+
+type fileSpan struct {
+	path   string // empty for unsafe paths
+	offset int64
+	length int64
+}
+
+func newTorrent(s *Storage, info *metainfo.Info, hash metainfo.Hash) *Torrent {
+	t := &Torrent{
+		storage:  s,
+		info:     info,
+		hash:     hash,
+		complete: make([]bool, info.NumPieces()),
+	}
+	var offset int64
+	for _, fi := range info.UpvertedFiles() {
+		t.files = append(t.files, fileSpan{
+			path:   t.filePath(fi.Path),
+			offset: offset,
+			length: fi.Length,
+		})
+		offset += fi.Length
+	}
+	t.load()
+	return t
+}
+
+// filePath returns path of file on disk like other clients save it
+func (t *Torrent) filePath(path []string) string {
+	parts := append([]string{t.storage.dir, t.info.Name}, path...)
+	for _, p := range parts[1:] {
+		if p == ".." || strings.ContainsAny(p, `/\`) {
+			return ""
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+func (t *Torrent) Piece(p metainfo.Piece) ts.PieceImpl {
+	return &Piece{t: t, p: p}
+}
+
+func (t *Torrent) Close() error {
+	t.storage.CloseHash(t.hash)
+	return nil
+}
+
+func (t *Torrent) isComplete(i int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return i >= 0 && i < len(t.complete) && t.complete[i]
+}
+
+func (t *Torrent) setComplete(i int, complete bool) {
+	t.mu.Lock()
+	changed := i >= 0 && i < len(t.complete) && t.complete[i] != complete
+	if changed {
+		t.complete[i] = complete
+	}
+	t.mu.Unlock()
+	if changed {
+		t.save()
+	}
+}
+
+// BytesCompleted returns count of completed bytes in range of torrent
+func (t *Torrent) BytesCompleted(off, length int64) int64 {
+	pl := t.info.PieceLength
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ret int64
+	for i := off / pl; i < int64(len(t.complete)) && i*pl < off+length; i++ {
+		if !t.complete[i] {
+			continue
+		}
+		start, end := i*pl, (i+1)*pl
+		if start < off {
+			start = off
+		}
+		if end > off+length {
+			end = off + length
+		}
+		ret += end - start
+	}
+	return ret
+}
+
+// load reads completed pieces saved by the previous session
+func (t *Torrent) load() {
+	buf, err := os.ReadFile(t.storage.completionName(t.hash))
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.complete {
+		if i/8 < len(buf) {
+			t.complete[i] = buf[i/8]&(1<<(7-uint(i%8))) != 0
+		}
+	}
+}
+
+func (t *Torrent) save() {
+	t.mu.Lock()
+	buf := make([]byte, (len(t.complete)+7)/8)
+	for i, c := range t.complete {
+		if c {
+			buf[i/8] |= 1 << (7 - uint(i%8))
+		}
+	}
+	t.mu.Unlock()
+
+	if err := os.MkdirAll(t.storage.dir, 0o777); err != nil {
+		log.TLogln("Error create dir:", err)
+		return
+	}
+	if err := os.WriteFile(t.storage.completionName(t.hash), buf, 0o666); err != nil {
+		log.TLogln("Error save keep state:", err)
+	}
+}
+
+// spans calls fn for every part of files in range of torrent
+func (t *Torrent) spans(off int64, n int, fn func(f fileSpan, fileOff int64, from, to int) error) error {
+	end := off + int64(n)
+	for _, f := range t.files {
+		if f.offset+f.length <= off || f.offset >= end || f.length == 0 {
+			continue
+		}
+		start := off
+		if start < f.offset {
+			start = f.offset
+		}
+		stop := end
+		if stop > f.offset+f.length {
+			stop = f.offset + f.length
+		}
+		if f.path == "" {
+			return errBadPath
+		}
+		if err := fn(f, start-f.offset, int(start-off), int(stop-off)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Piece struct {
+	t *Torrent
+	p metainfo.Piece
+}
+
+func (p *Piece) WriteAt(b []byte, off int64) (n int, err error) {
+	err = p.t.spans(p.p.Offset()+off, len(b), func(f fileSpan, fileOff int64, from, to int) error {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o777); err != nil {
+			return err
+		}
+		ff, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE, 0o666)
+		if err != nil {
+			return err
+		}
+		defer ff.Close()
+		w, err := ff.WriteAt(b[from:to], fileOff)
+		n += w
+		return err
+	})
+	if err != nil {
+		log.TLogln("Error write keep file:", err)
+	}
+	return
+}
+
+func (p *Piece) ReadAt(b []byte, off int64) (n int, err error) {
+	err = p.t.spans(p.p.Offset()+off, len(b), func(f fileSpan, fileOff int64, from, to int) error {
+		ff, err := os.Open(f.path)
+		if os.IsNotExist(err) {
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+		defer ff.Close()
+		r, err := ff.ReadAt(b[from:to], fileOff)
+		n += r
+		return err
+	})
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (p *Piece) MarkComplete() error {
+	p.t.setComplete(p.p.Index(), true)
+	return nil
+}
+
+func (p *Piece) MarkNotComplete() error {
+	p.t.setComplete(p.p.Index(), false)
+	return nil
+}
+
+func (p *Piece) Completion() ts.Completion {
+	return ts.Completion{
+		Complete: p.t.isComplete(p.p.Index()),
+		Ok:       true,
+	}
+}
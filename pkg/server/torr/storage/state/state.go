@@ -24,7 +24,8 @@ type ItemState struct {
 }
 
 type ReaderState struct {
-	Start  int
-	End    int
-	Reader int
+	Start     int
+	End       int
+	Reader    int
+	Readahead int64 // in bytes, sized from bitrate of file
 }
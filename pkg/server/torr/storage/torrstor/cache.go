@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/torrent"
@@ -22,8 +23,8 @@ type Cache struct {
 	storage.TorrentImpl
 	storage *Storage
 
-	capacity int64
-	filled   int64
+	capacity atomic.Int64 // changed on the fly by SetCapacity
+	filled   atomic.Int64 // updated on cache clean
 	hash     metainfo.Hash
 
 	pieceLength int64
@@ -34,30 +35,44 @@ type Cache struct {
 	readers   map[*Reader]struct{}
 	muReaders sync.Mutex
 
-	isRemove bool
-	isClosed bool
-	muRemove sync.Mutex
+	isRemove atomic.Bool // clean is in progress
+	isClosed atomic.Bool
 	torrent  *torrent.Torrent
+
+	limits *limits
+
+	info   *metainfo.Info
+	keep   storage.TorrentImpl
+	muKeep sync.Mutex
+
+	// pieces of unwanted files only, they are evicted first
+	unwanted   []bool
+	muUnwanted sync.Mutex
+
+	// pieces of the next file loaded while other file is read, they are evicted last
+	// and keep priority till a reader of the file is opened
+	prefetch     map[int]struct{}
+	prefetchFile string
+	muPrefetch   sync.Mutex
 }
 
 func NewCache(capacity int64, storage *Storage) *Cache {
 	ret := &Cache{
-		capacity: capacity,
-		filled:   0,
-		pieces:   make(map[int]*Piece),
-		storage:  storage,
-		readers:  make(map[*Reader]struct{}),
+		pieces:  make(map[int]*Piece),
+		storage: storage,
+		readers: make(map[*Reader]struct{}),
+		limits:  newLimits(),
 	}
+	ret.capacity.Store(capacity)
 
 	return ret
 }
 
 func (c *Cache) Init(info *metainfo.Info, hash metainfo.Hash) {
 	log.TLogln("Create cache for:", info.Name, hash.HexString())
-	if c.capacity == 0 {
-		c.capacity = info.PieceLength * 4
-	}
+	c.capacity.CompareAndSwap(0, info.PieceLength*4)
 
+	c.info = info
 	c.pieceLength = info.PieceLength
 	c.pieceCount = info.NumPieces()
 	c.hash = hash
@@ -88,9 +103,9 @@ func (c *Cache) Piece(m metainfo.Piece) storage.PieceImpl {
 
 func (c *Cache) Close() error {
 	log.TLogln("Close cache for:", c.hash)
-	c.isClosed = true
+	c.isClosed.Store(true)
 
-	delete(c.storage.caches, c.hash)
+	c.storage.remove(c)
 
 	if settings.BTsets.RemoveCacheOnDrop {
 		name := filepath.Join(settings.BTsets.TorrentsSavePath, c.hash.HexString())
@@ -106,22 +121,27 @@ func (c *Cache) Close() error {
 
 	c.muReaders.Lock()
 	c.readers = nil
-	c.pieces = nil
 	c.muReaders.Unlock()
+	// pieces map is read without lock by client and clean, only their memory is freed
+	for _, p := range c.pieces {
+		if p.mPiece != nil {
+			p.mPiece.Release()
+		}
+	}
 
 	utils.FreeOSMemGC()
 	return nil
 }
 
 func (c *Cache) removePiece(piece *Piece) {
-	if !c.isClosed {
+	if !c.isClosed.Load() {
 		piece.Release()
 	}
 }
 
 func (c *Cache) AdjustRA(readahead int64) {
 	if settings.BTsets.CacheSize == 0 {
-		c.capacity = readahead * 3
+		c.capacity.Store(readahead * 3)
 	}
 	if c.Readers() > 0 {
 		c.muReaders.Lock()
@@ -140,13 +160,13 @@ func (c *Cache) GetState() *state.CacheState {
 
 	if len(c.pieces) > 0 {
 		for _, p := range c.pieces {
-			if p.Size > 0 {
-				fill += p.Size
+			if size := p.Size.Load(); size > 0 {
+				fill += size
 				piecesState[p.Id] = state.ItemState{
 					Id:        p.Id,
-					Size:      p.Size,
+					Size:      size,
 					Length:    c.pieceLength,
-					Completed: p.Complete,
+					Completed: p.Complete.Load(),
 					Priority:  int(c.torrent.PieceState(p.Id).Priority),
 				}
 			}
@@ -161,16 +181,17 @@ func (c *Cache) GetState() *state.CacheState {
 			rng := r.getPiecesRange()
 			pc := r.getReaderPiece()
 			readersState = append(readersState, &state.ReaderState{
-				Start:  rng.Start,
-				End:    rng.End,
-				Reader: pc,
+				Start:     rng.Start,
+				End:       rng.End,
+				Reader:    pc,
+				Readahead: r.Readahead(),
 			})
 		}
 		c.muReaders.Unlock()
 	}
 
-	c.filled = fill
-	cState.Capacity = c.capacity
+	c.filled.Store(fill)
+	cState.Capacity = c.capacity.Load()
 	cState.PiecesLength = c.pieceLength
 	cState.PiecesCount = c.pieceCount
 	cState.Hash = c.hash.HexString()
@@ -181,21 +202,20 @@ func (c *Cache) GetState() *state.CacheState {
 }
 
 func (c *Cache) cleanPieces() {
-	if c.isRemove || c.isClosed {
-		return
-	}
-	c.muRemove.Lock()
-	if c.isRemove {
-		c.muRemove.Unlock()
+	if c.isClosed.Load() || !c.isRemove.CompareAndSwap(false, true) {
 		return
 	}
-	c.isRemove = true
-	defer func() { c.isRemove = false }()
-	c.muRemove.Unlock()
+	defer c.isRemove.Store(false)
 
 	remPieces := c.getRemPieces()
-	if c.filled > c.capacity {
-		rems := (c.filled-c.capacity)/c.pieceLength + 1
+	// unwanted pieces don't stay in cache out of readers
+	for len(remPieces) > 0 && c.isUnwanted(remPieces[0].Id) {
+		c.filled.Add(-remPieces[0].Size.Load())
+		c.removePiece(remPieces[0])
+		remPieces = remPieces[1:]
+	}
+	if filled, capacity := c.filled.Load(), c.capacity.Load(); filled > capacity {
+		rems := (filled-capacity)/c.pieceLength + 1
 		for _, p := range remPieces {
 			c.removePiece(p)
 			rems--
@@ -215,7 +235,7 @@ func (c *Cache) getRemPieces() []*Piece {
 	c.muReaders.Lock()
 	for r := range c.readers {
 		r.checkReader()
-		if r.isUse {
+		if r.isUse.Load() {
 			ranges = append(ranges, r.getPiecesRange())
 		}
 	}
@@ -223,18 +243,19 @@ func (c *Cache) getRemPieces() []*Piece {
 	ranges = mergeRange(ranges)
 
 	for id, p := range c.pieces {
-		if p.Size > 0 {
-			fill += p.Size
+		size := p.Size.Load()
+		if size > 0 {
+			fill += size
 		}
 		if len(ranges) > 0 {
 			if !inRanges(ranges, id) {
-				if p.Size > 0 && !c.isIdInFileBE(ranges, id) {
+				if size > 0 && !c.isIdInFileBE(ranges, id) {
 					piecesRemove = append(piecesRemove, p)
 				}
 			}
 		} else {
 			// on preload clean
-			if p.Size > 0 && !c.isIdInFileBE(ranges, id) {
+			if size > 0 && !c.isIdInFileBE(ranges, id) {
 				piecesRemove = append(piecesRemove, p)
 			}
 		}
@@ -244,17 +265,25 @@ func (c *Cache) getRemPieces() []*Piece {
 	c.setLoadPriority(ranges)
 
 	sort.Slice(piecesRemove, func(i, j int) bool {
-		return piecesRemove[i].Accessed < piecesRemove[j].Accessed
+		ui, uj := c.isUnwanted(piecesRemove[i].Id), c.isUnwanted(piecesRemove[j].Id)
+		if ui != uj {
+			return ui
+		}
+		pi, pj := c.isPrefetch(piecesRemove[i].Id), c.isPrefetch(piecesRemove[j].Id)
+		if pi != pj {
+			return pj
+		}
+		return piecesRemove[i].Accessed.Load() < piecesRemove[j].Accessed.Load()
 	})
 
-	c.filled = fill
+	c.filled.Store(fill)
 	return piecesRemove
 }
 
 func (c *Cache) setLoadPriority(ranges []Range) {
 	c.muReaders.Lock()
 	for r := range c.readers {
-		if !r.isUse {
+		if !r.isUse.Load() {
 			continue
 		}
 		if c.isIdInFileBE(ranges, r.getReaderPiece()) {
@@ -266,7 +295,7 @@ func (c *Cache) setLoadPriority(ranges []Range) {
 		count := settings.BTsets.ConnectionsLimit / len(c.readers) // max concurrent loading blocks
 		limit := 0
 		for i := readerPos; i < end && limit < count; i++ {
-			if !c.pieces[i].Complete {
+			if !c.pieces[i].Complete.Load() {
 				if i == readerPos {
 					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityNow)
 				} else if i == readerPos+1 {
@@ -311,6 +340,13 @@ func (c *Cache) isIdInFileBE(ranges []Range, id int) bool {
 ////////
 
 func (c *Cache) NewReader(file *torrent.File) *Reader {
+	// prefetched file is read now, its pieces are in reader range
+	c.muPrefetch.Lock()
+	if c.prefetchFile == file.Path() {
+		c.prefetch = nil
+		c.prefetchFile = ""
+	}
+	c.muPrefetch.Unlock()
 	return newReader(file, c)
 }
 
@@ -322,7 +358,7 @@ func (c *Cache) GetUseReaders() int {
 	defer c.muReaders.Unlock()
 	readers := 0
 	for reader := range c.readers {
-		if reader.isUse {
+		if reader.isUse.Load() {
 			readers++
 		}
 	}
@@ -342,11 +378,36 @@ func (c *Cache) Readers() int {
 }
 
 func (c *Cache) CloseReader(r *Reader) {
-	r.cache.muReaders.Lock()
+	// reader may be moved to other cache on reconnect
+	cache := r.cache
+	cache.muReaders.Lock()
 	r.Close()
-	delete(r.cache.readers, r)
-	r.cache.muReaders.Unlock()
-	go c.clearPriority()
+	delete(cache.readers, r)
+	cache.muReaders.Unlock()
+	go cache.clearPriority()
+}
+
+// ListReaders returns all readers of the cache
+func (c *Cache) ListReaders() []*Reader {
+	if c == nil {
+		return nil
+	}
+	c.muReaders.Lock()
+	defer c.muReaders.Unlock()
+	readers := make([]*Reader, 0, len(c.readers))
+	for r := range c.readers {
+		readers = append(readers, r)
+	}
+	return readers
+}
+
+// SetCapacity changes cache size on the fly, extra pieces are removed
+func (c *Cache) SetCapacity(capacity int64) {
+	if capacity <= 0 {
+		capacity = c.pieceLength * 4
+	}
+	c.capacity.Store(capacity)
+	go c.cleanPieces()
 }
 
 func (c *Cache) clearPriority() {
@@ -355,7 +416,7 @@ func (c *Cache) clearPriority() {
 	c.muReaders.Lock()
 	for r := range c.readers {
 		r.checkReader()
-		if r.isUse {
+		if r.isUse.Load() {
 			ranges = append(ranges, r.getPiecesRange())
 		}
 	}
@@ -363,6 +424,9 @@ func (c *Cache) clearPriority() {
 	ranges = mergeRange(ranges)
 
 	for id := range c.pieces {
+		if c.isPrefetch(id) {
+			continue
+		}
 		if len(ranges) > 0 {
 			if !inRanges(ranges, id) {
 				if c.torrent.PieceState(id).Priority != torrent.PiecePriorityNone {
@@ -381,5 +445,57 @@ func (c *Cache) GetCapacity() int64 {
 	if c == nil {
 		return 0
 	}
-	return c.capacity
+	return c.capacity.Load()
+}
+
+// Filled returns size of pieces in cache, it is updated on cache clean
+func (c *Cache) Filled() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.filled.Load()
+}
+
+// SetUnwanted sets pieces which belong to unwanted files only, nil - all pieces are wanted
+func (c *Cache) SetUnwanted(pieces []bool) {
+	c.muUnwanted.Lock()
+	c.unwanted = pieces
+	c.muUnwanted.Unlock()
+	go c.cleanPieces()
+}
+
+func (c *Cache) isUnwanted(id int) bool {
+	c.muUnwanted.Lock()
+	defer c.muUnwanted.Unlock()
+	return id >= 0 && id < len(c.unwanted) && c.unwanted[id]
+}
+
+// SetPrefetch marks pieces of file loaded ahead of its reader, nil pieces - no prefetch
+func (c *Cache) SetPrefetch(file *torrent.File, pieces []int) {
+	c.muPrefetch.Lock()
+	defer c.muPrefetch.Unlock()
+	c.prefetch = nil
+	c.prefetchFile = ""
+	if file == nil || len(pieces) == 0 {
+		return
+	}
+	c.prefetch = make(map[int]struct{}, len(pieces))
+	for _, id := range pieces {
+		c.prefetch[id] = struct{}{}
+	}
+	c.prefetchFile = file.Path()
+}
+
+// PrefetchFile returns path of prefetched file, empty - nothing is prefetched or the file is opened
+func (c *Cache) PrefetchFile() string {
+	c.muPrefetch.Lock()
+	defer c.muPrefetch.Unlock()
+	return c.prefetchFile
+}
+
+func (c *Cache) isPrefetch(id int) bool {
+	c.muPrefetch.Lock()
+	defer c.muPrefetch.Unlock()
+	_, ok := c.prefetch[id]
+	return ok
 }
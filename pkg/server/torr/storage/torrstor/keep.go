@@ -0,0 +1,101 @@
+package torrstor
+
+import (
+	"crypto/sha1"
+	"slices"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// SetKeep sets storage where all downloaded pieces are written in addition to cache,
+// pieces evicted from cache are read from it, nil disables keep mode
+func (c *Cache) SetKeep(keep storage.TorrentImpl) {
+	c.muKeep.Lock()
+	c.keep = keep
+	c.muKeep.Unlock()
+	// chunks written to previous keep storage don't count
+	for _, p := range c.pieces {
+		p.resetKeep()
+	}
+
+	// let client know about pieces completed in keep storage,
+	// pieces completed in cache before keep was set are written there first
+	if c.torrent != nil && !c.isClosed.Load() {
+		go func() {
+			for i := 0; i < c.pieceCount && !c.isClosed.Load(); i++ {
+				if keep != nil {
+					c.pieces[i].flushKeep()
+				}
+				c.torrent.Piece(i).UpdateCompletion()
+			}
+		}()
+	}
+}
+
+func (c *Cache) keepPiece(id int) storage.PieceImpl {
+	c.muKeep.Lock()
+	keep := c.keep
+	c.muKeep.Unlock()
+	if keep == nil || c.info == nil {
+		return nil
+	}
+	return keep.Piece(c.info.Piece(id))
+}
+
+func keepComplete(kp storage.PieceImpl) bool {
+	return kp != nil && kp.Completion().Complete
+}
+
+// flushKeep writes piece completed in cache to keep storage
+func (p *Piece) flushKeep() {
+	kp := p.cache.keepPiece(p.Id)
+	if kp == nil || !p.Complete.Load() || keepComplete(kp) {
+		return
+	}
+	info := p.cache.info.Piece(p.Id)
+	buf := make([]byte, info.Length())
+	var err error
+	if p.mPiece != nil {
+		_, err = p.mPiece.ReadAt(buf, 0)
+	} else {
+		_, err = p.dPiece.ReadAt(buf, 0)
+	}
+	// piece may be evicted and loaded again while it is read
+	if err != nil || sha1.Sum(buf) != info.Hash() {
+		return
+	}
+	if _, err = kp.WriteAt(buf, 0); err != nil {
+		return
+	}
+	p.setKeepWritten(0, len(buf))
+	if p.keepWritten() {
+		kp.MarkComplete()
+	}
+}
+
+// setKeepWritten marks chunks of piece covered by n bytes written to keep storage from off
+func (p *Piece) setKeepWritten(off int64, n int) {
+	length := p.cache.info.Piece(p.Id).Length()
+	end := off + int64(n)
+	p.muKeep.Lock()
+	defer p.muKeep.Unlock()
+	if p.keepChunks == nil {
+		p.keepChunks = make([]bool, (length+chunkSize-1)/chunkSize)
+	}
+	for i := (off + chunkSize - 1) / chunkSize; i < int64(len(p.keepChunks)) && min((i+1)*chunkSize, length) <= end; i++ {
+		p.keepChunks[i] = true
+	}
+}
+
+// keepWritten reports whether all chunks of piece are written to keep storage
+func (p *Piece) keepWritten() bool {
+	p.muKeep.Lock()
+	defer p.muKeep.Unlock()
+	return p.keepChunks != nil && !slices.Contains(p.keepChunks, false)
+}
+
+func (p *Piece) resetKeep() {
+	p.muKeep.Lock()
+	p.keepChunks = nil
+	p.muKeep.Unlock()
+}
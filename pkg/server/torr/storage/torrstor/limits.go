@@ -0,0 +1,103 @@
+package torrstor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/german2285/TorrPlayer/pkg/server/torr/utils"
+)
+
+// size of block requested by peers, see defaultChunkSize in torrent
+const chunkSize = 16 * 1024
+
+// errUploadLimit fails read of chunk requested by peer, the client chokes the peer
+// and it requests the chunk again after it is unchoked
+var errUploadLimit = errors.New("torrent is over its upload limit")
+
+// limits of one torrent, applied in addition to the client limits
+type limits struct {
+	down *rate.Limiter
+	up   *rate.Limiter
+
+	// ranges of torrent read locally now, their storage reads are never limited
+	local   map[*LocalRead]struct{}
+	muLocal sync.Mutex
+}
+
+// LocalRead is range of torrent data read by local reader
+type LocalRead struct {
+	start, end int64
+}
+
+func newLimits() *limits {
+	return &limits{
+		down:  utils.Limit(0),
+		up:    utils.Limit(0),
+		local: make(map[*LocalRead]struct{}),
+	}
+}
+
+// SetLimits changes download and upload limits of torrent, in bytes per second, 0 - unlimited
+func (c *Cache) SetLimits(down, up int) {
+	utils.SetLimit(c.limits.down, down)
+	utils.SetLimit(c.limits.up, up)
+}
+
+// waitDownload blocks writing of downloaded data while torrent is over its download limit,
+// client lock is not held while storage is written
+func (c *Cache) waitDownload(n int) {
+	l := c.limits.down
+	if l.Limit() == rate.Inf {
+		return
+	}
+	if n > l.Burst() {
+		n = l.Burst()
+	}
+	l.WaitN(context.Background(), n)
+}
+
+// allowUpload reports whether read of piece which is sent to peer fits upload limit of torrent.
+// Chunks are read by writer of peer with the client lock held, so the read can't wait for the limit.
+// Peers read whole chunks of complete pieces, hashing reads pieces before they complete
+// and local reads are registered by LocalReadOn, the last two are never limited.
+func (c *Cache) allowUpload(p *Piece, off int64, n int) bool {
+	l := c.limits.up
+	if l.Limit() == rate.Inf || n != chunkSize || !p.Completion().Complete {
+		return true
+	}
+	off += int64(p.Id) * c.pieceLength
+	if c.isLocalRead(off, off+int64(n)) {
+		return true
+	}
+	return l.AllowN(time.Now(), min(n, l.Burst()))
+}
+
+// LocalReadOn marks range of torrent from off which is read locally now, its data is not limited
+func (c *Cache) LocalReadOn(off, size int64) *LocalRead {
+	lr := &LocalRead{start: off, end: off + size}
+	c.limits.muLocal.Lock()
+	c.limits.local[lr] = struct{}{}
+	c.limits.muLocal.Unlock()
+	return lr
+}
+
+func (c *Cache) LocalReadOff(lr *LocalRead) {
+	c.limits.muLocal.Lock()
+	delete(c.limits.local, lr)
+	c.limits.muLocal.Unlock()
+}
+
+func (c *Cache) isLocalRead(start, end int64) bool {
+	c.limits.muLocal.Lock()
+	defer c.limits.muLocal.Unlock()
+	for lr := range c.limits.local {
+		if start < lr.end && end > lr.start {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package torrstor
 
 import (
+	"sync"
+	"sync/atomic"
+
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/storage"
 	"github.com/german2285/TorrPlayer/pkg/server/settings"
@@ -9,16 +12,21 @@ import (
 type Piece struct {
 	storage.PieceImpl `json:"-"`
 
-	Id   int   `json:"-"`
-	Size int64 `json:"size"`
+	// state is changed by writes of client and read by cache clean and readers
+	Id   int          `json:"-"`
+	Size atomic.Int64 `json:"size"`
 
-	Complete bool  `json:"complete"`
-	Accessed int64 `json:"accessed"`
+	Complete atomic.Bool  `json:"complete"`
+	Accessed atomic.Int64 `json:"accessed"`
 
 	mPiece *MemPiece  `json:"-"`
 	dPiece *DiskPiece `json:"-"`
 
 	cache *Cache `json:"-"`
+
+	// chunks written to keep storage, piece is marked complete there only when all of them are written
+	keepChunks []bool     `json:"-"`
+	muKeep     sync.Mutex `json:"-"`
 }
 
 func NewPiece(id int, cache *Cache) *Piece {
@@ -36,6 +44,12 @@ func NewPiece(id int, cache *Cache) *Piece {
 }
 
 func (p *Piece) WriteAt(b []byte, off int64) (n int, err error) {
+	p.cache.waitDownload(len(b))
+	if kp := p.cache.keepPiece(p.Id); kp != nil {
+		if n, err := kp.WriteAt(b, off); err == nil {
+			p.setKeepWritten(off, n)
+		}
+	}
 	if !settings.BTsets.UseDisk {
 		return p.mPiece.WriteAt(b, off)
 	} else {
@@ -44,6 +58,13 @@ func (p *Piece) WriteAt(b []byte, off int64) (n int, err error) {
 }
 
 func (p *Piece) ReadAt(b []byte, off int64) (n int, err error) {
+	if !p.cache.allowUpload(p, off, len(b)) {
+		return 0, errUploadLimit
+	}
+	// piece was evicted from cache, but it is kept on disk
+	if kp := p.cache.keepPiece(p.Id); kp != nil && p.Size.Load() == 0 {
+		return kp.ReadAt(b, off)
+	}
 	if !settings.BTsets.UseDisk {
 		return p.mPiece.ReadAt(b, off)
 	} else {
@@ -52,18 +73,29 @@ func (p *Piece) ReadAt(b []byte, off int64) (n int, err error) {
 }
 
 func (p *Piece) MarkComplete() error {
-	p.Complete = true
+	p.Complete.Store(true)
+	if kp := p.cache.keepPiece(p.Id); kp != nil {
+		if p.keepWritten() {
+			return kp.MarkComplete()
+		}
+		// part of piece was loaded before keep was set, whole piece is written from cache
+		go p.flushKeep()
+	}
 	return nil
 }
 
 func (p *Piece) MarkNotComplete() error {
-	p.Complete = false
+	p.Complete.Store(false)
+	p.resetKeep()
+	if kp := p.cache.keepPiece(p.Id); kp != nil {
+		return kp.MarkNotComplete()
+	}
 	return nil
 }
 
 func (p *Piece) Completion() storage.Completion {
 	return storage.Completion{
-		Complete: p.Complete,
+		Complete: p.Complete.Load() || keepComplete(p.cache.keepPiece(p.Id)),
 		Ok:       true,
 	}
 }
@@ -74,7 +106,7 @@ func (p *Piece) Release() {
 	} else {
 		p.dPiece.Release()
 	}
-	if !p.cache.isClosed {
+	if !p.cache.isClosed.Load() {
 		p.cache.torrent.Piece(p.Id).SetPriority(torrent.PiecePriorityNone)
 		p.cache.torrent.Piece(p.Id).UpdateCompletion()
 	}
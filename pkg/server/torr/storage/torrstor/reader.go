@@ -1,8 +1,10 @@
 package torrstor
 
 import (
+	"context"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/torrent"
@@ -13,19 +15,28 @@ import (
 
 type Reader struct {
 	torrent.Reader
-	offset    int64
-	readahead int64
+	// position and state are read by cache clean while reader is used
+	offset    atomic.Int64
+	readahead atomic.Int64
 	file      *torrent.File
 
 	cache    *Cache
-	isClosed bool
+	isClosed atomic.Bool
 
 	///Preload
-	lastAccess int64
-	isUse      bool
+	lastAccess atomic.Int64
+	isUse      atomic.Bool
 	mu         sync.Mutex
+
+	// Reconnect
+	responsive bool
+	suspended  chan struct{} // not nil while BT client reconnects
+	muSwap     sync.Mutex
 }
 
+// max time reader waits for the reconnected torrent
+const resumeTimeout = 2 * time.Minute
+
 func newReader(file *torrent.File, cache *Cache) *Reader {
 	r := new(Reader)
 	r.file = file
@@ -33,7 +44,7 @@ func newReader(file *torrent.File, cache *Cache) *Reader {
 
 	r.SetReadahead(0)
 	r.cache = cache
-	r.isUse = true
+	r.isUse.Store(true)
 
 	cache.muReaders.Lock()
 	cache.readers[r] = struct{}{}
@@ -42,32 +53,47 @@ func newReader(file *torrent.File, cache *Cache) *Reader {
 }
 
 func (r *Reader) Seek(offset int64, whence int) (n int64, err error) {
-	if r.isClosed {
+	if r.isClosed.Load() {
 		return 0, io.EOF
 	}
 	switch whence {
 	case io.SeekStart:
-		r.offset = offset
+		r.offset.Store(offset)
 	case io.SeekCurrent:
-		r.offset += offset
+		r.offset.Add(offset)
 	case io.SeekEnd:
-		r.offset = r.file.Length() + offset
+		r.offset.Store(r.file.Length() + offset)
+	}
+	if !r.waitResume() {
+		return 0, io.EOF
 	}
 	r.readerOn()
-	n, err = r.Reader.Seek(offset, whence)
-	r.offset = n
-	r.lastAccess = time.Now().Unix()
+	n, err = r.current().Seek(offset, whence)
+	r.offset.Store(n)
+	r.lastAccess.Store(time.Now().Unix())
 	return
 }
 
 func (r *Reader) Read(p []byte) (n int, err error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+// ReadContext reads like Read, waiting for data is interrupted when ctx is done
+func (r *Reader) ReadContext(ctx context.Context, p []byte) (n int, err error) {
 	err = io.EOF
-	if r.isClosed {
+	if r.isClosed.Load() || !r.waitResume() {
 		return
 	}
 	if r.file.Torrent() != nil && r.file.Torrent().Info() != nil {
 		r.readerOn()
-		n, err = r.Reader.Read(p)
+		cache := r.getCache()
+		lr := cache.LocalReadOn(r.File().Offset()+r.offset.Load(), int64(len(p)))
+		n, err = r.current().ReadContext(ctx, p)
+		cache.LocalReadOff(lr)
+		if err != nil && n == 0 && ctx.Err() == nil && r.isSuspended() {
+			// client reconnects, continue with the new torrent
+			return r.ReadContext(ctx, p)
+		}
 
 		// samsung tv fix xvid/divx
 		//if r.offset == 0 && len(p) >= 192 {
@@ -87,8 +113,8 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 		//	}
 		//}
 
-		r.offset += int64(n)
-		r.lastAccess = time.Now().Unix()
+		r.offset.Add(int64(n))
+		r.lastAccess.Store(time.Now().Unix())
 	} else {
 		log.TLogln("Torrent closed and readed")
 	}
@@ -96,29 +122,128 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 }
 
 func (r *Reader) SetReadahead(length int64) {
-	if r.cache != nil && length > r.cache.capacity {
-		length = r.cache.capacity
+	if r.cache != nil {
+		length = min(length, r.cache.GetCapacity())
 	}
-	if r.isUse {
-		r.Reader.SetReadahead(length)
+	if r.isUse.Load() {
+		r.current().SetReadahead(length)
+	}
+	r.readahead.Store(length)
+}
+
+func (r *Reader) SetResponsive() {
+	r.responsive = true
+	r.current().SetResponsive()
+}
+
+func (r *Reader) current() torrent.Reader {
+	r.muSwap.Lock()
+	defer r.muSwap.Unlock()
+	return r.Reader
+}
+
+func (r *Reader) getCache() *Cache {
+	r.muSwap.Lock()
+	defer r.muSwap.Unlock()
+	return r.cache
+}
+
+func (r *Reader) isSuspended() bool {
+	r.muSwap.Lock()
+	defer r.muSwap.Unlock()
+	return r.suspended != nil
+}
+
+// waitResume blocks while the reader is suspended, returns false if reader can't be used anymore
+func (r *Reader) waitResume() bool {
+	r.muSwap.Lock()
+	ch := r.suspended
+	r.muSwap.Unlock()
+	if ch != nil {
+		select {
+		case <-ch:
+		case <-time.After(resumeTimeout):
+			return false
+		}
 	}
-	r.readahead = length
+	return !r.isClosed.Load()
+}
+
+// Suspend detaches reader from its cache before BT client reconnect, reads block until Resume
+func (r *Reader) Suspend() {
+	r.muSwap.Lock()
+	if r.suspended == nil {
+		r.suspended = make(chan struct{})
+	}
+	cache := r.cache
+	r.muSwap.Unlock()
+
+	cache.muReaders.Lock()
+	delete(cache.readers, r)
+	cache.muReaders.Unlock()
+}
+
+// Resume attaches suspended reader to the same file of the reconnected torrent,
+// nil file closes the reader
+func (r *Reader) Resume(file *torrent.File, cache *Cache) {
+	r.muSwap.Lock()
+	ch := r.suspended
+	r.suspended = nil
+	attach := file != nil && cache != nil && !r.isClosed.Load()
+	if attach {
+		old := r.Reader
+		r.file = file
+		r.cache = cache
+		r.Reader = file.NewReader()
+		if r.responsive {
+			r.Reader.SetResponsive()
+		}
+		if r.isUse.Load() {
+			r.Reader.SetReadahead(r.readahead.Load())
+		}
+		r.Reader.Seek(r.offset.Load(), io.SeekStart)
+		old.Close()
+	} else {
+		r.isClosed.Store(true)
+	}
+	r.muSwap.Unlock()
+
+	if attach {
+		cache.muReaders.Lock()
+		cache.readers[r] = struct{}{}
+		cache.muReaders.Unlock()
+	}
+	if ch != nil {
+		close(ch)
+	}
+}
+
+// File returns file of torrent for the reader
+func (r *Reader) File() *torrent.File {
+	r.muSwap.Lock()
+	defer r.muSwap.Unlock()
+	return r.file
+}
+
+// Path returns path of the file in torrent
+func (r *Reader) Path() string {
+	return r.file.Path()
 }
 
 func (r *Reader) Offset() int64 {
-	return r.offset
+	return r.offset.Load()
 }
 
 func (r *Reader) Readahead() int64 {
-	return r.readahead
+	return r.readahead.Load()
 }
 
 func (r *Reader) Close() {
 	// file reader close in gotorrent
 	// this struct close in cache
-	r.isClosed = true
+	r.isClosed.Store(true)
 	if len(r.file.Torrent().Files()) > 0 {
-		r.Reader.Close()
+		r.current().Close()
 	}
 	go r.cache.getRemPieces()
 }
@@ -129,11 +254,11 @@ func (r *Reader) getPiecesRange() Range {
 }
 
 func (r *Reader) getReaderPiece() int {
-	return r.getPieceNum(r.offset)
+	return r.getPieceNum(r.offset.Load())
 }
 
 func (r *Reader) getReaderRAHPiece() int {
-	return r.getPieceNum(r.offset + r.readahead)
+	return r.getPieceNum(r.offset.Load() + r.readahead.Load())
 }
 
 func (r *Reader) getPieceNum(offset int64) int {
@@ -147,8 +272,10 @@ func (r *Reader) getOffsetRange() (int64, int64) {
 		readers = 1
 	}
 
-	beginOffset := r.offset - (r.cache.capacity/readers)*(100-prc)/100
-	endOffset := r.offset + (r.cache.capacity/readers)*prc/100
+	capacity := r.cache.GetCapacity()
+	offset := r.offset.Load()
+	beginOffset := offset - (capacity/readers)*(100-prc)/100
+	endOffset := offset + (capacity/readers)*prc/100
 
 	if beginOffset < 0 {
 		beginOffset = 0
@@ -161,7 +288,7 @@ func (r *Reader) getOffsetRange() (int64, int64) {
 }
 
 func (r *Reader) checkReader() {
-	if time.Now().Unix() > r.lastAccess+60 && len(r.cache.readers) > 1 {
+	if time.Now().Unix() > r.lastAccess.Load()+60 && len(r.cache.readers) > 1 {
 		r.readerOff()
 	} else {
 		r.readerOn()
@@ -171,23 +298,24 @@ func (r *Reader) checkReader() {
 func (r *Reader) readerOn() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if !r.isUse {
-		if pos, err := r.Reader.Seek(0, io.SeekCurrent); err == nil && pos == 0 {
-			r.Reader.Seek(r.offset, io.SeekStart)
+	if !r.isUse.Load() {
+		rd := r.current()
+		if pos, err := rd.Seek(0, io.SeekCurrent); err == nil && pos == 0 {
+			rd.Seek(r.offset.Load(), io.SeekStart)
 		}
-		r.SetReadahead(r.readahead)
-		r.isUse = true
+		r.SetReadahead(r.readahead.Load())
+		r.isUse.Store(true)
 	}
 }
 
 func (r *Reader) readerOff() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if r.isUse {
+	if r.isUse.Load() {
 		r.SetReadahead(0)
-		r.isUse = false
-		if r.offset > 0 {
-			r.Reader.Seek(0, io.SeekStart)
+		r.isUse.Store(false)
+		if r.offset.Load() > 0 {
+			r.current().Seek(0, io.SeekStart)
 		}
 	}
 }
@@ -196,7 +324,7 @@ func (r *Reader) getUseReaders() int {
 	readers := 0
 	if r.cache != nil {
 		for reader := range r.cache.readers {
-			if reader.isUse {
+			if reader.isUse.Load() {
 				readers++
 			}
 		}
@@ -42,24 +42,46 @@ func (s *Storage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (ts.T
 }
 
 func (s *Storage) CloseHash(hash metainfo.Hash) {
-	if s.caches == nil {
-		return
+	if ch := s.GetCache(hash); ch != nil {
+		ch.Close()
 	}
+}
+
+func (s *Storage) Close() error {
+	for _, ch := range s.list() {
+		ch.Close()
+	}
+	return nil
+}
+
+// remove deletes closed cache, cache of new torrent with the same hash is kept
+func (s *Storage) remove(ch *Cache) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if ch, ok := s.caches[hash]; ok {
-		ch.Close()
-		delete(s.caches, hash)
+	if s.caches[ch.hash] == ch {
+		delete(s.caches, ch.hash)
 	}
 }
 
-func (s *Storage) Close() error {
+func (s *Storage) list() []*Cache {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	caches := make([]*Cache, 0, len(s.caches))
 	for _, ch := range s.caches {
-		ch.Close()
+		caches = append(caches, ch)
+	}
+	return caches
+}
+
+// SetCapacity changes size of new and existing caches
+func (s *Storage) SetCapacity(capacity int64) {
+	s.mu.Lock()
+	s.capacity = capacity
+	s.mu.Unlock()
+
+	for _, ch := range s.list() {
+		ch.SetCapacity(capacity)
 	}
-	return nil
 }
 
 func (s *Storage) GetCache(hash metainfo.Hash) *Cache {
@@ -19,6 +19,10 @@ import (
 )
 
 func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter) error {
+	if t.bt != nil && t.bt.NetworkPaused() {
+		http.Error(resp, ErrNetworkDown.Error(), http.StatusServiceUnavailable)
+		return ErrNetworkDown
+	}
 	if !t.GotInfo() {
 		http.NotFound(resp, req)
 		return errors.New("torrent don't get info")
@@ -1,7 +1,9 @@
 package torr
 
 import (
+	"context"
 	"errors"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -16,7 +18,6 @@ import (
 	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
 	cacheSt "github.com/german2285/TorrPlayer/pkg/server/torr/storage/state"
 	"github.com/german2285/TorrPlayer/pkg/server/torr/storage/torrstor"
-	"github.com/german2285/TorrPlayer/pkg/server/torr/utils"
 )
 
 type Torrent struct {
@@ -26,13 +27,17 @@ type Torrent struct {
 	Data     string
 	*torrent.TorrentSpec
 
-	Stat      state.TorrentStat
 	Timestamp int64
 	Size      int64
 
 	*torrent.Torrent
 	muTorrent sync.Mutex
 
+	// lifecycle state, see lifecycle.go
+	stat   state.TorrentStat
+	statCh chan struct{}
+	muStat sync.Mutex
+
 	bt    *BTServer
 	cache *torrstor.Cache
 
@@ -48,33 +53,100 @@ type Torrent struct {
 	DurationSeconds float64
 	BitRate         string
 
+	// bitrate of files for readahead, see media.go
+	media  map[string]*mediaInfo
+	probed map[string]bool
+	// reader loading file before playback, see buffer.go
+	buffering *torrstor.Reader
+
+	// own limits in kb and priority, see limits.go
+	DownloadLimit int
+	UploadLimit   int
+	Priority      state.TorrentPriority
+	maxConns      int
+
+	// keep mode, see keep.go
+	KeepState *settings.KeepState
+	keep      *keepJob
+	muKeep    sync.Mutex
+
+	// seeding, see seed.go
+	SeedPolicy   *settings.SeedPolicy // nil - global policy
+	Uploaded     int64                // bytes of previous sessions
+	Downloaded   int64
+	SeedSeconds  int64
+	seedRestored bool
+	wasSeeding   bool
+	seedSaved    time.Time
+
+	// header of .torrent the torrent was added from, see metaexport.go
+	CreationDate int64
+	Comment      string
+
+	// trackers, see trackers.go
+	RetrackersMode *int // nil - global mode
+	announcer      *announcer
+
+	// http sources, BEP 19, see webseed.go
+	WebSeeds  []string
+	webSeeder *webSeeder
+
+	// file selection, see selection.go
+	Unwanted   []string // paths in torrent
+	SelectOnly []int    // BEP 53 indexes of magnet, applied when metadata is received
+
+	// id of the next file prefetched while other file is read, see prefetch.go
+	prefetched int
+
+	// previous stats of peers to count speeds, see peers.go
+	peerSamples  map[string]*peerSample
+	peersSampled time.Time
+	// hash failures not attributed to peers yet, see smartban.go
+	failedPieces []pieceFailure
+
 	expiredTime time.Time
 
+	// ctx is cancelled when torrent is closed
+	ctx    context.Context
+	cancel context.CancelFunc
 	closed <-chan struct{}
 
-	progressTicker *time.Ticker
+	infoOnce sync.Once
+	// metadata fetch, see metadata.go
+	metaOnce   sync.Once
+	metaDone   chan struct{}
+	metaErr    error
+	metaCancel context.CancelFunc
+	dropOnce   sync.Once
 }
 
 func NewTorrent(spec *torrent.TorrentSpec, bt *BTServer) (*Torrent, error) {
 	// https://github.com/anacrolix/torrent/issues/747
-	if bt == nil || bt.client == nil {
+	if bt == nil {
 		return nil, errors.New("BT client not connected")
 	}
-	switch settings.BTsets.RetrackersMode {
-	case 1:
-		spec.Trackers = append(spec.Trackers, [][]string{utils.GetDefTrackers()}...)
-	case 2:
-		spec.Trackers = nil
-	case 3:
-		spec.Trackers = [][]string{utils.GetDefTrackers()}
+	if bt.NetworkPaused() {
+		return nil, ErrNetworkDown
 	}
-
-	trackers := utils.GetTrackerFromFile()
-	if len(trackers) > 0 {
-		spec.Trackers = append(spec.Trackers, [][]string{trackers}...)
+	client := bt.getClient()
+	if client == nil {
+		return nil, errors.New("BT client not connected")
+	}
+	// trackers are announced by torrent itself, retrackers mode is applied there
+	clientSpec := *spec
+	clientSpec.Trackers = nil
+	// info saved after first metadata download, torrent starts without peers
+	hash := spec.InfoHash.HexString()
+	if len(clientSpec.InfoBytes) == 0 {
+		clientSpec.InfoBytes = settings.GetMetainfo(hash)
+	}
+	goTorrent, _, err := client.AddTorrentSpec(&clientSpec)
+	if err != nil && len(spec.InfoBytes) == 0 && len(clientSpec.InfoBytes) > 0 {
+		log.TLogln("Error load saved metainfo", hash, err)
+		settings.RemMetainfo(hash)
+		clientSpec.InfoBytes = nil
+		goTorrent, _, err = client.AddTorrentSpec(&clientSpec)
 	}
-
-	goTorrent, _, err := bt.client.AddTorrentSpec(spec)
 	if err != nil {
 		return nil, err
 	}
@@ -82,6 +154,7 @@ func NewTorrent(spec *torrent.TorrentSpec, bt *BTServer) (*Torrent, error) {
 	bt.mu.Lock()
 	defer bt.mu.Unlock()
 	if tor, ok := bt.torrents[spec.InfoHash]; ok {
+		go tor.mergeTrackers(spec.Trackers)
 		return tor, nil
 	}
 
@@ -92,53 +165,97 @@ func NewTorrent(spec *torrent.TorrentSpec, bt *BTServer) (*Torrent, error) {
 
 	torr := new(Torrent)
 	torr.Torrent = goTorrent
-	torr.Stat = state.TorrentAdded
+	torr.stat = state.TorrentAdded
 	torr.lastTimeSpeed = time.Now()
 	torr.bt = bt
 	torr.closed = goTorrent.Closed()
+	torr.ctx, torr.cancel = context.WithCancel(context.Background())
 	torr.TorrentSpec = spec
 	torr.AddExpiredTime(timeout)
 	torr.Timestamp = time.Now().Unix()
+	db := GetTorrentDB(spec.InfoHash)
+	torr.restoreSeed(db)
+	if db != nil {
+		torr.RetrackersMode = db.RetrackersMode
+		torr.WebSeeds = db.WebSeeds
+		torr.Unwanted = db.Unwanted
+		torr.SelectOnly = db.SelectOnly
+		torr.CreationDate = db.CreationDate
+		torr.Comment = db.Comment
+	}
+	// client config is not changed on the fly, apply current limit
+	torr.maxConns = settings.BTsets.ConnectionsLimit
+	goTorrent.SetMaxEstablishedConns(torr.maxConns)
 
 	go torr.watch()
+	torr.announcer = newAnnouncer(torr)
+	torr.syncTrackers()
 
+	// torrent added by user or for streaming gets slot at once
+	bt.queue.Acquire(context.Background(), queueActive, spec.InfoHash, true)
 	bt.torrents[spec.InfoHash] = torr
+	publish(&TorrentAddedEvent{Hash: spec.InfoHash.HexString(), Title: spec.DisplayName})
 	return torr, nil
 }
 
+// WaitInfo waits the metadata fetch, all callers share one fetch with retries, see metadata.go
 func (t *Torrent) WaitInfo() bool {
-	if t.Torrent == nil {
-		return false
-	}
+	t.metaOnce.Do(func() {
+		t.metaDone = make(chan struct{})
+		go func() {
+			t.metaErr = t.fetchInfo()
+			close(t.metaDone)
+		}()
+	})
+	<-t.metaDone
+	return t.metaErr == nil
+}
 
-	// Close torrent if no info in 1 minute + TorrentDisconnectTimeout config option
-	tm := time.NewTimer(time.Minute + time.Second*time.Duration(settings.BTsets.TorrentDisconnectTimeout))
+// WaitInfoContext waits for torrent metadata until ctx is done or torrent is closed
+func (t *Torrent) WaitInfoContext(ctx context.Context) error {
+	if t.Torrent == nil || t.ctx == nil {
+		return ErrTorrentClosed
+	}
 
 	select {
 	case <-t.Torrent.GotInfo():
-		t.cache = t.bt.storage.GetCache(t.Hash())
-		t.cache.SetTorrent(t.Torrent)
-		return true
+		t.muTorrent.Lock()
+		if t.cache == nil {
+			t.cache = t.bt.storage.GetCache(t.Hash())
+			t.cache.SetTorrent(t.Torrent)
+		}
+		t.muTorrent.Unlock()
+		t.applyLimits()
+		t.applySelection()
+		if err := t.applyKeep(); err != nil {
+			log.TLogln("Error keep torrent:", err)
+		}
+		t.infoOnce.Do(t.onInfo)
+		return nil
 	case <-t.closed:
-		return false
-	case <-tm.C:
-		return false
+		return ErrTorrentClosed
+	case <-t.ctx.Done():
+		return ErrTorrentClosed
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 func (t *Torrent) GotInfo() bool {
-	// log.TLogln("GotInfo state:", t.Stat)
-	if t.Stat == state.TorrentClosed {
+	switch t.State() {
+	case state.TorrentClosed, state.TorrentInDB:
+		// db only torrent, it must be loaded with NewTorrent
 		return false
-	}
-	// assume we have info in preload state
-	// and dont override with TorrentWorking
-	if t.Stat == state.TorrentPreload {
+	case state.TorrentWorking, state.TorrentPreload:
+		// assume we have info in preload state
+		// and dont override with TorrentWorking
+		t.AddExpiredTime(time.Second * time.Duration(settings.BTsets.TorrentDisconnectTimeout))
 		return true
 	}
-	t.Stat = state.TorrentGettingInfo
+	// only one caller moves Added -> GettingInfo, others just wait
+	t.casStat(state.TorrentAdded, state.TorrentGettingInfo)
 	if t.WaitInfo() {
-		t.Stat = state.TorrentWorking
+		t.casStat(state.TorrentGettingInfo, state.TorrentWorking)
 		t.AddExpiredTime(time.Second * time.Duration(settings.BTsets.TorrentDisconnectTimeout))
 		return true
 	} else {
@@ -147,23 +264,88 @@ func (t *Torrent) GotInfo() bool {
 	}
 }
 
+// onInfo is called once when torrent metadata is received
+func (t *Torrent) onInfo() {
+	if GetTorrentDB(t.Hash()) != nil {
+		t.saveMetainfo()
+	}
+	st := t.Torrent.Stats()
+	publish(&MetadataReceivedEvent{
+		Hash:      t.Hash().HexString(),
+		Name:      t.Torrent.Name(),
+		Peers:     st.ActivePeers,
+		Seeders:   st.ConnectedSeeders,
+		FileCount: len(t.Torrent.Files()),
+		TotalSize: t.Torrent.Length(),
+	})
+	go t.watchPieces(t.Torrent)
+	t.startWebSeeds()
+}
+
+// saveMetainfo stores info dict once, torrents from db get files without metadata download
+func (t *Torrent) saveMetainfo() {
+	hash := t.Hash().HexString()
+	if t.Torrent == nil || t.Torrent.Info() == nil || len(settings.GetMetainfo(hash)) > 0 {
+		return
+	}
+	settings.SetMetainfo(hash, t.Torrent.Metainfo().InfoBytes)
+}
+
+// watchPieces publishes completed pieces and passes ended hash checks of incomplete pieces to smart ban until the torrent is closed
+func (t *Torrent) watchPieces(tor *torrent.Torrent) {
+	sub := tor.SubscribePieceStateChanges()
+	defer sub.Close()
+	hash := t.Hash().HexString()
+	checking := make(map[int]bool)
+	for {
+		select {
+		case v, ok := <-sub.Values:
+			if !ok {
+				return
+			}
+			ch, ok := v.(torrent.PieceStateChange)
+			if !ok {
+				continue
+			}
+			if ch.Complete {
+				publish(&PieceCompletedEvent{Hash: hash, Piece: ch.Index})
+			}
+			switch {
+			case ch.Checking:
+				checking[ch.Index] = true
+			case checking[ch.Index]:
+				delete(checking, ch.Index)
+				if !ch.Complete {
+					t.pieceFailed(ch.Index)
+				}
+			}
+		case <-t.closed:
+			return
+		}
+	}
+}
+
 func (t *Torrent) AddExpiredTime(duration time.Duration) {
 	newExpiredTime := time.Now().Add(duration)
+	t.muStat.Lock()
 	if t.expiredTime.Before(newExpiredTime) {
 		t.expiredTime = newExpiredTime
 	}
+	t.muStat.Unlock()
 }
 
 func (t *Torrent) watch() {
-	t.progressTicker = time.NewTicker(time.Second)
-	defer t.progressTicker.Stop()
+	progressTicker := time.NewTicker(time.Second)
+	defer progressTicker.Stop()
 
 	for {
 		select {
-		case <-t.progressTicker.C:
-			go t.progressEvent()
+		case <-progressTicker.C:
+			t.progressEvent()
 		case <-t.closed:
 			return
+		case <-t.ctx.Done():
+			return
 		}
 	}
 }
@@ -173,12 +355,12 @@ func (t *Torrent) progressEvent() {
 		if t.TorrentSpec != nil {
 			log.TLogln("Torrent close by timeout", t.TorrentSpec.InfoHash.HexString())
 		}
-		t.bt.RemoveTorrent(t.Hash())
+		t.close(true)
 		return
 	}
 
 	t.muTorrent.Lock()
-	if t.Torrent != nil && t.Torrent.Info() != nil {
+	if t.Torrent != nil && t.Torrent.Info() != nil && t.State() != state.TorrentClosed {
 		st := t.Torrent.Stats()
 		deltaDlBytes := st.BytesRead.Int64() - t.BytesReadUsefulData
 		deltaUpBytes := st.BytesWritten.Int64() - t.BytesWrittenData
@@ -197,45 +379,83 @@ func (t *Torrent) progressEvent() {
 		t.DownloadSpeed = 0
 		t.UploadSpeed = 0
 	}
+	t.lastTimeSpeed = time.Now()
 	t.muTorrent.Unlock()
 
-	t.lastTimeSpeed = time.Now()
+	t.applyLimits()
+	t.keepProgressEvent()
+	t.seedTick()
+	t.trackersTick()
+	t.smartBanTick()
+	t.prefetchTick()
 	t.updateRA()
 }
 
+// updateRA sizes readahead of every reader from bitrate of its file, download speed and number of readers
 func (t *Torrent) updateRA() {
-	// t.muTorrent.Lock()
-	// defer t.muTorrent.Unlock()
-	// if t.Torrent != nil && t.Torrent.Info() != nil {
-	// 	pieceLen := t.Torrent.Info().PieceLength
-	// 	adj := pieceLen * int64(t.Torrent.Stats().ActivePeers) / int64(1+t.cache.Readers())
-	// 	switch {
-	// 	case adj < pieceLen:
-	// 		adj = pieceLen
-	// 	case adj > pieceLen*4:
-	// 		adj = pieceLen * 4
-	// 	}
-	// 	go t.cache.AdjustRA(adj)
-	// }
-	adj := int64(16 << 20) // 16 MB fixed RA
-	go t.cache.AdjustRA(adj)
+	cache := t.GetCache()
+	if cache == nil || t.Torrent == nil || t.Torrent.Info() == nil {
+		return
+	}
+	t.muTorrent.Lock()
+	speed := t.DownloadSpeed
+	buffering := t.buffering
+	t.muTorrent.Unlock()
+	go func() {
+		if settings.BTsets.CacheSize == 0 {
+			// cache without size follows readahead
+			cache.AdjustRA(raDefault)
+		}
+		readers := cache.ListReaders()
+		for _, r := range readers {
+			if r == buffering {
+				continue
+			}
+			file := r.File()
+			t.probeMedia(file)
+			r.SetReadahead(t.readaheadFor(file, len(readers), speed, cache.GetCapacity(), int64(settings.BTsets.ReaderReadAHead)))
+		}
+	}()
+}
+
+func (t *Torrent) getExpiredTime() time.Time {
+	t.muStat.Lock()
+	defer t.muStat.Unlock()
+	return t.expiredTime
 }
 
 func (t *Torrent) expired() bool {
-	return t.cache.Readers() == 0 && t.expiredTime.Before(time.Now()) && (t.Stat == state.TorrentWorking || t.Stat == state.TorrentClosed)
+	if t.GetCache().Readers() > 0 || t.keepActive() || t.seeding() {
+		return false
+	}
+	t.muStat.Lock()
+	defer t.muStat.Unlock()
+	return t.expiredTime.Before(time.Now()) && (t.stat == state.TorrentWorking || t.stat == state.TorrentClosed)
 }
 
+// Files returns copy of files in metainfo order, the client slice is shared and mustn't be sorted
 func (t *Torrent) Files() []*torrent.File {
 	if t.Torrent != nil && t.Torrent.Info() != nil {
-		files := t.Torrent.Files()
-		return files
+		return slices.Clone(t.Torrent.Files())
 	}
 	return nil
 }
 
+// FileByID returns file by id from file stats, files are sorted by path and id starts from 1
+func (t *Torrent) FileByID(id int) *torrent.File {
+	files := t.Files()
+	if id < 1 || id > len(files) {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return utils2.CompareStrings(files[i].Path(), files[j].Path())
+	})
+	return files[id-1]
+}
+
 func (t *Torrent) Hash() metainfo.Hash {
 	if t.Torrent != nil {
-		t.Torrent.InfoHash()
+		return t.Torrent.InfoHash()
 	}
 	if t.TorrentSpec != nil {
 		return t.TorrentSpec.InfoHash
@@ -251,53 +471,162 @@ func (t *Torrent) Length() int64 {
 }
 
 func (t *Torrent) NewReader(file *torrent.File) *torrstor.Reader {
-	if t.Stat == state.TorrentClosed {
+	cache := t.GetCache()
+	if t.State() == state.TorrentClosed || cache == nil {
 		return nil
 	}
-	reader := t.cache.NewReader(file)
+	reader := cache.NewReader(file)
+	publish(&ReaderOpenedEvent{Hash: t.Hash().HexString(), Path: file.Path(), Readers: cache.Readers()})
 	return reader
 }
 
 func (t *Torrent) CloseReader(reader *torrstor.Reader) {
-	t.cache.CloseReader(reader)
+	cache := t.GetCache()
+	cache.CloseReader(reader)
 	t.AddExpiredTime(time.Second * time.Duration(settings.BTsets.TorrentDisconnectTimeout))
+	publish(&ReaderClosedEvent{Hash: t.Hash().HexString(), Path: reader.Path(), Readers: cache.Readers()})
 }
 
 func (t *Torrent) GetCache() *torrstor.Cache {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
 	return t.cache
 }
 
+// drop removes torrent from the client, the go torrent is kept for stats and Closed() channel
 func (t *Torrent) drop() {
-	t.muTorrent.Lock()
-	defer t.muTorrent.Unlock()
-	if t.Torrent != nil {
-		t.Torrent.Drop()
-		t.Torrent = nil
-	}
+	t.dropOnce.Do(func() {
+		if t.cancel != nil {
+			t.cancel()
+		}
+		if t.Torrent != nil {
+			t.Torrent.Drop()
+		}
+		t.closeKeep()
+	})
 }
 
 func (t *Torrent) Close() bool {
-	if settings.ReadOnly && t.cache != nil && t.cache.GetUseReaders() > 0 {
+	return t.close(false)
+}
+
+func (t *Torrent) close(expired bool) bool {
+	if cache := t.GetCache(); settings.ReadOnly && cache != nil && cache.GetUseReaders() > 0 {
 		return false
 	}
-	t.Stat = state.TorrentClosed
+	if !t.setStat(state.TorrentClosed) {
+		// already closed
+		return true
+	}
 
-	t.bt.mu.Lock()
-	delete(t.bt.torrents, t.Hash())
-	t.bt.mu.Unlock()
+	if t.bt != nil {
+		t.bt.mu.Lock()
+		if t.bt.torrents[t.Hash()] == t {
+			delete(t.bt.torrents, t.Hash())
+			t.bt.queue.ReleaseAll(t.Hash())
+		}
+		t.bt.mu.Unlock()
+	}
 
+	t.saveSeed()
 	t.drop()
+	publish(&TorrentClosedEvent{Hash: t.Hash().HexString(), Expired: expired})
 	return true
 }
 
+// torrentSnapshot keeps torrent with suspended readers while the client reconnects
+type torrentSnapshot struct {
+	spec      *torrent.TorrentSpec
+	title     string
+	category  string
+	poster    string
+	data      string
+	size      int64
+	timestamp int64
+	down, up  int
+	priority  state.TorrentPriority
+	keep      *settings.KeepState
+	retrack   *int
+	seed      *settings.SeedPolicy
+	uploaded  int64
+	loaded    int64
+	seeded    int64
+	webSeeds  []string
+	unwanted  []string
+	selectIdx []int
+	created   int64
+	comment   string
+	readers   []*torrstor.Reader
+}
+
+func (t *Torrent) suspend() *torrentSnapshot {
+	snap := &torrentSnapshot{
+		title:     t.Title,
+		category:  t.Category,
+		poster:    t.Poster,
+		data:      t.Data,
+		size:      t.Size,
+		timestamp: t.Timestamp,
+		down:      t.DownloadLimit,
+		up:        t.UploadLimit,
+		priority:  t.Priority,
+		keep:      t.KeepState,
+		retrack:   t.RetrackersMode,
+		webSeeds:  t.webSeedURLs(),
+	}
+	snap.unwanted, snap.selectIdx = t.selection()
+	// counters of the closed client session are kept for torrents not in DB too
+	snap.uploaded, snap.loaded = t.totals()
+	t.muTorrent.Lock()
+	snap.seed = t.SeedPolicy
+	snap.seeded = t.SeedSeconds
+	snap.created, snap.comment = t.CreationDate, t.Comment
+	t.muTorrent.Unlock()
+	spec := *t.TorrentSpec
+	spec.Storage = nil
+	// metadata is already loaded, don't wait it again
+	if t.Torrent != nil && t.Torrent.Info() != nil {
+		spec.InfoBytes = t.Torrent.Metainfo().InfoBytes
+	}
+	snap.spec = &spec
+
+	snap.readers = t.GetCache().ListReaders()
+	for _, r := range snap.readers {
+		r.Suspend()
+	}
+	return snap
+}
+
+// resume attaches suspended readers to the new torrent, nil closes them
+func (s *torrentSnapshot) resume(t *Torrent) {
+	var cache *torrstor.Cache
+	if t != nil {
+		cache = t.GetCache()
+	}
+	for _, r := range s.readers {
+		var file *torrent.File
+		if cache != nil {
+			path := r.File().Path()
+			for _, f := range t.Files() {
+				if f.Path() == path {
+					file = f
+					break
+				}
+			}
+		}
+		r.Resume(file, cache)
+	}
+}
+
 func (t *Torrent) Status() *state.TorrentStatus {
 	t.muTorrent.Lock()
 	defer t.muTorrent.Unlock()
 
 	st := new(state.TorrentStatus)
 
-	st.Stat = t.Stat
-	st.StatString = t.Stat.String()
+	stat := t.State()
+	st.Stat = stat
+	st.StatString = stat.String()
 	st.Title = t.Title
 	st.Category = t.Category
 	st.Poster = t.Poster
@@ -306,6 +635,13 @@ func (t *Torrent) Status() *state.TorrentStatus {
 	st.TorrentSize = t.Size
 	st.BitRate = t.BitRate
 	st.DurationSeconds = t.DurationSeconds
+	st.DownloadLimit = effectiveLimit(t.DownloadLimit, settings.BTsets.DownloadRateLimit)
+	st.UploadLimit = effectiveLimit(t.UploadLimit, settings.BTsets.UploadRateLimit)
+	st.Priority = t.effectivePriority().String()
+	st.MaxConnections = t.maxConns
+	st.Uploaded = t.Uploaded
+	st.Downloaded = t.Downloaded
+	st.SeedSeconds = t.SeedSeconds
 
 	if t.TorrentSpec != nil {
 		st.Hash = t.TorrentSpec.InfoHash.HexString()
@@ -338,6 +674,10 @@ func (t *Torrent) Status() *state.TorrentStatus {
 		st.ConnectedSeeders = tst.ConnectedSeeders
 		st.HalfOpenPeers = tst.HalfOpenPeers
 
+		st.Uploaded += st.BytesWrittenData
+		st.Downloaded += st.BytesReadUsefulData
+		st.Seeding = t.seedingLocked(st.Uploaded, st.Downloaded)
+
 		if t.Torrent.Info() != nil {
 			st.TorrentSize = t.Torrent.Length()
 
@@ -347,9 +687,10 @@ func (t *Torrent) Status() *state.TorrentStatus {
 			})
 			for i, f := range files {
 				st.FileStats = append(st.FileStats, &state.TorrentFileStat{
-					Id:     i + 1, // in web id 0 is undefined
-					Path:   f.Path(),
-					Length: f.Length(),
+					Id:       i + 1, // in web id 0 is undefined
+					Path:     f.Path(),
+					Length:   f.Length(),
+					Unwanted: slices.Contains(t.Unwanted, f.Path()),
 				})
 			}
 		}
@@ -359,8 +700,8 @@ func (t *Torrent) Status() *state.TorrentStatus {
 }
 
 func (t *Torrent) CacheState() *cacheSt.CacheState {
-	if t.Torrent != nil && t.cache != nil {
-		st := t.cache.GetState()
+	if cache := t.GetCache(); t.Torrent != nil && cache != nil {
+		st := cache.GetState()
 		st.Torrent = t.Status()
 		return st
 	}
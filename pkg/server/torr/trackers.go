@@ -0,0 +1,480 @@
+package torr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/tracker"
+
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/health"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/utils"
+)
+
+// retrackers modes, see BTSets.RetrackersMode
+const (
+	retrackersNone = iota
+	retrackersAdd
+	retrackersRemove
+	retrackersReplace
+)
+
+// sources of trackers
+const (
+	TrackerSourceTorrent   = "torrent"
+	TrackerSourceRetracker = "retracker"
+	TrackerSourceFile      = "file"
+)
+
+const (
+	announceTimeout = 30 * time.Second
+	// wait after failed announce
+	announceRetry = 5 * time.Minute
+	// interval of tracker which doesn't send it
+	announceInterval = 30 * time.Minute
+	// stopped event is sent on close without waiting long
+	announceStopTimeout = 5 * time.Second
+)
+
+var (
+	ErrTrackerNotFound = errors.New("tracker not found")
+	ErrRetracker       = errors.New("tracker is added by retrackers mode")
+	ErrFileTracker     = errors.New("tracker is added from trackers.txt")
+)
+
+// trackerList returns trackers of torrent after retrackers mode and trackers.txt are applied
+func trackerList(tiers [][]string, mode int) []*state.TrackerStatus {
+	var ret []*state.TrackerStatus
+	seen := make(map[string]bool)
+	add := func(tier []string, source string) {
+		n := 0
+		if len(ret) > 0 {
+			n = ret[len(ret)-1].Tier + 1
+		}
+		for _, u := range tier {
+			u = utils.NormalizeTracker(u)
+			if u == "" || seen[u] {
+				continue
+			}
+			seen[u] = true
+			ret = append(ret, &state.TrackerStatus{URL: u, Tier: n, Source: source})
+		}
+	}
+
+	switch mode {
+	case retrackersAdd:
+		for _, tier := range tiers {
+			add(tier, TrackerSourceTorrent)
+		}
+		add(utils.GetDefTrackers(), TrackerSourceRetracker)
+	case retrackersRemove:
+	case retrackersReplace:
+		add(utils.GetDefTrackers(), TrackerSourceRetracker)
+	default:
+		for _, tier := range tiers {
+			add(tier, TrackerSourceTorrent)
+		}
+	}
+	add(utils.GetTrackerFromFile(), TrackerSourceFile)
+	return ret
+}
+
+func validTrackerURL(u string) error {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	switch pu.Scheme {
+	case "http", "https", "udp", "udp4", "udp6":
+	default:
+		return fmt.Errorf("unsupported tracker scheme: %s", pu.Scheme)
+	}
+	if pu.Host == "" {
+		return fmt.Errorf("wrong tracker url: %s", u)
+	}
+	return nil
+}
+
+// retrackersMode returns own retrackers mode of torrent or global mode
+func (t *Torrent) retrackersMode() int {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if t.RetrackersMode != nil {
+		return *t.RetrackersMode
+	}
+	return settings.BTsets.RetrackersMode
+}
+
+func (t *Torrent) specTrackers() [][]string {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if t.TorrentSpec == nil {
+		return nil
+	}
+	return t.TorrentSpec.Trackers
+}
+
+// setSpecTrackers replaces trackers of spec, spec may be shared so it is copied
+func (t *Torrent) setSpecTrackers(tiers [][]string) {
+	t.muTorrent.Lock()
+	if t.TorrentSpec != nil {
+		spec := *t.TorrentSpec
+		spec.Trackers = tiers
+		t.TorrentSpec = &spec
+	}
+	t.muTorrent.Unlock()
+	t.syncTrackers()
+}
+
+// syncTrackers starts announcers of new trackers and stops removed ones
+func (t *Torrent) syncTrackers() {
+	if t.announcer != nil {
+		t.announcer.sync(trackerList(t.specTrackers(), t.retrackersMode()))
+	}
+}
+
+// trackersTick follows download of torrent, completed event is announced when it is finished
+func (t *Torrent) trackersTick() {
+	if t.announcer != nil && t.Torrent != nil && t.Torrent.Info() != nil {
+		t.announcer.setMissing(t.Torrent.BytesMissing() > 0)
+	}
+}
+
+// TrackerList returns trackers of torrent with announce status, torrent from DB has no status
+func (t *Torrent) TrackerList() []*state.TrackerStatus {
+	if t.announcer != nil {
+		return t.announcer.list()
+	}
+	return trackerList(t.specTrackers(), t.retrackersMode())
+}
+
+// AddTracker adds tracker into own tier of torrent
+func (t *Torrent) AddTracker(u string) error {
+	if err := validTrackerURL(strings.TrimSpace(u)); err != nil {
+		return err
+	}
+	u = utils.NormalizeTracker(u)
+	tiers := t.specTrackers()
+	for _, tier := range tiers {
+		if slices.ContainsFunc(tier, func(tr string) bool { return utils.NormalizeTracker(tr) == u }) {
+			return nil
+		}
+	}
+	t.setSpecTrackers(append(slices.Clone(tiers), []string{u}))
+	return nil
+}
+
+// RemoveTracker removes tracker of torrent, retrackers and trackers.txt are removed by retrackers mode only
+func (t *Torrent) RemoveTracker(u string) error {
+	u = utils.NormalizeTracker(u)
+	var tiers [][]string
+	found := false
+	for _, tier := range t.specTrackers() {
+		if i := slices.IndexFunc(tier, func(tr string) bool { return utils.NormalizeTracker(tr) == u }); i >= 0 {
+			found = true
+			tier = slices.Delete(slices.Clone(tier), i, i+1)
+		}
+		if len(tier) > 0 {
+			tiers = append(tiers, tier)
+		}
+	}
+	if found {
+		t.setSpecTrackers(tiers)
+		return nil
+	}
+	for _, tr := range trackerList(nil, t.retrackersMode()) {
+		if tr.URL == u {
+			if tr.Source == TrackerSourceFile {
+				return ErrFileTracker
+			}
+			return ErrRetracker
+		}
+	}
+	return ErrTrackerNotFound
+}
+
+// mergeTrackers adds trackers of the torrent added again, e.g. with other magnet
+func (t *Torrent) mergeTrackers(tiers [][]string) {
+	for _, tier := range tiers {
+		for _, u := range tier {
+			t.AddTracker(u)
+		}
+	}
+}
+
+// Reannounce announces torrent to tracker at once, empty url - to all trackers
+func (t *Torrent) Reannounce(u string) error {
+	if t.announcer == nil {
+		return ErrTorrentClosed
+	}
+	if u != "" {
+		if u = utils.NormalizeTracker(u); u == "" {
+			return ErrTrackerNotFound
+		}
+	}
+	if !t.announcer.force(u) {
+		return ErrTrackerNotFound
+	}
+	return nil
+}
+
+// SetRetrackersMode sets own retrackers mode of torrent, nil - global mode
+func (t *Torrent) SetRetrackersMode(mode *int) error {
+	if mode != nil && (*mode < retrackersNone || *mode > retrackersReplace) {
+		return fmt.Errorf("wrong retrackers mode: %d", *mode)
+	}
+	t.muTorrent.Lock()
+	if mode != nil {
+		m := *mode
+		mode = &m
+	}
+	t.RetrackersMode = mode
+	t.muTorrent.Unlock()
+	t.syncTrackers()
+	return nil
+}
+
+// announcer announces torrent to its trackers, the client is started without trackers to manage them here
+type announcer struct {
+	t        *Torrent
+	trackers map[string]*trackerAnnouncer
+	order    []string
+	missing  bool // download wasn't complete, completed event is sent when it is
+	mu       sync.Mutex
+}
+
+type trackerAnnouncer struct {
+	status    *state.TrackerStatus // guarded by announcer.mu
+	completed bool                 // completed event wasn't sent yet, guarded by announcer.mu
+	forceCh   chan struct{}
+	stopCh    chan struct{}
+}
+
+func newAnnouncer(t *Torrent) *announcer {
+	return &announcer{t: t, trackers: make(map[string]*trackerAnnouncer)}
+}
+
+func (a *announcer) sync(list []*state.TrackerStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keep := make(map[string]bool)
+	a.order = a.order[:0]
+	for _, st := range list {
+		keep[st.URL] = true
+		a.order = append(a.order, st.URL)
+		if ta, ok := a.trackers[st.URL]; ok {
+			ta.status.Tier = st.Tier
+			ta.status.Source = st.Source
+			continue
+		}
+		ta := &trackerAnnouncer{
+			status:  st,
+			forceCh: make(chan struct{}, 1),
+			stopCh:  make(chan struct{}),
+		}
+		a.trackers[st.URL] = ta
+		if err := validTrackerURL(st.URL); err != nil {
+			st.Error = err.Error()
+		} else if !a.t.bt.config.DisableTrackers {
+			go a.run(ta)
+		}
+	}
+	for u, ta := range a.trackers {
+		if !keep[u] {
+			close(ta.stopCh)
+			delete(a.trackers, u)
+		}
+	}
+}
+
+func (a *announcer) list() []*state.TrackerStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ret := make([]*state.TrackerStatus, 0, len(a.order))
+	for _, u := range a.order {
+		st := *a.trackers[u].status
+		ret = append(ret, &st)
+	}
+	return ret
+}
+
+func (a *announcer) force(u string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	found := false
+	for tu, ta := range a.trackers {
+		if u != "" && tu != u {
+			continue
+		}
+		found = true
+		select {
+		case ta.forceCh <- struct{}{}:
+		default:
+		}
+	}
+	return found
+}
+
+// setMissing tells trackers about completed download when torrent had missing data before
+func (a *announcer) setMissing(missing bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if missing || !a.missing {
+		a.missing = a.missing || missing
+		return
+	}
+	a.missing = false
+	for _, ta := range a.trackers {
+		ta.completed = true
+		select {
+		case ta.forceCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (a *announcer) run(ta *trackerAnnouncer) {
+	t := a.t
+	a.mu.Lock()
+	u := ta.status.URL
+	a.mu.Unlock()
+
+	started := false
+	defer func() {
+		// tracker removes peer from swarm at once
+		if started {
+			ctx, cancel := context.WithTimeout(context.Background(), announceStopTimeout)
+			defer cancel()
+			t.announce(ctx, u, tracker.Stopped)
+		}
+	}()
+	for {
+		a.mu.Lock()
+		ta.status.Updating = true
+		event := tracker.None
+		switch {
+		case !started:
+			event = tracker.Started
+		case ta.completed:
+			event = tracker.Completed
+		}
+		a.mu.Unlock()
+
+		res, err := t.announce(t.ctx, u, event)
+		wait := announceRetry
+		if err == nil {
+			started = true
+			t.Torrent.AddPeers(torrent.Peers(nil).AppendFromTracker(res.Peers))
+			// tracker doesn't want announces more often than its interval
+			wait = time.Duration(res.Interval) * time.Second
+			if wait <= 0 {
+				wait = announceInterval
+			}
+		}
+
+		a.mu.Lock()
+		if err == nil && event == tracker.Completed {
+			ta.completed = false
+		}
+		st := ta.status
+		st.Updating = false
+		st.LastAnnounce = time.Now().Unix()
+		st.NextAnnounce = time.Now().Add(wait).Unix()
+		if err != nil {
+			st.Error = err.Error()
+		} else {
+			st.Error = ""
+			st.Peers = len(res.Peers)
+			st.Seeders = int(res.Seeders)
+			st.Leechers = int(res.Leechers)
+		}
+		a.mu.Unlock()
+
+		select {
+		case <-ta.forceCh:
+		case <-time.After(wait):
+		case <-ta.stopCh:
+			return
+		case <-t.ctx.Done():
+			return
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+func (t *Torrent) announce(ctx context.Context, u string, event tracker.AnnounceEvent) (tracker.AnnounceResponse, error) {
+	client := t.bt.getClient()
+	if client == nil {
+		return tracker.AnnounceResponse{}, errors.New("BT client not connected")
+	}
+	st := t.Torrent.Stats()
+	left := uint64(math.MaxUint64)
+	if t.Torrent.Info() != nil {
+		left = uint64(t.Torrent.BytesMissing())
+	}
+	ctx, cancel := context.WithTimeout(ctx, announceTimeout)
+	defer cancel()
+	cfg := t.bt.config
+	// announces of the client can't be bound to interface
+	return health.Announce{
+		URL: u,
+		Request: tracker.AnnounceRequest{
+			InfoHash:   t.Hash(),
+			PeerId:     client.PeerID(),
+			Downloaded: st.BytesReadUsefulData.Int64(),
+			Left:       left,
+			Uploaded:   st.BytesWrittenData.Int64(),
+			Event:      event,
+			Key:        t.bt.announceKey,
+			NumWant:    -1,
+			Port:       uint16(client.LocalPort()),
+		},
+		UserAgent: cfg.HTTPUserAgent,
+		ClientIP4: cfg.PublicIp4,
+		ClientIP6: cfg.PublicIp6,
+	}.Do(ctx)
+}
+
+var (
+	trackersReport   []*health.Reachability
+	muTrackersReport sync.Mutex
+)
+
+// CheckDefTrackers pings retrackers and trackers from trackers.txt, the report is kept for TrackersReport
+func CheckDefTrackers(ctx context.Context) []*health.Reachability {
+	list := utils.NormalizeTrackers(append(utils.GetDefTrackers(), utils.GetTrackerFromFile()...))
+	report := health.CheckTrackers(ctx, list, 8, 15*time.Second)
+	muTrackersReport.Lock()
+	trackersReport = report
+	muTrackersReport.Unlock()
+	return report
+}
+
+// TrackersReport returns last report of CheckDefTrackers
+func TrackersReport() []*health.Reachability {
+	muTrackersReport.Lock()
+	defer muTrackersReport.Unlock()
+	return trackersReport
+}
+
+// RefreshDefTrackers downloads lists of retrackers again
+func RefreshDefTrackers() error {
+	return utils.RefreshDefTrackers(true)
+}
+
+// syncAllTrackers applies changed retrackers to running torrents
+func (bt *BTServer) syncAllTrackers() {
+	for _, torr := range bt.ListTorrents() {
+		torr.syncTrackers()
+	}
+}
@@ -1,9 +1,17 @@
 package utils
 
 import (
+	"archive/zip"
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/german2285/TorrPlayer/pkg/server/log"
@@ -13,27 +21,235 @@ import (
 	"github.com/anacrolix/torrent/iplist"
 )
 
-func ReadBlockedIP() (ranger iplist.Ranger, err error) {
+// ReadBlockedIP reads blocklist file from settings path
+func ReadBlockedIP() (ranges []iplist.Range, err error) {
 	buf, err := os.ReadFile(filepath.Join(settings.Path, "blocklist"))
 	if err != nil {
 		return nil, err
 	}
 	log.TLogln("Read block list...")
-	scanner := bufio.NewScanner(strings.NewReader(string(buf)))
+	ranges, err = ParseBlocklist(buf)
+	if err == nil {
+		log.TLogln("Readed ranges:", len(ranges))
+	}
+	return
+}
+
+// eMule DAT: 001.002.004.000 - 001.002.004.255 , 000 , Description
+var reDATLine = regexp.MustCompile(`^([0-9A-Fa-f.:]+)\s*-\s*([0-9A-Fa-f.:]+)\s*,\s*(\d+)\s*(?:,\s*(.*))?$`)
+
+// ParseBlocklist parses blocklist in P2P, eMule DAT or CIDR format, gzip and zip lists are unpacked,
+// wrong lines are skipped
+func ParseBlocklist(buf []byte) ([]iplist.Range, error) {
+	buf, err := unpackBlocklist(buf)
+	if err != nil {
+		return nil, err
+	}
 	var ranges []iplist.Range
+	descs := make(map[string]string)
+	bad := 0
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
 	for scanner.Scan() {
-		r, ok, err := iplist.ParseBlocklistP2PLine(scanner.Bytes())
+		r, ok := parseBlocklistLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if r == nil {
+			bad++
+			continue
+		}
+		// descriptions repeat a lot
+		if d, ok := descs[r.Description]; ok {
+			r.Description = d
+		} else {
+			descs[r.Description] = r.Description
+		}
+		ranges = append(ranges, *r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 && bad > 0 {
+		return nil, errors.New("unknown blocklist format")
+	}
+	return ranges, nil
+}
+
+// parseBlocklistLine returns !ok for empty lines and comments, nil range for wrong line
+func parseBlocklistLine(l string) (*iplist.Range, bool) {
+	l = strings.TrimSpace(l)
+	if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
+		return nil, false
+	}
+	if m := reDATLine.FindStringSubmatch(l); m != nil {
+		// access level above 127 is allowed
+		if len(m[3]) > 0 && atoi(m[3]) > 127 {
+			return nil, false
+		}
+		return newRange(m[1], m[2], m[4]), true
+	}
+	if strings.Contains(l, "/") {
+		if _, in, err := net.ParseCIDR(l); err == nil {
+			return &iplist.Range{First: minIP(in.IP), Last: minIP(iplist.IPNetLast(in))}, true
+		}
+	}
+	// P2P: Description:1.2.3.4-1.2.3.5
+	if colon := strings.LastIndex(l, ":"); colon >= 0 {
+		if ips := strings.SplitN(l[colon+1:], "-", 2); len(ips) == 2 {
+			if r := newRange(ips[0], ips[1], l[:colon]); r != nil {
+				return r, true
+			}
+		}
+	}
+	if ip := parseIP(l); ip != nil {
+		return &iplist.Range{First: ip, Last: ip}, true
+	}
+	return nil, true
+}
+
+func newRange(first, last, desc string) *iplist.Range {
+	r := &iplist.Range{First: parseIP(first), Last: parseIP(last), Description: strings.TrimSpace(desc)}
+	if r.First == nil || r.Last == nil || len(r.First) != len(r.Last) || bytes.Compare(r.First, r.Last) > 0 {
+		return nil
+	}
+	return r
+}
+
+// parseIP parses ip with leading zeros in octets like in eMule lists, ipv4 is 4 bytes long
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ":") {
+		parts := strings.Split(s, ".")
+		for i, p := range parts {
+			if t := strings.TrimLeft(p, "0"); t != "" {
+				parts[i] = t
+			} else if p != "" {
+				parts[i] = "0"
+			}
+		}
+		s = strings.Join(parts, ".")
+	}
+	return minIP(net.ParseIP(s))
+}
+
+func minIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+func atoi(s string) int {
+	n := 0
+	for _, c := range s {
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
+// unpacked list is limited against compression bombs, known lists are far smaller
+const maxBlocklistSize = 64 << 20
+
+var errBlocklistTooBig = errors.New("unpacked blocklist is too big")
+
+// unpackBlocklist unpacks gzip or zip list, other data is returned as is
+func unpackBlocklist(buf []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(buf, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(bytes.NewReader(buf))
 		if err != nil {
 			return nil, err
 		}
-		if ok {
-			ranges = append(ranges, r)
+		defer zr.Close()
+		ret, err := io.ReadAll(io.LimitReader(zr, maxBlocklistSize+1))
+		if err == nil && len(ret) > maxBlocklistSize {
+			return nil, errBlocklistTooBig
 		}
+		return ret, err
+	case bytes.HasPrefix(buf, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+		if err != nil {
+			return nil, err
+		}
+		var ret bytes.Buffer
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(&ret, io.LimitReader(rc, maxBlocklistSize+1-int64(ret.Len())))
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			if ret.Len() > maxBlocklistSize {
+				return nil, errBlocklistTooBig
+			}
+			ret.WriteByte('\n')
+		}
+		return ret.Bytes(), nil
 	}
-	err = scanner.Err()
-	if len(ranges) > 0 {
-		ranger = iplist.New(ranges)
-		log.TLogln("Readed ranges:", len(ranges))
+	return buf, nil
+}
+
+// Blocklist is merged list of ip ranges
+type Blocklist struct {
+	v4, v6 *iplist.IPList
+}
+
+// NewBlocklist sorts ranges and merges overlapped ones
+func NewBlocklist(ranges []iplist.Range) *Blocklist {
+	var v4, v6 []iplist.Range
+	for _, r := range ranges {
+		if len(r.First) == net.IPv4len {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
 	}
-	return
+	return &Blocklist{v4: iplist.New(mergeRanges(v4)), v6: iplist.New(mergeRanges(v6))}
+}
+
+func mergeRanges(ranges []iplist.Range) []iplist.Range {
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].First, ranges[j].First) < 0
+	})
+	var ret []iplist.Range
+	for _, r := range ranges {
+		if n := len(ret); n > 0 && bytes.Compare(r.First, nextIP(ret[n-1].Last)) <= 0 {
+			if bytes.Compare(r.Last, ret[n-1].Last) > 0 {
+				ret[n-1].Last = r.Last
+			}
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// nextIP returns ip + 1, the last ip is returned as is
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return ip
+}
+
+func (b *Blocklist) Lookup(ip net.IP) (iplist.Range, bool) {
+	if v4 := ip.To4(); v4 != nil {
+		return b.v4.Lookup(v4)
+	}
+	return b.v6.Lookup(ip)
+}
+
+func (b *Blocklist) NumRanges() int {
+	return b.v4.NumRanges() + b.v6.NumRanges()
 }
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent/iplist"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	tests := []struct {
+		name  string
+		list  string
+		want  []string // first-last description
+		fails bool
+	}{
+		{
+			name: "ipv4 cidr",
+			list: "10.0.0.0/8",
+			want: []string{"10.0.0.0-10.255.255.255 "},
+		},
+		{
+			name: "ipv6 cidr",
+			list: "2001:db8::/32",
+			want: []string{"2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff "},
+		},
+		{
+			name: "p2p with colon in description",
+			list: "Bad: peers, inc:1.2.3.4-1.2.3.5",
+			want: []string{"1.2.3.4-1.2.3.5 Bad: peers, inc"},
+		},
+		{
+			name: "dat",
+			list: "001.002.004.000 - 001.002.004.255 , 000 , Some org",
+			want: []string{"1.2.4.0-1.2.4.255 Some org"},
+		},
+		{
+			name: "dat access level above 127 is allowed",
+			list: "001.002.004.000 - 001.002.004.255 , 200 , Allowed\n005.006.007.008 - 005.006.007.009 , 127 , Blocked",
+			want: []string{"5.6.7.8-5.6.7.9 Blocked"},
+		},
+		{
+			name: "leading zero octets are decimal",
+			list: "010.000.000.001\n008.009.010.011 - 008.009.010.099 , 0",
+			want: []string{"10.0.0.1-10.0.0.1 ", "8.9.10.11-8.9.10.99 "},
+		},
+		{
+			name: "comments and wrong lines are skipped",
+			list: "# comment\n// comment\n\nwrong line\n1.2.3.4",
+			want: []string{"1.2.3.4-1.2.3.4 "},
+		},
+		{
+			name:  "reversed range is wrong",
+			list:  "desc:1.2.3.5-1.2.3.4",
+			fails: true,
+		},
+		{
+			name:  "unknown format",
+			list:  "wrong line\nanother one",
+			fails: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := ParseBlocklist([]byte(tt.list))
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("no error, ranges %v", ranges)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range ranges {
+				got = append(got, r.First.String()+"-"+r.Last.String()+" "+r.Description)
+				if v4 := r.First.To4(); v4 != nil && len(r.First) != net.IPv4len {
+					t.Errorf("ipv4 %v isn't 4 bytes long", r.First)
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBlocklistGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("desc:1.2.3.4-1.2.3.5\n"))
+	zw.Close()
+	ranges, err := ParseBlocklist(buf.Bytes())
+	if err != nil || len(ranges) != 1 {
+		t.Fatalf("ranges %v, err %v", ranges, err)
+	}
+
+	// compression bomb
+	buf.Reset()
+	zw = gzip.NewWriter(&buf)
+	chunk := make([]byte, 1<<20)
+	for i := 0; i <= maxBlocklistSize>>20; i++ {
+		zw.Write(chunk)
+	}
+	zw.Close()
+	if _, err := ParseBlocklist(buf.Bytes()); err != errBlocklistTooBig {
+		t.Fatalf("err %v, want %v", err, errBlocklistTooBig)
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	r := func(first, last string) iplist.Range {
+		return iplist.Range{First: parseIP(first), Last: parseIP(last)}
+	}
+	tests := []struct {
+		name   string
+		ranges []iplist.Range
+		want   []string
+	}{
+		{
+			name:   "overlapped",
+			ranges: []iplist.Range{r("1.0.0.5", "1.0.0.20"), r("1.0.0.0", "1.0.0.10")},
+			want:   []string{"1.0.0.0-1.0.0.20"},
+		},
+		{
+			name:   "adjacent",
+			ranges: []iplist.Range{r("1.0.0.0", "1.0.0.255"), r("1.0.1.0", "1.0.1.10")},
+			want:   []string{"1.0.0.0-1.0.1.10"},
+		},
+		{
+			name:   "contained",
+			ranges: []iplist.Range{r("1.0.0.0", "1.0.0.100"), r("1.0.0.5", "1.0.0.6")},
+			want:   []string{"1.0.0.0-1.0.0.100"},
+		},
+		{
+			name:   "gap",
+			ranges: []iplist.Range{r("1.0.0.12", "1.0.0.20"), r("1.0.0.0", "1.0.0.10")},
+			want:   []string{"1.0.0.0-1.0.0.10", "1.0.0.12-1.0.0.20"},
+		},
+		{
+			name:   "last ip",
+			ranges: []iplist.Range{r("255.255.255.0", "255.255.255.255"), r("255.255.255.255", "255.255.255.255")},
+			want:   []string{"255.255.255.0-255.255.255.255"},
+		},
+		{
+			name:   "ipv6 adjacent",
+			ranges: []iplist.Range{r("2001:db8::", "2001:db8::ffff"), r("2001:db8::1:0", "2001:db8::1:1")},
+			want:   []string{"2001:db8::-2001:db8::1:1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range mergeRanges(tt.ranges) {
+				got = append(got, r.First.String()+"-"+r.Last.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
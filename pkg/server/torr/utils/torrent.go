@@ -2,83 +2,11 @@ package utils
 
 import (
 	"encoding/base32"
-	"io"
 	"math/rand"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
-
-	"github.com/german2285/TorrPlayer/pkg/server/settings"
 
 	"golang.org/x/time/rate"
 )
 
-var defTrackers = []string{
-	"http://retracker.local/announce",
-	"http://bt4.t-ru.org/ann?magnet",
-	"http://retracker.mgts.by:80/announce",
-	"http://tracker.city9x.com:2710/announce",
-	"http://tracker.electro-torrent.pl:80/announce",
-	"http://tracker.internetwarriors.net:1337/announce",
-	"http://tracker2.itzmx.com:6961/announce",
-	"udp://opentor.org:2710",
-	"udp://public.popcorn-tracker.org:6969/announce",
-	"udp://tracker.opentrackr.org:1337/announce",
-	"http://bt.svao-ix.ru/announce",
-	"udp://explodie.org:6969/announce",
-	"wss://tracker.btorrent.xyz",
-	"wss://tracker.openwebtorrent.com",
-}
-
-var loadedTrackers []string
-
-func GetTrackerFromFile() []string {
-	name := filepath.Join(settings.Path, "trackers.txt")
-	buf, err := os.ReadFile(name)
-	if err == nil {
-		list := strings.Split(string(buf), "\n")
-		var ret []string
-		for _, l := range list {
-			if strings.HasPrefix(l, "udp") || strings.HasPrefix(l, "http") {
-				ret = append(ret, l)
-			}
-		}
-		return ret
-	}
-	return nil
-}
-
-func GetDefTrackers() []string {
-	loadNewTracker()
-	if len(loadedTrackers) == 0 {
-		return defTrackers
-	}
-	return loadedTrackers
-}
-
-func loadNewTracker() {
-	if len(loadedTrackers) > 0 {
-		return
-	}
-	resp, err := http.Get("https://raw.githubusercontent.com/ngosang/trackerslist/master/trackers_best_ip.txt")
-	if err == nil {
-		defer resp.Body.Close()
-		buf, err := io.ReadAll(resp.Body)
-		if err == nil {
-			arr := strings.Split(string(buf), "\n")
-			var ret []string
-			for _, s := range arr {
-				s = strings.TrimSpace(s)
-				if len(s) > 0 {
-					ret = append(ret, s)
-				}
-			}
-			loadedTrackers = append(ret, defTrackers...)
-		}
-	}
-}
-
 func PeerIDRandom(peer string) string {
 	randomBytes := make([]byte, 32)
 	_, err := rand.Read(randomBytes)
@@ -99,3 +27,21 @@ func Limit(i int) *rate.Limiter {
 	}
 	return l
 }
+
+// SetLimit changes limiter created by Limit in place, 0 - inf
+func SetLimit(l *rate.Limiter, i int) {
+	if l == nil {
+		return
+	}
+	if i > 0 {
+		b := i
+		if b < 16*1024 {
+			b = 16 * 1024
+		}
+		l.SetBurst(b)
+		l.SetLimit(rate.Limit(i))
+	} else {
+		l.SetLimit(rate.Inf)
+		l.SetBurst(0)
+	}
+}
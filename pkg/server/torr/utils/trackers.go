@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
+	"github.com/german2285/TorrPlayer/pkg/server/settings"
+)
+
+var defTrackers = []string{
+	"http://retracker.local/announce",
+	"http://bt4.t-ru.org/ann?magnet",
+	"http://retracker.mgts.by:80/announce",
+	"http://tracker.city9x.com:2710/announce",
+	"http://tracker.electro-torrent.pl:80/announce",
+	"http://tracker.internetwarriors.net:1337/announce",
+	"http://tracker2.itzmx.com:6961/announce",
+	"udp://opentor.org:2710",
+	"udp://public.popcorn-tracker.org:6969/announce",
+	"udp://tracker.opentrackr.org:1337/announce",
+	"http://bt.svao-ix.ru/announce",
+	"udp://explodie.org:6969/announce",
+	"wss://tracker.btorrent.xyz",
+	"wss://tracker.openwebtorrent.com",
+}
+
+const (
+	trackersCacheName = "trackers_cache.json"
+	// failed refresh is not repeated earlier
+	trackersRetry = 10 * time.Minute
+)
+
+// trackersList is a downloaded list of trackers, saved in cache file
+type trackersList struct {
+	ETag     string   `json:"etag,omitempty"`
+	Modified string   `json:"modified,omitempty"`
+	Fetched  int64    `json:"fetched"` // unix time
+	Trackers []string `json:"trackers"`
+}
+
+var (
+	lists       map[string]*trackersList // by list url
+	muLists     sync.Mutex
+	refreshing  atomic.Bool
+	lastRefresh time.Time
+	onUpdate    func()
+)
+
+func GetTrackerFromFile() []string {
+	name := filepath.Join(settings.Path, "trackers.txt")
+	buf, err := os.ReadFile(name)
+	if err == nil {
+		list := strings.Split(string(buf), "\n")
+		var ret []string
+		for _, l := range list {
+			if strings.HasPrefix(l, "udp") || strings.HasPrefix(l, "http") {
+				ret = append(ret, l)
+			}
+		}
+		return NormalizeTrackers(ret)
+	}
+	return nil
+}
+
+// GetDefTrackers returns retrackers from cached lists and built-in ones,
+// stale lists are refreshed in background so the call never waits for network
+func GetDefTrackers() []string {
+	muLists.Lock()
+	loadTrackersCache()
+	var ret []string
+	stale := false
+	for _, u := range trackersListURLs() {
+		l := lists[u]
+		if l == nil || time.Since(time.Unix(l.Fetched, 0)) > trackersTTL() {
+			stale = true
+		}
+		if l != nil {
+			ret = append(ret, l.Trackers...)
+		}
+	}
+	retry := time.Since(lastRefresh) > trackersRetry
+	muLists.Unlock()
+
+	if stale && retry {
+		go RefreshDefTrackers(false)
+	}
+	return NormalizeTrackers(append(ret, defTrackers...))
+}
+
+// SetDefTrackersUpdated sets func called when downloaded lists of trackers were changed
+func SetDefTrackersUpdated(fn func()) {
+	muLists.Lock()
+	onUpdate = fn
+	muLists.Unlock()
+}
+
+// RefreshDefTrackers downloads stale lists of trackers, force downloads all lists,
+// lists not changed on server are revalidated with ETag
+func RefreshDefTrackers(force bool) error {
+	if !refreshing.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer refreshing.Store(false)
+
+	muLists.Lock()
+	loadTrackersCache()
+	lastRefresh = time.Now()
+	urls := trackersListURLs()
+	old := make(map[string]trackersList)
+	for _, u := range urls {
+		if l := lists[u]; l != nil {
+			old[u] = *l
+		}
+	}
+	muLists.Unlock()
+
+	var errs []error
+	changed := false
+	for _, u := range urls {
+		prev, ok := old[u]
+		if ok && !force && time.Since(time.Unix(prev.Fetched, 0)) <= trackersTTL() {
+			continue
+		}
+		l, err := fetchTrackersList(u, prev)
+		if err != nil {
+			log.TLogln("Error load trackers list", u, err)
+			errs = append(errs, err)
+			continue
+		}
+		if !slices.Equal(l.Trackers, prev.Trackers) {
+			changed = true
+		}
+		muLists.Lock()
+		lists[u] = l
+		muLists.Unlock()
+	}
+
+	muLists.Lock()
+	saveTrackersCache()
+	fn := onUpdate
+	muLists.Unlock()
+	if changed && fn != nil {
+		fn()
+	}
+	return errors.Join(errs...)
+}
+
+func fetchTrackersList(u string, prev trackersList) (*trackersList, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if prev.Modified != "" {
+		req.Header.Set("If-Modified-Since", prev.Modified)
+	}
+	client := proxy.Client(30 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		prev.Fetched = time.Now().Unix()
+		return &prev, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("response: %s", resp.Status)
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	var trackers []string
+	for _, s := range strings.Split(string(buf), "\n") {
+		s = strings.TrimSpace(s)
+		if s != "" && !strings.HasPrefix(s, "#") {
+			trackers = append(trackers, s)
+		}
+	}
+	trackers = NormalizeTrackers(trackers)
+	if len(trackers) == 0 {
+		return nil, errors.New("empty trackers list")
+	}
+	return &trackersList{
+		ETag:     resp.Header.Get("ETag"),
+		Modified: resp.Header.Get("Last-Modified"),
+		Fetched:  time.Now().Unix(),
+		Trackers: trackers,
+	}, nil
+}
+
+// NormalizeTracker returns announce url with lower case scheme and host and without default port,
+// empty string for wrong url
+func NormalizeTracker(tr string) string {
+	u, err := url.Parse(strings.TrimSpace(tr))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	switch u.Scheme {
+	case "http", "https", "udp", "udp4", "udp6", "ws", "wss":
+	default:
+		return ""
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (port == "80" && (u.Scheme == "http" || u.Scheme == "ws")) ||
+		(port == "443" && (u.Scheme == "https" || u.Scheme == "wss")) {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	return u.String()
+}
+
+// NormalizeTrackers normalizes urls and removes duplicates and wrong urls
+func NormalizeTrackers(list []string) []string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, tr := range list {
+		tr = NormalizeTracker(tr)
+		if tr == "" || seen[tr] {
+			continue
+		}
+		seen[tr] = true
+		ret = append(ret, tr)
+	}
+	return ret
+}
+
+func trackersListURLs() []string {
+	if settings.BTsets == nil || len(settings.BTsets.TrackersLists) == 0 {
+		return []string{settings.DefTrackersList}
+	}
+	return settings.BTsets.TrackersLists
+}
+
+func trackersTTL() time.Duration {
+	if settings.BTsets == nil || settings.BTsets.TrackersListTTL <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(settings.BTsets.TrackersListTTL) * time.Hour
+}
+
+// loadTrackersCache must be called with muLists held
+func loadTrackersCache() {
+	if lists != nil {
+		return
+	}
+	lists = make(map[string]*trackersList)
+	buf, err := os.ReadFile(filepath.Join(settings.Path, trackersCacheName))
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(buf, &lists); err != nil {
+		log.TLogln("Error read trackers cache", err)
+		lists = make(map[string]*trackersList)
+	}
+}
+
+// saveTrackersCache must be called with muLists held
+func saveTrackersCache() {
+	if settings.ReadOnly {
+		return
+	}
+	buf, err := json.MarshalIndent(lists, "", " ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(settings.Path, trackersCacheName), buf, 0o644); err != nil {
+		log.TLogln("Error save trackers cache", err)
+	}
+}
@@ -5,19 +5,20 @@ import (
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
-	"net/http"
 	"strings"
+	"time"
 
 	"golang.org/x/image/webp"
 
 	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
 )
 
 func CheckImgUrl(link string) bool {
 	if link == "" {
 		return false
 	}
-	resp, err := http.Get(link)
+	resp, err := proxy.Client(time.Minute).Get(link)
 	if err != nil {
 		log.TLogln("Error check image:", err)
 		return false
@@ -0,0 +1,348 @@
+package torr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/log"
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
+	"github.com/german2285/TorrPlayer/pkg/server/torr/state"
+)
+
+const (
+	webSeedTick     = time.Second
+	webSeedScarce   = 5 // web seeds are used while torrent has less active peers
+	webSeedRequests = 2 // pieces fetched at once from one web seed
+	webSeedTimeout  = time.Minute
+	webSeedRetry    = 30 * time.Second // doubled after every failure
+	webSeedRetryMax = 10 * time.Minute
+)
+
+var ErrWebSeedNotFound = errors.New("web seed not found")
+
+// webSeed is http source of torrent, only its state is changed by fetches
+type webSeed struct {
+	state.WebSeedStatus
+	fails int
+	retry time.Time
+}
+
+// webSeeder fetches pieces wanted by the client from web seeds, BEP 19.
+// Pieces are chosen by priority of the client, so priorities of stream readers
+// set in torrstor.Cache.setLoadPriority are applied to web seeds too
+type webSeeder struct {
+	t      *Torrent
+	client *http.Client
+	seeds  []*webSeed
+	busy   map[int]bool // pieces fetched now
+	once   sync.Once
+	mu     sync.Mutex
+}
+
+// validWebSeedURL checks web seed url, only http sources are supported
+func validWebSeedURL(u string) error {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+		return fmt.Errorf("wrong web seed url: %s", u)
+	}
+	return nil
+}
+
+// WebSeedsFromMagnet returns web seeds of magnet, ws parameters or url-list of metainfo
+func WebSeedsFromMagnet(m metainfo.Magnet) []string {
+	var ret []string
+	for _, u := range m.Params["ws"] {
+		if u = strings.TrimSpace(u); validWebSeedURL(u) == nil && !slices.Contains(ret, u) {
+			ret = append(ret, u)
+		}
+	}
+	return ret
+}
+
+func (t *Torrent) webSeedURLs() []string {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	return slices.Clone(t.WebSeeds)
+}
+
+// AddWebSeeds adds http sources to torrent, they are used when metadata is received
+func (t *Torrent) AddWebSeeds(urls []string) error {
+	var add []string
+	for _, u := range urls {
+		u = strings.TrimSpace(u)
+		if err := validWebSeedURL(u); err != nil {
+			return err
+		}
+		add = append(add, u)
+	}
+	t.muTorrent.Lock()
+	for _, u := range add {
+		if !slices.Contains(t.WebSeeds, u) {
+			t.WebSeeds = append(t.WebSeeds, u)
+		}
+	}
+	t.muTorrent.Unlock()
+	t.syncWebSeeds()
+	return nil
+}
+
+// RemoveWebSeed removes http source of torrent, running fetches are finished
+func (t *Torrent) RemoveWebSeed(u string) error {
+	u = strings.TrimSpace(u)
+	t.muTorrent.Lock()
+	i := slices.Index(t.WebSeeds, u)
+	if i < 0 {
+		t.muTorrent.Unlock()
+		return ErrWebSeedNotFound
+	}
+	t.WebSeeds = slices.Delete(slices.Clone(t.WebSeeds), i, i+1)
+	t.muTorrent.Unlock()
+	t.syncWebSeeds()
+	return nil
+}
+
+// WebSeedList returns http sources of torrent with fetch state, torrent from DB has no state
+func (t *Torrent) WebSeedList() []*state.WebSeedStatus {
+	t.muTorrent.Lock()
+	ws := t.webSeeder
+	t.muTorrent.Unlock()
+	if ws != nil {
+		return ws.list()
+	}
+	var ret []*state.WebSeedStatus
+	for _, u := range t.webSeedURLs() {
+		ret = append(ret, &state.WebSeedStatus{URL: u})
+	}
+	return ret
+}
+
+// startWebSeeds starts fetches from web seeds when torrent has info
+func (t *Torrent) startWebSeeds() {
+	t.muTorrent.Lock()
+	if t.webSeeder == nil {
+		t.webSeeder = &webSeeder{
+			t:      t,
+			client: proxy.Client(webSeedTimeout),
+			busy:   make(map[int]bool),
+		}
+	}
+	ws := t.webSeeder
+	t.muTorrent.Unlock()
+	t.syncWebSeeds()
+	ws.once.Do(func() { go ws.run() })
+}
+
+// syncWebSeeds applies list of web seeds to running fetcher
+func (t *Torrent) syncWebSeeds() {
+	t.muTorrent.Lock()
+	ws := t.webSeeder
+	urls := slices.Clone(t.WebSeeds)
+	t.muTorrent.Unlock()
+	if ws == nil {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	var seeds []*webSeed
+	for _, u := range urls {
+		i := slices.IndexFunc(ws.seeds, func(s *webSeed) bool { return s.URL == u })
+		if i >= 0 {
+			seeds = append(seeds, ws.seeds[i])
+		} else {
+			seeds = append(seeds, &webSeed{WebSeedStatus: state.WebSeedStatus{URL: u}})
+		}
+	}
+	ws.seeds = seeds
+}
+
+func (ws *webSeeder) list() []*state.WebSeedStatus {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ret := make([]*state.WebSeedStatus, 0, len(ws.seeds))
+	for _, s := range ws.seeds {
+		st := s.WebSeedStatus
+		if !s.retry.IsZero() && time.Now().Before(s.retry) {
+			st.RetryAt = s.retry.Unix()
+		}
+		ret = append(ret, &st)
+	}
+	return ret
+}
+
+func (ws *webSeeder) run() {
+	tick := time.NewTicker(webSeedTick)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ws.t.closed:
+			return
+		case <-tick.C:
+			ws.schedule()
+		}
+	}
+}
+
+// schedule starts fetches of wanted pieces while peers are scarce
+func (ws *webSeeder) schedule() {
+	t := ws.t
+	if t.Torrent == nil || t.Torrent.Info() == nil || t.State() == state.TorrentClosed {
+		return
+	}
+	if t.bt != nil && t.bt.NetworkPaused() {
+		return
+	}
+	ws.mu.Lock()
+	empty := len(ws.seeds) == 0
+	ws.mu.Unlock()
+	if empty || t.Torrent.Stats().ActivePeers >= webSeedScarce {
+		return
+	}
+
+	runs := t.Torrent.PieceStateRuns()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	now := time.Now()
+	for _, s := range ws.seeds {
+		for s.Active < webSeedRequests && !now.Before(s.retry) {
+			id := ws.nextPiece(runs)
+			if id < 0 {
+				return
+			}
+			ws.busy[id] = true
+			s.Active++
+			go ws.fetch(s, id)
+		}
+	}
+}
+
+// nextPiece returns wanted piece with the highest priority which isn't fetched now, -1 - nothing to fetch
+func (ws *webSeeder) nextPiece(runs []torrent.PieceStateRun) int {
+	best, bestPrio := -1, torrent.PiecePriorityNone
+	id := 0
+	for _, run := range runs {
+		if run.Complete || run.Checking || run.Priority <= bestPrio {
+			id += run.Length
+			continue
+		}
+		for i := id; i < id+run.Length; i++ {
+			if !ws.busy[i] {
+				best, bestPrio = i, run.Priority
+				break
+			}
+		}
+		id += run.Length
+	}
+	return best
+}
+
+func (ws *webSeeder) fetch(s *webSeed, id int) {
+	t := ws.t
+	info := t.Torrent.Info()
+	mp := info.Piece(id)
+	buf := make([]byte, mp.Length())
+	err := ws.download(s.URL, info, mp.Offset(), buf)
+	if err == nil && t.ctx.Err() == nil && !t.Torrent.PieceState(id).Complete {
+		p := t.Torrent.Piece(id)
+		if _, err = p.Storage().WriteAt(buf, 0); err == nil {
+			p.VerifyData()
+			if !t.Torrent.PieceState(id).Complete {
+				err = fmt.Errorf("piece %d failed hash check", id)
+			}
+		}
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	delete(ws.busy, id)
+	s.Active--
+	if err != nil {
+		if t.ctx.Err() != nil {
+			return
+		}
+		s.fails++
+		s.Error = err.Error()
+		s.retry = time.Now().Add(min(webSeedRetry<<min(s.fails-1, 5), webSeedRetryMax))
+		log.TLogln("Error web seed", s.URL+":", err)
+		return
+	}
+	s.fails = 0
+	s.Error = ""
+	s.Downloaded += int64(len(buf))
+}
+
+// download reads range of torrent from web seed into buf, range may span several files
+func (ws *webSeeder) download(base string, info *metainfo.Info, off int64, buf []byte) error {
+	end := off + int64(len(buf))
+	var fileOff int64
+	for _, fi := range info.UpvertedFiles() {
+		start, stop := max(off, fileOff), min(end, fileOff+fi.Length)
+		if start < stop {
+			if err := ws.get(webSeedFileURL(base, info, fi), start-fileOff, buf[start-off:stop-off]); err != nil {
+				return err
+			}
+		}
+		fileOff += fi.Length
+		if fileOff >= end {
+			break
+		}
+	}
+	return nil
+}
+
+// get reads part of file from offset with range request
+func (ws *webSeeder) get(u string, off int64, buf []byte) error {
+	req, err := http.NewRequestWithContext(ws.t.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(buf))-1))
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK && off == 0:
+		// server ignores ranges, beginning of file is read
+	case resp.StatusCode == http.StatusOK:
+		return errors.New("web seed doesn't support range requests")
+	default:
+		return fmt.Errorf("web seed: %s", resp.Status)
+	}
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		return fmt.Errorf("web seed: %w", err)
+	}
+	return nil
+}
+
+// webSeedFileURL returns url of file on web seed, url of multi file torrent is a directory with torrent name
+func webSeedFileURL(base string, info *metainfo.Info, fi metainfo.FileInfo) string {
+	if !info.IsDir() {
+		if strings.HasSuffix(base, "/") {
+			return base + url.PathEscape(info.BestName())
+		}
+		return base
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	parts := []string{url.PathEscape(info.BestName())}
+	for _, p := range fi.BestPath() {
+		parts = append(parts, url.PathEscape(p))
+	}
+	return base + strings.Join(parts, "/")
+}
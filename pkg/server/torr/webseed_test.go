@@ -0,0 +1,83 @@
+package torr
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebSeedMultiFile(t *testing.T) {
+	bt := newTestBTS(t, 8*testPieceLength)
+	// pieces span ends of files
+	spec, data := testSpec(t, 20000, 50000, 40000)
+	torr := addTestTorrent(t, bt, spec)
+
+	// mirror keeps files in directory with torrent name
+	dir := t.TempDir()
+	var off int64
+	for _, fi := range torr.Info().UpvertedFiles() {
+		path := filepath.Join(append([]string{dir, torr.Info().BestName()}, fi.BestPath()...)...)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, data[off:off+fi.Length], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		off += fi.Length
+	}
+	var mu sync.Mutex
+	var ranges []string
+	files := http.FileServer(http.Dir(dir))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.URL.Path+" "+r.Header.Get("Range"))
+		mu.Unlock()
+		files.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	if err := torr.AddWebSeeds([]string{srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	// there are no peers, readers get all pieces from web seed
+	for _, file := range torr.Files() {
+		reader := torr.NewReader(file)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		buf := make([]byte, file.Length())
+		for n := 0; n < len(buf); {
+			m, err := reader.ReadContext(ctx, buf[n:])
+			n += m
+			if err != nil && n < len(buf) {
+				t.Fatalf("read %s at %d: %v", file.Path(), n, err)
+			}
+		}
+		cancel()
+		torr.CloseReader(reader)
+		if !bytes.Equal(buf, data[file.Offset():file.Offset()+file.Length()]) {
+			t.Fatalf("wrong data of %s", file.Path())
+		}
+	}
+
+	// the first piece is read from the end of the first file and the beginning of the second one
+	mu.Lock()
+	got := strings.Join(ranges, "\n")
+	mu.Unlock()
+	for _, want := range []string{"/test/file0.bin bytes=0-19999", "/test/file1.bin bytes=0-12767"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("no request %q in:\n%s", want, got)
+		}
+	}
+	// readers get the last piece before its fetch is counted
+	st := torr.WebSeedList()[0]
+	for deadline := time.Now().Add(5 * time.Second); st.Active > 0 && time.Now().Before(deadline); st = torr.WebSeedList()[0] {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.Downloaded != int64(len(data)) || st.Active != 0 || st.Error != "" {
+		t.Fatalf("wrong state of web seed: %+v", st)
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/german2285/TorrPlayer/pkg/server/proxy"
 )
 
 func ParseLink(link string) (*torrent.TorrentSpec, error) {
@@ -59,8 +61,7 @@ func fromHttp(link string) (*torrent.TorrentSpec, error) {
 		return nil, err
 	}
 
-	client := new(http.Client)
-	client.Timeout = time.Duration(time.Second * 60)
+	client := proxy.Client(time.Duration(time.Second * 60))
 	req.Header.Set("User-Agent", "TorrServer-min/1.0")
 
 	resp, err := client.Do(req)
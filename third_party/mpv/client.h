@@ -29,6 +29,19 @@ typedef struct mpv_event {
     void *data;
 } mpv_event;
 
+typedef enum mpv_end_file_reason {
+    MPV_END_FILE_REASON_EOF = 0,
+    MPV_END_FILE_REASON_STOP = 2,
+    MPV_END_FILE_REASON_QUIT = 3,
+    MPV_END_FILE_REASON_ERROR = 4,
+    MPV_END_FILE_REASON_REDIRECT = 5,
+} mpv_end_file_reason;
+
+typedef struct mpv_event_end_file {
+    mpv_end_file_reason reason;
+    int error;
+} mpv_event_end_file;
+
 // MPV API functions
 mpv_handle *mpv_create(void);
 int mpv_initialize(mpv_handle *ctx);